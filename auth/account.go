@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/config"
+	"go-crud/logging"
+	"go-crud/mailer"
+	"go-crud/models"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidUserToken    = errors.New("invalid or expired token")
+	ErrMailerNotConfigured = errors.New("mailer is not configured")
+)
+
+// Purposes of single-use user tokens
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeMFAChallenge      = "mfa_challenge"
+)
+
+// AccountOptions configures the links sent for password reset and email
+// verification
+type AccountOptions struct {
+	AppURL               string // links point to AppURL/reset-password and AppURL/verify-email
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+}
+
+// DefaultAccountOptions issues 1 hour reset links and 48 hour verification links
+func DefaultAccountOptions() AccountOptions {
+	return AccountOptions{
+		AppURL:               "http://localhost:8080",
+		PasswordResetTTL:     time.Hour,
+		EmailVerificationTTL: 48 * time.Hour,
+	}
+}
+
+// AccountOptionsFromConfig returns the account options of mail configuration
+func AccountOptionsFromConfig(cfg *config.MailConfig) AccountOptions {
+	return AccountOptions{
+		AppURL:               cfg.AppURL,
+		PasswordResetTTL:     cfg.PasswordResetTTL,
+		EmailVerificationTTL: cfg.EmailVerificationTTL,
+	}
+}
+
+// SetMailer enables the password reset and email verification flows
+func (as *AuthService) SetMailer(m mailer.Mailer, options AccountOptions) {
+	as.mailer = m
+	as.account = options
+}
+
+// RequestPasswordReset emails a password reset link to the active account
+// registered with email. The lookup and the email happen in the background,
+// so neither the result nor the response time reveals whether the email is
+// registered; only a missing mailer is reported.
+func (as *AuthService) RequestPasswordReset(email string) error {
+	if as.mailer == nil {
+		return ErrMailerNotConfigured
+	}
+
+	as.sendMailAsync("password reset", 0, func() error {
+		return as.sendPasswordReset(email)
+	})
+	return nil
+}
+
+func (as *AuthService) sendPasswordReset(email string) error {
+	var user models.User
+	if err := config.DB.Where("email = ? AND is_active = ?", email, true).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	token, err := as.issueUserToken(&user, PurposePasswordReset, as.account.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return as.mailer.Send(&mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Use the link below to choose a new password. It expires in %s and can only be used once.\n\n"+
+			"%s\n\n"+
+			"If you did not request a password reset, you can ignore this email.\n",
+			user.Username, as.account.PasswordResetTTL, as.accountLink("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets a new password using a token sent by
+// RequestPasswordReset and lifts any lockout. Every token and session of
+// the user is revoked.
+func (as *AuthService) ResetPassword(token, newPassword string, client ClientInfo) (*models.User, error) {
+	hashedPassword, err := as.HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeUserToken(tx, PurposePasswordReset, token)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, userToken.UserID).Error; err != nil || !user.IsActive {
+			return ErrInvalidUserToken
+		}
+
+		// Proving control of the mailbox also lifts a lockout
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"password":              hashedPassword,
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.GetLogger().LogAuthEvent("password_reset", user.Username, user.ID, true, client.IPAddress)
+	as.throttle.resetEmail(user.Email)
+
+	// Whoever knew the old password may still hold tokens
+	if err := as.RevokeUserTokens(user.ID); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// SendEmailVerification emails a verification link to the user's address.
+// Links sent earlier stop working.
+func (as *AuthService) SendEmailVerification(user *models.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+	if as.mailer == nil {
+		return ErrMailerNotConfigured
+	}
+
+	token, err := as.issueUserToken(user, PurposeEmailVerification, as.account.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return as.mailer.Send(&mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Please confirm that %s is your email address by opening the link below. It expires in %s.\n\n"+
+			"%s\n",
+			user.Username, user.Email, as.account.EmailVerificationTTL, as.accountLink("/verify-email", token)),
+	})
+}
+
+// VerifyEmail marks the email address of the token's user as verified
+func (as *AuthService) VerifyEmail(token string) (*models.User, error) {
+	var user models.User
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeUserToken(tx, PurposeEmailVerification, token)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, userToken.UserID).Error; err != nil {
+			return ErrInvalidUserToken
+		}
+
+		now := time.Now()
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// notifyExistingAccount tells the owner of an email that someone tried to
+// register it again
+func (as *AuthService) notifyExistingAccount(user *models.User) error {
+	if as.mailer == nil {
+		return ErrMailerNotConfigured
+	}
+
+	return as.mailer.Send(&mailer.Message{
+		To:      []string{user.Email},
+		Subject: "You already have an account",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Someone tried to create a new account with this email address, which already belongs to your account.\n\n"+
+			"If it was you, sign in instead, or reset your password at:\n\n"+
+			"%s\n\n"+
+			"Otherwise you can ignore this email.\n",
+			user.Username, strings.TrimRight(as.account.AppURL, "/")+"/forgot-password"),
+	})
+}
+
+// sendMailAsync runs send in the background so response times do not depend
+// on whether, or how slowly, an email was sent
+func (as *AuthService) sendMailAsync(kind string, userID uint, send func() error) {
+	go func() {
+		if err := send(); err != nil && !errors.Is(err, ErrMailerNotConfigured) {
+			logging.GetLogger().WithUserID(userID).Error("Failed to send "+kind+" email", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+}
+
+// issueUserToken creates a token for purpose and invalidates the user's
+// earlier tokens for the same purpose
+func (as *AuthService) issueUserToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := invalidateUserTokens(tx, user.ID, purpose); err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return token, nil
+}
+
+// consumeUserToken marks an unused, unexpired token as used and returns it
+func consumeUserToken(tx *gorm.DB, purpose, token string) (*models.UserToken, error) {
+	var userToken models.UserToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&userToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidUserToken
+		}
+		return nil, err
+	}
+
+	if userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+
+	// Only one request can consume a token, even when two race
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", userToken.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidUserToken
+	}
+
+	if err := invalidateUserTokens(tx, userToken.UserID, purpose); err != nil {
+		return nil, err
+	}
+
+	return &userToken, nil
+}
+
+func invalidateUserTokens(tx *gorm.DB, userID uint, purpose string) error {
+	return tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+func (as *AuthService) accountLink(path, token string) string {
+	return strings.TrimRight(as.account.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
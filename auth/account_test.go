@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"go-crud/mailer"
+	"go-crud/models"
+
+	"gorm.io/gorm"
+)
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// waitForMessages waits until m has sent n messages. Account emails are
+// sent in the background.
+func waitForMessages(t *testing.T, m *mailer.MemoryMailer, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); len(m.Messages()) < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d emails sent, want %d", len(m.Messages()), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// mailedToken returns the token of the link in the last email sent to address
+func mailedToken(t *testing.T, m *mailer.MemoryMailer, address, path string) string {
+	t.Helper()
+
+	msg, ok := m.Last(address)
+	if !ok {
+		t.Fatalf("no email sent to %s", address)
+	}
+	link, err := url.Parse(linkPattern.FindString(msg.Body))
+	if err != nil || link.Path != path {
+		t.Fatalf("email to %s has no %s link:\n%s", address, path, msg.Body)
+	}
+	return link.Query().Get("token")
+}
+
+// newAccountTest returns an auth service sending email to a memory mailer
+func newAccountTest(t *testing.T) (*AuthService, *gorm.DB, *mailer.MemoryMailer, *models.User) {
+	t.Helper()
+
+	as, db, user := newSessionTest(t)
+	m := mailer.NewMemoryMailer("noreply@example.com")
+	as.SetMailer(m, AccountOptions{
+		AppURL:               "https://app.example.com/",
+		PasswordResetTTL:     time.Hour,
+		EmailVerificationTTL: time.Hour,
+	})
+	return as, db, m, user
+}
+
+func TestPasswordReset(t *testing.T) {
+	as, _, m, user := newAccountTest(t)
+	pair, err := as.CreateSession(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := as.RequestPasswordReset(user.Email); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessages(t, m, 1)
+	stale := mailedToken(t, m, user.Email, "/reset-password")
+	if err := as.RequestPasswordReset(user.Email); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessages(t, m, 2)
+	token := mailedToken(t, m, user.Email, "/reset-password")
+
+	if _, err := as.ResetPassword(stale, "N3w-password", ClientInfo{}); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("superseded token: err = %v, want %v", err, ErrInvalidUserToken)
+	}
+	if _, err := as.ResetPassword(token, "N3w-password", ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.ResetPassword(token, "An0ther-password", ClientInfo{}); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("used token: err = %v, want %v", err, ErrInvalidUserToken)
+	}
+
+	if _, err := as.Authenticate(user.Email, "N3w-password", ClientInfo{}); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+	if _, err := as.RefreshToken(pair.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("session from before the reset: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestPasswordResetRejected(t *testing.T) {
+	as, db, m, user := newAccountTest(t)
+
+	// Unknown addresses look the same to the caller but get no email
+	if err := as.RequestPasswordReset("nobody@example.com"); err != nil {
+		t.Errorf("unknown email: %v", err)
+	}
+	if err := as.sendPasswordReset("nobody@example.com"); err != nil || len(m.Messages()) != 0 {
+		t.Errorf("unknown email: err = %v, sent %d emails", err, len(m.Messages()))
+	}
+
+	if err := as.RequestPasswordReset(user.Email); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessages(t, m, 1)
+	token := mailedToken(t, m, user.Email, "/reset-password")
+
+	// A reset token does not verify the email address
+	if _, err := as.VerifyEmail(token); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("reset token used for verification: err = %v, want %v", err, ErrInvalidUserToken)
+	}
+
+	db.Model(&models.UserToken{}).Where("user_id = ?", user.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := as.ResetPassword(token, "N3w-password", ClientInfo{}); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expired token: err = %v, want %v", err, ErrInvalidUserToken)
+	}
+
+	if err := NewAuthService("secret").RequestPasswordReset(user.Email); !errors.Is(err, ErrMailerNotConfigured) {
+		t.Errorf("without a mailer: err = %v, want %v", err, ErrMailerNotConfigured)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	as, _, m, user := newAccountTest(t)
+
+	if err := as.SendEmailVerification(user); err != nil {
+		t.Fatal(err)
+	}
+	token := mailedToken(t, m, user.Email, "/verify-email")
+
+	verified, err := as.VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.EmailVerified || verified.EmailVerifiedAt == nil {
+		t.Errorf("user after verification = %+v", verified)
+	}
+	if _, err := as.VerifyEmail(token); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("used token: err = %v, want %v", err, ErrInvalidUserToken)
+	}
+
+	// Verified addresses are not sent another link
+	m.Reset()
+	if err := as.SendEmailVerification(verified); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Messages()) != 0 {
+		t.Error("sent a verification email to a verified address")
+	}
+}
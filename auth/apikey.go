@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"go-crud/config"
+	"go-crud/logging"
+	"go-crud/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidAPIKey = errors.New("invalid or expired API key")
+
+// apiKeyPrefix starts every key so it is recognisable, e.g. by secret scanners
+const apiKeyPrefix = "gck_"
+
+// apiKeyUsageInterval limits how often the last use of a key is written
+const apiKeyUsageInterval = time.Minute
+
+// APIKeyScopes returns the permissions granted to key
+func APIKeyScopes(key *models.APIKey) []Permission {
+	var scopes []Permission
+	for _, scope := range strings.Split(key.Scopes, ",") {
+		if scope != "" {
+			scopes = append(scopes, Permission(scope))
+		}
+	}
+	return scopes
+}
+
+// APIKeyUpdate changes the name and scopes of a key; nil fields are kept
+type APIKeyUpdate struct {
+	Name   *string
+	Scopes []Permission
+}
+
+// CreateAPIKey creates a key of the user limited to scopes. The key is
+// returned only here; afterwards it is identified by its prefix. A nil
+// expiresAt creates a key that does not expire.
+func (as *AuthService) CreateAPIKey(userID uint, name string, scopes []Permission, expiresAt *time.Time) (*models.APIKey, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &models.APIKey{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     apiKeyPrefix + id,
+		SecretHash: hashToken(secret),
+		Scopes:     joinScopes(scopes),
+		ExpiresAt:  expiresAt,
+	}
+	if err := config.DB.Create(key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return key, key.Prefix + "." + secret, nil
+}
+
+// ListAPIKeys returns the keys of a user, newest first
+func (as *AuthService) ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := config.DB.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// GetAPIKey returns a key of the user, or gorm.ErrRecordNotFound
+func (as *AuthService) GetAPIKey(userID, keyID uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := config.DB.Where("id = ? AND user_id = ?", keyID, userID).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// UpdateAPIKey renames a key of the user or replaces its scopes
+func (as *AuthService) UpdateAPIKey(userID, keyID uint, update APIKeyUpdate) (*models.APIKey, error) {
+	key, err := as.GetAPIKey(userID, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if update.Name != nil {
+		updates["name"] = *update.Name
+	}
+	if update.Scopes != nil {
+		updates["scopes"] = joinScopes(update.Scopes)
+	}
+	if len(updates) == 0 {
+		return key, nil
+	}
+
+	if err := config.DB.Model(key).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update API key: %w", err)
+	}
+	return key, nil
+}
+
+// DeleteAPIKey revokes a key of the user, or returns gorm.ErrRecordNotFound
+func (as *AuthService) DeleteAPIKey(userID, keyID uint) error {
+	result := config.DB.Where("id = ? AND user_id = ?", keyID, userID).Delete(&models.APIKey{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete API key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the key, with its user, that rawKey belongs to.
+// Unknown, expired and malformed keys and keys of deactivated or deleted
+// users all return ErrInvalidAPIKey.
+func (as *AuthService) AuthenticateAPIKey(rawKey string, client ClientInfo) (*models.APIKey, error) {
+	prefix, secret, found := strings.Cut(rawKey, ".")
+	if !found || !strings.HasPrefix(prefix, apiKeyPrefix) || secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := config.DB.Preload("User").Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logging.GetLogger().LogAuthEvent("api_key_invalid", prefix, 0, false, client.IPAddress)
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to find API key: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashToken(secret))) != 1 {
+		logging.GetLogger().LogAuthEvent("api_key_invalid", prefix, key.UserID, false, client.IPAddress)
+		return nil, ErrInvalidAPIKey
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.User.ID == 0 || !key.User.IsActive {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUsageInterval || key.LastUsedIP != client.IPAddress {
+		err := config.DB.Model(&models.APIKey{}).Where("id = ?", key.ID).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": client.IPAddress,
+		}).Error
+		if err != nil {
+			logging.GetLogger().WithUserID(key.UserID).Error("Failed to record API key use", map[string]interface{}{"error": err.Error()})
+		}
+		key.LastUsedAt = &now
+		key.LastUsedIP = client.IPAddress
+	}
+
+	return &key, nil
+}
+
+func joinScopes(scopes []Permission) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, ",")
+}
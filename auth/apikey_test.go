@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-crud/models"
+
+	"gorm.io/gorm"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	as, db, user := newSessionTest(t)
+	client := ClientInfo{IPAddress: "192.0.2.1"}
+
+	key, rawKey, err := as.CreateAPIKey(user.ID, "deploy", []Permission{ReadPost, CreatePost}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rawKey, key.Prefix+".") || !strings.HasPrefix(key.Prefix, apiKeyPrefix) {
+		t.Fatalf("key = %s, prefix = %s", rawKey, key.Prefix)
+	}
+	if strings.Contains(key.SecretHash, strings.TrimPrefix(rawKey, key.Prefix+".")) {
+		t.Error("secret stored in clear")
+	}
+
+	authenticated, err := as.AuthenticateAPIKey(rawKey, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated.ID != key.ID || authenticated.User.ID != user.ID {
+		t.Errorf("key = %+v", authenticated)
+	}
+	if scopes := APIKeyScopes(authenticated); len(scopes) != 2 || scopes[0] != ReadPost || scopes[1] != CreatePost {
+		t.Errorf("scopes = %v", scopes)
+	}
+
+	var stored models.APIKey
+	db.First(&stored, key.ID)
+	if stored.LastUsedAt == nil || stored.LastUsedIP != client.IPAddress {
+		t.Errorf("last use = %v from %q", stored.LastUsedAt, stored.LastUsedIP)
+	}
+
+	// Another address is recorded at once
+	if _, err := as.AuthenticateAPIKey(rawKey, ClientInfo{IPAddress: "198.51.100.7"}); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&stored, key.ID)
+	if stored.LastUsedIP != "198.51.100.7" {
+		t.Errorf("last used from %q, want 198.51.100.7", stored.LastUsedIP)
+	}
+
+	prefix, secret, _ := strings.Cut(rawKey, ".")
+	for name, candidate := range map[string]string{
+		"wrong secret":   prefix + ".wrong",
+		"unknown prefix": apiKeyPrefix + "0000000000000000." + secret,
+		"no secret":      prefix + ".",
+		"no separator":   prefix + secret,
+		"bearer token":   "eyJhbGciOiJIUzI1NiJ9.e30.sig",
+	} {
+		if _, err := as.AuthenticateAPIKey(candidate, client); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidAPIKey)
+		}
+	}
+}
+
+func TestAPIKeyRejectedWhenExpiredOrOwnerInactive(t *testing.T) {
+	as, db, user := newSessionTest(t)
+
+	expiresAt := time.Now().Add(time.Hour)
+	key, rawKey, err := as.CreateAPIKey(user.ID, "ci", []Permission{ReadPost}, &expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.AuthenticateAPIKey(rawKey, ClientInfo{}); err != nil {
+		t.Fatalf("before expiry: %v", err)
+	}
+
+	db.Model(key).Update("expires_at", time.Now().Add(-time.Second))
+	if _, err := as.AuthenticateAPIKey(rawKey, ClientInfo{}); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expired: err = %v, want %v", err, ErrInvalidAPIKey)
+	}
+
+	_, rawKey, err = as.CreateAPIKey(user.ID, "no expiry", []Permission{ReadPost}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(user).Update("is_active", false)
+	if _, err := as.AuthenticateAPIKey(rawKey, ClientInfo{}); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("deactivated owner: err = %v, want %v", err, ErrInvalidAPIKey)
+	}
+}
+
+func TestManageAPIKeys(t *testing.T) {
+	as, _, user := newSessionTest(t)
+
+	key, rawKey, err := as.CreateAPIKey(user.ID, "deploy", []Permission{ReadPost}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys of other users are not found
+	const other uint = 999
+	if _, err := as.GetAPIKey(other, key.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("get as another user: err = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if _, err := as.UpdateAPIKey(other, key.ID, APIKeyUpdate{Scopes: []Permission{DeletePost}}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("update as another user: err = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if err := as.DeleteAPIKey(other, key.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("delete as another user: err = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+
+	name := "release"
+	updated, err := as.UpdateAPIKey(user.ID, key.ID, APIKeyUpdate{Name: &name, Scopes: []Permission{UpdatePost}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "release" || updated.Scopes != string(UpdatePost) {
+		t.Errorf("updated key = %+v", updated)
+	}
+
+	keys, err := as.ListAPIKeys(user.ID)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("keys = %v, %v", keys, err)
+	}
+
+	if err := as.DeleteAPIKey(user.ID, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.AuthenticateAPIKey(rawKey, ClientInfo{}); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("deleted key: err = %v, want %v", err, ErrInvalidAPIKey)
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"go-crud/config"
+	"go-crud/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns a migrated in-memory database, also set as config.DB
+func openTestDB(tb testing.TB) *gorm.DB {
+	tb.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", tb.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		tb.Fatal(err)
+	}
+
+	sqlDB, _ := db.DB()
+	tb.Cleanup(func() { sqlDB.Close() })
+
+	config.DB = db
+	return db
+}
@@ -4,65 +4,233 @@ import (
 	"errors"
 	"fmt"
 	"go-crud/config"
+	"go-crud/logging"
+	"go-crud/mailer"
 	"go-crud/models"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountDisabled    = errors.New("account is deactivated")
+	ErrEmailRegistered    = errors.New("email is already registered")
+)
+
+// TokenOptions are the registered claims and lifetimes of issued tokens
+type TokenOptions struct {
+	Issuer     string
+	Audience   []string // the first audience identifies this API
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Leeway     time.Duration // tolerated clock skew when validating
+
+	MFAChallengeTTL time.Duration // time to enter the second factor after the password
+}
+
+// DefaultTokenOptions issues 15 minute access tokens and 30 day sessions
+func DefaultTokenOptions() TokenOptions {
+	return TokenOptions{
+		Issuer:     "go-crud",
+		Audience:   []string{"go-crud-api"},
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 30 * 24 * time.Hour,
+		Leeway:     30 * time.Second,
+
+		MFAChallengeTTL: 5 * time.Minute,
+	}
+}
+
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UserID    uint     `json:"user_id"`
+	Username  string   `json:"username"`
+	Email     string   `json:"email"`
+	SessionID string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// HasRole reports whether the token carries role. Roles are captured when
+// the token is issued; role changes revoke the tokens of the users affected,
+// who then refresh to get the new roles.
+func (c *Claims) HasRole(role Role) bool {
+	for _, r := range c.Roles {
+		if r == string(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleProvider looks up the roles embedded into issued tokens
+type RoleProvider interface {
+	GetUserRoles(userID uint) ([]string, error)
+}
+
 type AuthService struct {
-	secretKey []byte
+	keys        *KeySet
+	options     TokenOptions
+	revocations RevocationStore
+	roles       RoleProvider
+	mailer      mailer.Mailer
+	account     AccountOptions
+	lockout     LockoutOptions
+	throttle    *loginThrottle
+	passwords   *Passwords
+	oidc        *OIDCProvider
 }
 
+// NewAuthService signs tokens with a single HS256 secret and default options
 func NewAuthService(secretKey string) *AuthService {
+	options := DefaultTokenOptions()
+	keys := NewKeySet(options.AccessTTL+options.Leeway, NewHMACKey("default", []byte(secretKey)))
+	return NewAuthServiceWithKeys(keys, options)
+}
+
+// NewAuthServiceWithKeys signs tokens with the current key of keys and
+// accepts tokens signed by any key still in the set
+func NewAuthServiceWithKeys(keys *KeySet, options TokenOptions) *AuthService {
+	lockout := DefaultLockoutOptions()
 	return &AuthService{
-		secretKey: []byte(secretKey),
+		keys:        keys,
+		options:     options,
+		revocations: NewMemoryRevocationStore(),
+		account:     DefaultAccountOptions(),
+		lockout:     lockout,
+		throttle:    newLoginThrottle(lockout.ClientMaxAttempts, lockout.ClientWindow),
+		passwords:   DefaultPasswords(),
 	}
 }
 
+// NewAuthServiceFromConfig builds the service from JWT configuration
+func NewAuthServiceFromConfig(cfg *config.JWTConfig) (*AuthService, error) {
+	keys, err := NewKeySetFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	
+	return NewAuthServiceWithKeys(keys, TokenOptions{
+		Issuer:     cfg.Issuer,
+		Audience:   cfg.Audience,
+		AccessTTL:  cfg.AccessTTL,
+		RefreshTTL: cfg.RefreshTTL,
+		Leeway:     cfg.Leeway,
+		
+		MFAChallengeTTL: cfg.MFAChallengeTTL,
+	}), nil
+}
+
+// SetRoleProvider embeds the roles returned by provider (usually the
+// RBACService) into issued tokens
+func (as *AuthService) SetRoleProvider(provider RoleProvider) {
+	as.roles = provider
+}
+
+// SetRevocationStore replaces the default in-memory revocation store, e.g.
+// with a DBRevocationStore when running several instances
+func (as *AuthService) SetRevocationStore(store RevocationStore) {
+	as.revocations = store
+}
+
+// SetPasswords replaces the default password hashing (Argon2id, accepting
+// bcrypt). Stored hashes of other algorithms or parameters are upgraded at
+// the next successful login.
+func (as *AuthService) SetPasswords(passwords *Passwords) {
+	as.passwords = passwords
+}
+
 func (as *AuthService) HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := as.passwords.Hash(password)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
-	return string(hashedPassword), nil
+	return hashedPassword, nil
 }
 
 func (as *AuthService) CheckPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	match, _, err := as.passwords.Verify(hashedPassword, password)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrInvalidCredentials
+	}
+	return nil
 }
 
-func (as *AuthService) GenerateToken(user *models.User) (string, error) {
+// rehashPassword replaces an outdated hash of user after a successful login.
+// The update only applies while the old hash is stored, so a concurrent
+// password change wins.
+func (as *AuthService) rehashPassword(user *models.User, password string) error {
+	hashedPassword, err := as.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	return config.DB.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashedPassword).Error
+}
+
+// GenerateToken issues an access token for user within session sessionID
+func (as *AuthService) GenerateToken(user *models.User, sessionID string) (string, error) {
+	tokenID, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	
+	var roles []string
+	if as.roles != nil {
+		if roles, err = as.roles.GetUserRoles(user.ID); err != nil {
+			return "", fmt.Errorf("failed to load roles: %w", err)
+		}
+	}
+	
+	// Whole milliseconds, the precision of revocation cutoffs
+	now := time.Now().Truncate(time.Millisecond)
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		SessionID: sessionID,
+		Roles:     roles,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        tokenID,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Issuer:    as.options.Issuer,
+			Audience:  as.options.Audience,
+			ExpiresAt: jwt.NewNumericDate(now.Add(as.options.AccessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 	
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(as.secretKey)
+	key, err := as.keys.Current()
+	if err != nil {
+		return "", err
+	}
+	
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
 }
 
 func (as *AuthService) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := as.keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		
+		// The algorithm is pinned by the key, never taken from the token
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return as.secretKey, nil
-	})
+		return key.verifyKey, nil
+	}, as.parserOptions()...)
 	
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -75,75 +243,231 @@ func (as *AuthService) ValidateToken(tokenString string) (*Claims, error) {
 	return nil, errors.New("invalid token")
 }
 
-func (as *AuthService) RefreshToken(tokenString string) (string, error) {
-	claims, err := as.ValidateToken(tokenString)
-	if err != nil {
-		return "", fmt.Errorf("failed to validate token: %w", err)
+// parserOptions validates exp, iat, iss and aud with the configured leeway
+func (as *AuthService) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(as.options.Leeway),
 	}
-	
-	// Check if token is close to expiry (within 1 hour)
-	if time.Until(claims.ExpiresAt.Time) > time.Hour {
-		return "", errors.New("token is not close to expiry")
+	if as.options.Issuer != "" {
+		options = append(options, jwt.WithIssuer(as.options.Issuer))
 	}
-	
-	// Generate new token with same claims but new expiry
-	user := &models.User{
-		ID:       claims.UserID,
-		Username: claims.Username,
-		Email:    claims.Email,
+	if len(as.options.Audience) > 0 {
+		options = append(options, jwt.WithAudience(as.options.Audience[0]))
+	}
+	return options
+}
+
+// JWKS returns the public signing keys for /.well-known/jwks.json
+func (as *AuthService) JWKS() JWKSet {
+	return as.keys.JWKS()
+}
+
+// IsRevoked reports whether a validated access token has been revoked
+func (as *AuthService) IsRevoked(claims *Claims) (bool, error) {
+	return as.revocations.IsRevoked(claims)
+}
+
+// RevokeToken revokes a single access token, e.g. on logout
+func (as *AuthService) RevokeToken(claims *Claims) error {
+	expiresAt := time.Now().Add(as.options.AccessTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return as.revocations.RevokeToken(claims.ID, expiresAt.Add(as.options.Leeway))
+}
+
+// RevokeUserTokens revokes every access token and session of a user. It is
+// used when the password changes or the account is deactivated.
+func (as *AuthService) RevokeUserTokens(userID uint) error {
+	if err := as.RevokeAccessTokens(userID); err != nil {
+		return err
+	}
+	return as.RevokeUserSessions(userID)
+}
+
+// RevokeAccessTokens revokes the access tokens of users but keeps their
+// sessions, so clients refresh and get tokens with the current roles. It is
+// called by the RBACService when roles change (see OnRolesChanged).
+func (as *AuthService) RevokeAccessTokens(userIDs ...uint) error {
+	until := time.Now().Add(as.options.AccessTTL + as.options.Leeway)
+	for _, userID := range userIDs {
+		if err := as.revocations.RevokeUserTokens(userID, until); err != nil {
+			return err
+		}
 	}
 	
-	return as.GenerateToken(user)
+	// The cutoff includes its whole millisecond (see revocationCutoff), so
+	// tokens issued before it has passed would be revoked as well
+	time.Sleep(time.Until(revocationCutoff(time.Now()).Add(time.Millisecond)))
+	return nil
 }
 
-func (as *AuthService) Login(email, password string) (*models.User, string, error) {
+// Authenticate verifies email and password and returns the user. Unknown
+// emails, wrong passwords and locked accounts all return
+// ErrInvalidCredentials (locked accounts wrapped in a *LockoutError) after
+// the same hashing work, and unknown emails are counted as failures with the
+// same queries as wrong passwords, so neither the error nor the response
+// time reveals whether an email is registered. ErrAccountDisabled is only returned for
+// a correct password. While an IP address exceeds its attempts for the
+// email, a *LockoutError wrapping ErrTooManyAttempts is returned. Password
+// hashes with outdated algorithms or parameters are replaced on success.
+func (as *AuthService) Authenticate(email, password string, client ClientInfo) (*models.User, error) {
+	key := throttleKey(email, client)
+	if retryAfter := as.throttle.retryAfter(key); retryAfter > 0 {
+		logging.GetLogger().LogAuthEvent("login_throttled", email, 0, false, client.IPAddress)
+		return nil, &LockoutError{Err: ErrTooManyAttempts, RetryAfter: retryAfter}
+	}
+	
 	var user models.User
 	
 	// Find user by email
 	if err := config.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, "", fmt.Errorf("invalid credentials")
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to find user: %w", err)
+		}
+		as.passwords.VerifyDummy(password)
+		as.throttle.fail(key)
+		if err := as.recordLoginFailure(email, nil, client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	
+	// The password of a locked account is not checked at all
+	if err := as.checkLockout(&user, client); err != nil {
+		as.passwords.VerifyDummy(password)
+		return nil, err
+	}
+	
+	// Verify password
+	match, rehash, err := as.passwords.Verify(user.Password, password)
+	if err != nil {
+		logging.GetLogger().WithUserID(user.ID).Error("Failed to verify password hash", map[string]interface{}{"error": err.Error()})
+	}
+	if !match {
+		as.throttle.fail(key)
+		if err := as.recordLoginFailure(email, &user, client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
 	
 	// Check if user is active
 	if !user.IsActive {
-		return nil, "", fmt.Errorf("account is deactivated")
+		return nil, ErrAccountDisabled
 	}
 	
-	// Verify password
-	if err := as.CheckPassword(user.Password, password); err != nil {
-		return nil, "", fmt.Errorf("invalid credentials")
+	as.throttle.reset(key)
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		if err := clearLockout(config.DB, user.ID); err != nil {
+			return nil, err
+		}
+		user.FailedLoginAttempts = 0
+		user.LockedUntil = nil
 	}
 	
-	// Generate token
-	token, err := as.GenerateToken(&user)
+	// An outdated hash does not fail the login
+	if rehash {
+		if err := as.rehashPassword(&user, password); err != nil {
+			logging.GetLogger().WithUserID(user.ID).Error("Failed to rehash password", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	
+	return &user, nil
+}
+
+// LoginResult is the outcome of a password login. Users with two-factor
+// authentication get an MFAChallenge to pass to VerifyMFA instead of Tokens.
+type LoginResult struct {
+	User         *models.User
+	Tokens       *TokenPair
+	MFAChallenge string
+	MFAExpiresIn int64 // challenge lifetime in seconds
+	Provisioned  bool  // the account was created by this (OIDC) login
+}
+
+func (as *AuthService) Login(email, password string, client ClientInfo) (*LoginResult, error) {
+	user, err := as.Authenticate(email, password, client)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
 	}
 	
-	return &user, token, nil
+	// The password alone is not enough when a second factor is enabled
+	mfaEnabled, err := as.MFAEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfaEnabled {
+		challenge, err := as.issueUserToken(user, PurposeMFAChallenge, as.options.MFAChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{
+			User:         user,
+			MFAChallenge: challenge,
+			MFAExpiresIn: int64(as.options.MFAChallengeTTL / time.Second),
+		}, nil
+	}
+	
+	// Start a session
+	tokens, err := as.CreateSession(user, client)
+	if err != nil {
+		return nil, err
+	}
+	
+	return &LoginResult{User: user, Tokens: tokens}, nil
 }
 
-func (as *AuthService) Register(userData *models.User) (*models.User, string, error) {
+// Register creates an active account with the DefaultRole and emails a
+// verification link. If the email is already registered no account is
+// created, the owner is notified by email instead and ErrEmailRegistered is
+// returned; callers must respond exactly as on success so registration does
+// not reveal which emails have accounts. Both outcomes cost the same hashing
+// work and send their email in the background.
+func (as *AuthService) Register(userData *models.User) (*models.User, error) {
 	// Hash password
 	hashedPassword, err := as.HashPassword(userData.Password)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to hash password: %w", err)
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	
+	var existing models.User
+	err = config.DB.Unscoped().Where("email = ?", userData.Email).First(&existing).Error
+	if err == nil {
+		if !existing.DeletedAt.Valid {
+			as.sendMailAsync("existing account", existing.ID, func() error {
+				return as.notifyExistingAccount(&existing)
+			})
+		}
+		return nil, ErrEmailRegistered
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to check email: %w", err)
 	}
+	
 	userData.Password = hashedPassword
 	
 	// Set default values
 	userData.IsActive = true
 	
-	// Create user
-	if err := config.DB.Create(userData).Error; err != nil {
-		return nil, "", fmt.Errorf("failed to create user: %w", err)
-	}
-	
-	// Generate token
-	token, err := as.GenerateToken(userData)
+	// Create the user together with its default role, so a failed role
+	// assignment leaves no account without roles behind
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(userData).Error; err != nil {
+			return err
+		}
+		return tx.Create(&UserRole{UserID: userData.ID, Role: string(DefaultRole)}).Error
+	})
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 	
-	return userData, token, nil
+	user := *userData
+	as.sendMailAsync("verification", user.ID, func() error {
+		return as.SendEmailVerification(&user)
+	})
+	
+	return userData, nil
 }
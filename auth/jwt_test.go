@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-crud/mailer"
+	"go-crud/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+type staticRoles map[uint][]string
+
+func (r staticRoles) GetUserRoles(userID uint) ([]string, error) {
+	return r[userID], nil
+}
+
+// signClaims signs claims with the current key of as
+func signClaims(t *testing.T, as *AuthService, claims *Claims) string {
+	t.Helper()
+
+	key, err := as.keys.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestGenerateTokenClaims(t *testing.T) {
+	as := NewAuthService("secret")
+	as.SetRoleProvider(staticRoles{7: {string(Admin), string(User)}})
+
+	token, err := as.GenerateToken(&models.User{ID: 7, Username: "alice"}, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := as.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultTokenOptions()
+	if claims.Subject != "7" || claims.Issuer != options.Issuer || len(claims.Audience) != 1 || claims.Audience[0] != options.Audience[0] {
+		t.Errorf("registered claims = %+v", claims.RegisteredClaims)
+	}
+	if claims.ID == "" || claims.SessionID != "session" {
+		t.Errorf("jti = %q, sid = %q", claims.ID, claims.SessionID)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != options.AccessTTL {
+		t.Errorf("lifetime = %v, want %v", lifetime, options.AccessTTL)
+	}
+	if !claims.HasRole(Admin) || !claims.HasRole(User) || claims.HasRole(Guest) {
+		t.Errorf("roles = %v, want admin and user", claims.Roles)
+	}
+}
+
+func TestValidateTokenChecksRegisteredClaims(t *testing.T) {
+	as := NewAuthService("secret")
+	options := DefaultTokenOptions()
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		edit  func(claims *jwt.RegisteredClaims)
+		valid bool
+	}{
+		{"valid", func(*jwt.RegisteredClaims) {}, true},
+		{"other audience listed too", func(c *jwt.RegisteredClaims) { c.Audience = append(jwt.ClaimStrings{"other"}, options.Audience...) }, true},
+		{"expired within the leeway", func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-options.Leeway / 2)) }, true},
+		{"expired", func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-2 * options.Leeway)) }, false},
+		{"without exp", func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil }, false},
+		{"issued in the future", func(c *jwt.RegisteredClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(2 * options.Leeway)) }, false},
+		{"other issuer", func(c *jwt.RegisteredClaims) { c.Issuer = "someone-else" }, false},
+		{"without issuer", func(c *jwt.RegisteredClaims) { c.Issuer = "" }, false},
+		{"other audience", func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"other-api"} }, false},
+		{"without audience", func(c *jwt.RegisteredClaims) { c.Audience = nil }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    options.Issuer,
+				Audience:  options.Audience,
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			}}
+			tt.edit(&claims.RegisteredClaims)
+
+			_, err := as.ValidateToken(signClaims(t, as, claims))
+			if valid := err == nil; valid != tt.valid {
+				t.Errorf("valid = %v (%v), want %v", valid, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAuthenticateErrors(t *testing.T) {
+	as, db, user := newLockoutTest(t, DefaultLockoutOptions())
+	client := ClientInfo{IPAddress: "192.0.2.1"}
+
+	if _, err := as.Authenticate("nobody@example.com", "Sup3r-secret", client); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown email: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := as.Authenticate(user.Email, "wrong", client); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	// Only the right password learns that the account is deactivated
+	db.Model(user).Update("is_active", false)
+	if _, err := as.Authenticate(user.Email, "wrong", client); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("deactivated, wrong password: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := as.Authenticate(user.Email, "Sup3r-secret", client); !errors.Is(err, ErrAccountDisabled) {
+		t.Errorf("deactivated, right password: err = %v, want %v", err, ErrAccountDisabled)
+	}
+}
+
+func TestRegisterTakenEmail(t *testing.T) {
+	as, db, user := newSessionTest(t)
+	m := mailer.NewMemoryMailer("noreply@example.com")
+	as.SetMailer(m, DefaultAccountOptions())
+
+	if _, err := as.Register(&models.User{Username: "alice2", Email: user.Email, Password: "Sup3r-secret"}); !errors.Is(err, ErrEmailRegistered) {
+		t.Fatalf("err = %v, want %v", err, ErrEmailRegistered)
+	}
+	waitForMessages(t, m, 1)
+	if msg, _ := m.Last(user.Email); msg.Subject != "You already have an account" {
+		t.Errorf("notice = %q", msg.Subject)
+	}
+
+	// The email of a deleted account stays taken, but nobody is notified
+	db.Delete(user)
+	if _, err := as.Register(&models.User{Username: "alice3", Email: user.Email, Password: "Sup3r-secret"}); !errors.Is(err, ErrEmailRegistered) {
+		t.Errorf("deleted account: err = %v, want %v", err, ErrEmailRegistered)
+	}
+
+	created, err := as.Register(&models.User{Username: "bob", Email: "bob@example.com", Password: "Sup3r-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created.IsActive || created.Password == "Sup3r-secret" {
+		t.Errorf("created user = %+v", created)
+	}
+	waitForMessages(t, m, 2)
+	if msg, _ := m.Last("bob@example.com"); msg.Subject != "Verify your email address" {
+		t.Errorf("email to the new user = %q", msg.Subject)
+	}
+	if n := len(m.Messages()); n != 2 {
+		t.Errorf("sent %d emails, want 2", n)
+	}
+}
+
+// countingHasher stores passwords in the clear and counts verifications
+type countingHasher struct {
+	verifies int
+}
+
+func (h *countingHasher) Hash(password string) (string, error) {
+	return "$plain$" + password, nil
+}
+
+func (h *countingHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$plain$")
+}
+
+func (h *countingHasher) Verify(encoded, password string) (bool, error) {
+	h.verifies++
+	return encoded == "$plain$"+password, nil
+}
+
+func (h *countingHasher) NeedsRehash(encoded string) bool {
+	return false
+}
+
+func TestAuthenticateFailuresTakeTheSamePath(t *testing.T) {
+	db := openTestDB(t)
+
+	hasher := &countingHasher{}
+	as := NewAuthService("secret")
+	as.SetPasswords(NewPasswords(hasher))
+	as.SetLockoutOptions(LockoutOptions{MaxAttempts: 3, BaseLockout: time.Minute, MaxLockout: time.Hour})
+
+	lockedUntil := time.Now().Add(time.Hour)
+	users := []models.User{
+		{Username: "alice", Email: "alice@example.com", Password: "$plain$correct", IsActive: true},
+		{Username: "bob", Email: "bob@example.com", Password: "$plain$correct", IsActive: true, FailedLoginAttempts: 2},
+		{Username: "carol", Email: "carol@example.com", Password: "$plain$correct", IsActive: true, FailedLoginAttempts: 3, LockedUntil: &lockedUntil},
+	}
+	for i := range users {
+		if err := db.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{"unknown email", "nobody@example.com", "correct"},
+		{"wrong password", "alice@example.com", "wrong"},
+		{"wrong password locking the account", "bob@example.com", "wrong"},
+		{"locked account, wrong password", "carol@example.com", "wrong"},
+		{"locked account, correct password", "carol@example.com", "correct"},
+	}
+
+	// Count the queries and writes of every attempt
+	var statements []string
+	count := func(kind string) func(*gorm.DB) {
+		return func(*gorm.DB) { statements = append(statements, kind) }
+	}
+	db.Callback().Query().After("gorm:query").Register("test:count_query", count("query"))
+	db.Callback().Update().After("gorm:update").Register("test:count_update", count("update"))
+	perAttempt := make(map[string][]string)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher.verifies = 0
+			statements = nil
+
+			user, err := as.Authenticate(tt.email, tt.password, ClientInfo{IPAddress: "192.0.2.1"})
+			if user != nil || !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate = %v, %v, want %v", user, err, ErrInvalidCredentials)
+			}
+			if hasher.verifies != 1 {
+				t.Errorf("password verified %d times, want 1", hasher.verifies)
+			}
+			perAttempt[tt.name] = statements
+		})
+	}
+
+	if unknown, wrong := perAttempt["unknown email"], perAttempt["wrong password"]; strings.Join(unknown, ",") != strings.Join(wrong, ",") {
+		t.Errorf("unknown email ran %v, wrong password ran %v", unknown, wrong)
+	}
+}
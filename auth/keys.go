@@ -0,0 +1,409 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-crud/config"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// JWKSMaxAge is how long clients may cache the JWKS. Rotated keys are
+// published this long before they start signing, so verifiers holding a
+// cached JWKS already know the key of every token they receive.
+const JWKSMaxAge = 5 * time.Minute
+
+// SigningKey is a JWT signing key identified by its kid. Asymmetric keys
+// (RS*, ES*, EdDSA) publish their public half in the JWKS.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	NotBefore time.Time // when the key starts signing new tokens
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey returns an HS256 key for a shared secret
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// NewSigningKey wraps an RSA, ECDSA or Ed25519 private key for the given
+// algorithm, e.g. "RS256", "ES256" or "EdDSA"
+func NewSigningKey(id, alg string, private crypto.Signer) (*SigningKey, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	var ok bool
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = private.(*rsa.PrivateKey)
+	case *jwt.SigningMethodECDSA:
+		_, ok = private.(*ecdsa.PrivateKey)
+	case *jwt.SigningMethodEd25519:
+		_, ok = private.(ed25519.PrivateKey)
+	}
+	if !ok {
+		return nil, fmt.Errorf("key of type %T cannot be used for %s", private, alg)
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    method,
+		signKey:   private,
+		verifyKey: private.Public(),
+	}, nil
+}
+
+// GenerateSigningKey creates a new random key for alg with a random kid
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+
+	var private crypto.Signer
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		private, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("cannot generate keys for %q", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", alg, err)
+	}
+
+	return NewSigningKey(id, alg, private)
+}
+
+// ParseSigningKeyPEM reads a PEM encoded private key for alg
+func ParseSigningKeyPEM(id, alg string, data []byte) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		private, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case *jwt.SigningMethodECDSA:
+		private, err = jwt.ParseECPrivateKeyFromPEM(data)
+	case *jwt.SigningMethodEd25519:
+		var key crypto.PrivateKey
+		key, err = jwt.ParseEdPrivateKeyFromPEM(data)
+		if err == nil {
+			private, _ = key.(crypto.Signer)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s private key: %w", alg, err)
+	}
+
+	return NewSigningKey(id, alg, private)
+}
+
+// KeySet holds the signing keys of the service. The newest key whose
+// NotBefore has passed signs new tokens; older keys keep verifying tokens
+// for retention after their successor took over, so rotation never
+// invalidates tokens that are still within their lifetime.
+type KeySet struct {
+	mu        sync.RWMutex
+	keys      []*SigningKey // ordered by NotBefore
+	retention time.Duration
+}
+
+func NewKeySet(retention time.Duration, keys ...*SigningKey) *KeySet {
+	ks := &KeySet{retention: retention}
+	for _, key := range keys {
+		ks.Add(key)
+	}
+	return ks
+}
+
+// Add adds key to the set. A key with a NotBefore in the future is scheduled:
+// it is published in the JWKS right away but only signs from NotBefore on.
+func (ks *KeySet) Add(key *SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key.NotBefore.IsZero() {
+		key.NotBefore = time.Now()
+	}
+
+	ks.keys = append(ks.keys, key)
+	sort.SliceStable(ks.keys, func(i, j int) bool {
+		return ks.keys[i].NotBefore.Before(ks.keys[j].NotBefore)
+	})
+	ks.prune(time.Now())
+}
+
+// Current returns the key new tokens are signed with
+func (ks *KeySet) Current() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if !ks.keys[i].NotBefore.After(now) {
+			return ks.keys[i], nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+// Lookup returns the key with the given kid if it may still verify tokens
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	for i, key := range ks.keys {
+		if key.ID != kid {
+			continue
+		}
+		if ks.expired(i, now) {
+			return nil, false
+		}
+		return key, true
+	}
+	return nil, false
+}
+
+// StartRotation generates a new alg key every interval. Generated keys only
+// live in this process, so instances behind a load balancer should share
+// keys loaded from files instead.
+func (ks *KeySet) StartRotation(interval time.Duration, alg string) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ks.rotate(alg)
+		}
+	}()
+}
+
+// rotate schedules a new alg key. It is published in the JWKS at once but
+// only signs after JWKSMaxAge, when cached copies of the JWKS without it
+// have expired. The key it replaces keeps verifying for retention after that.
+func (ks *KeySet) rotate(alg string) (*SigningKey, error) {
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	key.NotBefore = time.Now().Add(JWKSMaxAge)
+	ks.Add(key)
+	return key, nil
+}
+
+// expired reports whether the key at index i was replaced by an active
+// successor more than retention ago
+func (ks *KeySet) expired(i int, now time.Time) bool {
+	if i+1 >= len(ks.keys) || ks.keys[i+1].NotBefore.After(now) {
+		return false
+	}
+	return now.After(ks.keys[i+1].NotBefore.Add(ks.retention))
+}
+
+// prune drops keys that can no longer verify any token
+func (ks *KeySet) prune(now time.Time) {
+	var kept []*SigningKey
+	for i, key := range ks.keys {
+		if !ks.expired(i, now) {
+			kept = append(kept, key)
+		}
+	}
+	ks.keys = kept
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. Shared HMAC secrets are never
+// published.
+func (ks *KeySet) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	now := time.Now()
+	for i, key := range ks.keys {
+		if ks.expired(i, now) {
+			continue
+		}
+		if jwk, ok := key.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (key *SigningKey) jwk() (JWK, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+	switch public := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		point, err := public.ECDH()
+		if err != nil {
+			return JWK{}, false
+		}
+		// Uncompressed point: 0x04 || X || Y
+		raw := point.Bytes()[1:]
+		size := len(raw) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = public.Curve.Params().Name
+		jwk.X = encode(raw[:size])
+		jwk.Y = encode(raw[size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encode(public)
+	default:
+		return JWK{}, false
+	}
+
+	return jwk, true
+}
+
+// PublicKey decodes the key, e.g. one published by an OIDC provider
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decode(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, errX := decode(jwk.X)
+		y, errY := decode(jwk.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid EC point")
+		}
+		public := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := public.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC point: %w", err)
+		}
+		return public, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// NewKeySetFromConfig builds the key set described by cfg. Replaced keys
+// are kept for as long as tokens they signed can be accepted.
+func NewKeySetFromConfig(cfg *config.JWTConfig) (*KeySet, error) {
+	ks := NewKeySet(cfg.AccessTTL + cfg.Leeway)
+
+	if cfg.Algorithm == "" || cfg.Algorithm == jwt.SigningMethodHS256.Alg() {
+		if cfg.Secret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		ks.Add(NewHMACKey("default", []byte(cfg.Secret)))
+		return ks, nil
+	}
+
+	if len(cfg.PrivateKeyFiles) == 0 {
+		key, err := GenerateSigningKey(cfg.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		ks.Add(key)
+
+		if cfg.RotationInterval > 0 {
+			ks.StartRotation(cfg.RotationInterval, cfg.Algorithm)
+		}
+		return ks, nil
+	}
+
+	for _, file := range cfg.PrivateKeyFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+
+		id := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		key, err := ParseSigningKeyPEM(id, cfg.Algorithm, data)
+		if err != nil {
+			return nil, err
+		}
+		ks.Add(key)
+	}
+
+	return ks, nil
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"go-crud/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func jwksKids(ks *KeySet) map[string]bool {
+	kids := map[string]bool{}
+	for _, jwk := range ks.JWKS().Keys {
+		kids[jwk.Kid] = true
+	}
+	return kids
+}
+
+func TestSignAndVerifyWithEachAlgorithm(t *testing.T) {
+	user := &models.User{ID: 7, Username: "alice", Email: "alice@example.com"}
+
+	for _, alg := range []string{"RS256", "PS256", "ES256", "ES384", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateSigningKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			as := NewAuthServiceWithKeys(NewKeySet(time.Hour, key), DefaultTokenOptions())
+
+			token, err := as.GenerateToken(user, "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != alg {
+				t.Errorf("header = %v, want kid %s and alg %s", parsed.Header, key.ID, alg)
+			}
+
+			claims, err := as.ValidateToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != user.ID || claims.SessionID != "session" {
+				t.Errorf("claims = %+v", claims)
+			}
+
+			// Another key with the same algorithm must not verify the token
+			other, _ := GenerateSigningKey(alg)
+			other.ID = key.ID
+			if _, err := NewAuthServiceWithKeys(NewKeySet(time.Hour, other), DefaultTokenOptions()).ValidateToken(token); err == nil {
+				t.Error("token verified with a different key")
+			}
+		})
+	}
+}
+
+func TestValidateTokenPinsTheAlgorithm(t *testing.T) {
+	key, err := GenerateSigningKey("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultTokenOptions()
+	as := NewAuthServiceWithKeys(NewKeySet(time.Hour, key), options)
+	claims := &Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    options.Issuer,
+		Audience:  options.Audience,
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+
+	// The same claims signed properly are accepted
+	valid := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	valid.Header["kid"] = key.ID
+	validToken, err := valid.SignedString(key.signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.ValidateToken(validToken); err != nil {
+		t.Fatalf("properly signed token: %v", err)
+	}
+
+	// HS256 signed with the public key, the classic algorithm confusion attack
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, key.verifyKey)})
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	confused.Header["kid"] = key.ID
+	confusedToken, err := confused.SignedString(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	unsigned.Header["kid"] = key.ID
+	unsignedToken, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	unknown.Header["kid"] = "unknown"
+	unknownToken, err := unknown.SignedString(key.signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{"HS256 with the public key": confusedToken, "alg none": unsignedToken, "unknown kid": unknownToken} {
+		if _, err := as.ValidateToken(token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestOldKeysVerifyAfterRotation(t *testing.T) {
+	old, _ := GenerateSigningKey("ES256")
+	ks := NewKeySet(time.Hour, old)
+	as := NewAuthServiceWithKeys(ks, DefaultTokenOptions())
+
+	token, err := as.GenerateToken(&models.User{ID: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, _ := GenerateSigningKey("ES256")
+	ks.Add(next)
+
+	if current, _ := ks.Current(); current != next {
+		t.Errorf("Current() = %s, want the new key %s", current.ID, next.ID)
+	}
+	if _, err := as.ValidateToken(token); err != nil {
+		t.Errorf("token of the rotated key: %v", err)
+	}
+	if kids := jwksKids(ks); !kids[old.ID] || !kids[next.ID] {
+		t.Errorf("JWKS = %v, want both %s and %s", kids, old.ID, next.ID)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := GenerateSigningKey("RS256")
+	ecKey, _ := GenerateSigningKey("ES256")
+	edKey, _ := GenerateSigningKey("EdDSA")
+	ks := NewKeySet(time.Hour, NewHMACKey("shared", []byte("secret")), rsaKey, ecKey, edKey)
+
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("JWKS has %d keys, want the 3 asymmetric ones", len(jwks.Keys))
+	}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "sig" {
+			t.Errorf("%s: use = %q", jwk.Kid, jwk.Use)
+		}
+		switch jwk.Kid {
+		case rsaKey.ID:
+			public := rsaKey.verifyKey.(*rsa.PublicKey)
+			n := new(big.Int).SetBytes(decode(jwk.N))
+			e := new(big.Int).SetBytes(decode(jwk.E))
+			if jwk.Kty != "RSA" || jwk.Alg != "RS256" || n.Cmp(public.N) != 0 || e.Int64() != int64(public.E) {
+				t.Errorf("RSA JWK = %+v does not match the key", jwk)
+			}
+		case ecKey.ID:
+			public := ecKey.verifyKey.(*ecdsa.PublicKey)
+			x := new(big.Int).SetBytes(decode(jwk.X))
+			y := new(big.Int).SetBytes(decode(jwk.Y))
+			if jwk.Kty != "EC" || jwk.Crv != "P-256" || x.Cmp(public.X) != 0 || y.Cmp(public.Y) != 0 {
+				t.Errorf("EC JWK = %+v does not match the key", jwk)
+			}
+			if !elliptic.P256().IsOnCurve(x, y) {
+				t.Error("EC JWK point is not on P-256")
+			}
+		case edKey.ID:
+			if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || !edKey.verifyKey.(ed25519.PublicKey).Equal(ed25519.PublicKey(decode(jwk.X))) {
+				t.Errorf("Ed25519 JWK = %+v does not match the key", jwk)
+			}
+		default:
+			t.Errorf("unexpected key %s in the JWKS", jwk.Kid)
+		}
+	}
+}
+
+func TestParseSigningKeyPEM(t *testing.T) {
+	key, _ := GenerateSigningKey("ES256")
+	der, err := x509.MarshalECPrivateKey(key.signKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	parsed, err := ParseSigningKeyPEM("k1", "ES256", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.ID != "k1" || !parsed.verifyKey.(*ecdsa.PublicKey).Equal(key.verifyKey) {
+		t.Errorf("parsed key %s does not match", parsed.ID)
+	}
+
+	if _, err := ParseSigningKeyPEM("k1", "RS256", data); err == nil {
+		t.Error("EC key parsed for RS256")
+	}
+	if _, err := ParseSigningKeyPEM("k1", "HS256", data); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("HS256: err = %v, want unsupported algorithm", err)
+	}
+}
+
+func mustMarshalPKIX(t *testing.T, public interface{}) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestKeyRotationPublishesAhead(t *testing.T) {
+	current, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := NewKeySet(15*time.Minute, current)
+
+	next, err := ks.rotate("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wait := time.Until(next.NotBefore); wait < JWKSMaxAge-time.Second {
+		t.Errorf("next key signs in %v, want at least the JWKS max-age %v", wait, JWKSMaxAge)
+	}
+	if signer, _ := ks.Current(); signer != current {
+		t.Errorf("Current() = %s, want %s until the next key is due", signer.ID, current.ID)
+	}
+	if kids := jwksKids(ks); !kids[current.ID] || !kids[next.ID] {
+		t.Errorf("JWKS = %v, want both %s and %s", kids, current.ID, next.ID)
+	}
+}
+
+func TestRetiredKeysStayPublished(t *testing.T) {
+	const retention = 15 * time.Minute
+
+	tests := []struct {
+		name      string
+		retiredAt time.Duration // how long ago the successor started signing
+		published bool
+	}{
+		{"just retired", time.Second, true},
+		{"tokens still valid", retention - time.Minute, true},
+		{"every token expired", retention + time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, _ := GenerateSigningKey("ES256")
+			successor, _ := GenerateSigningKey("ES256")
+			old.NotBefore = time.Now().Add(-24 * time.Hour)
+			successor.NotBefore = time.Now().Add(-tt.retiredAt)
+
+			ks := NewKeySet(retention, old)
+			ks.keys = append(ks.keys, successor) // Add would prune old right away
+
+			if published := jwksKids(ks)[old.ID]; published != tt.published {
+				t.Errorf("old key published = %v, want %v", published, tt.published)
+			}
+			if _, ok := ks.Lookup(old.ID); ok != tt.published {
+				t.Errorf("old key verifies = %v, want %v", ok, tt.published)
+			}
+			if signer, _ := ks.Current(); signer != successor {
+				t.Errorf("Current() = %s, want the successor", signer.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/config"
+	"go-crud/logging"
+	"go-crud/models"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAccountLocked is an ErrInvalidCredentials, so a locked account is
+	// indistinguishable from a wrong password
+	ErrAccountLocked    = fmt.Errorf("%w: account is temporarily locked", ErrInvalidCredentials)
+	ErrTooManyAttempts  = errors.New("too many failed login attempts")
+	ErrAccountNotLocked = errors.New("account is not locked")
+)
+
+// LockoutError is returned by Authenticate while logins are refused. It
+// wraps ErrAccountLocked or ErrTooManyAttempts.
+type LockoutError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LockoutError) Unwrap() error {
+	return e.Err
+}
+
+// LockoutOptions configures brute-force protection of password login.
+// Accounts are locked after MaxAttempts consecutive failures, for
+// BaseLockout doubled by every further failure up to MaxLockout, until a
+// successful login, a password reset or an administrator unlocks them.
+// Independently, ClientMaxAttempts failures for one email from one IP
+// address within ClientWindow pause that pair without locking the account.
+type LockoutOptions struct {
+	MaxAttempts int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+
+	ClientMaxAttempts int
+	ClientWindow      time.Duration
+}
+
+// DefaultLockoutOptions locks accounts for 1 minute after 5 failures, and
+// pauses an IP address after 10 failures for an email within 15 minutes
+func DefaultLockoutOptions() LockoutOptions {
+	return LockoutOptions{
+		MaxAttempts:       5,
+		BaseLockout:       time.Minute,
+		MaxLockout:        time.Hour,
+		ClientMaxAttempts: 10,
+		ClientWindow:      15 * time.Minute,
+	}
+}
+
+// LockoutOptionsFromConfig returns the lockout options of cfg
+func LockoutOptionsFromConfig(cfg *config.LockoutConfig) LockoutOptions {
+	return LockoutOptions{
+		MaxAttempts:       cfg.MaxAttempts,
+		BaseLockout:       cfg.BaseLockout,
+		MaxLockout:        cfg.MaxLockout,
+		ClientMaxAttempts: cfg.ClientMaxAttempts,
+		ClientWindow:      cfg.ClientWindow,
+	}
+}
+
+// SetLockoutOptions replaces the default brute-force protection settings
+func (as *AuthService) SetLockoutOptions(options LockoutOptions) {
+	as.lockout = options
+	as.throttle = newLoginThrottle(options.ClientMaxAttempts, options.ClientWindow)
+}
+
+// UnlockAccount clears the failed login attempts and lockout of a user
+func (as *AuthService) UnlockAccount(userID uint, client ClientInfo) error {
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return ErrAccountNotLocked
+	}
+
+	if err := clearLockout(config.DB, user.ID); err != nil {
+		return err
+	}
+	as.throttle.resetEmail(user.Email)
+
+	logging.GetLogger().LogAuthEvent("account_unlocked", user.Username, user.ID, true, client.IPAddress)
+	return nil
+}
+
+// checkLockout refuses logins while the account is locked
+func (as *AuthService) checkLockout(user *models.User, client ClientInfo) error {
+	if user.LockedUntil == nil {
+		return nil
+	}
+	retryAfter := time.Until(*user.LockedUntil)
+	if retryAfter <= 0 {
+		return nil
+	}
+
+	logging.GetLogger().LogAuthEvent("login_locked", user.Username, user.ID, false, client.IPAddress)
+	return &LockoutError{Err: ErrAccountLocked, RetryAfter: retryAfter}
+}
+
+// recordLoginFailure counts a failed password for the account registered
+// with email and locks it once MaxAttempts is reached. user is nil for
+// unknown emails: the same queries then run without matching a row, so a
+// failed login costs the same database work whether or not the email is
+// registered. It returns a LockoutError when this failure locked the account.
+func (as *AuthService) recordLoginFailure(email string, user *models.User, client ClientInfo) error {
+	err := config.DB.Model(&models.User{}).
+		Where("email = ?", email).
+		Update("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	var failures int
+	err = config.DB.Model(&models.User{}).
+		Where("email = ?", email).
+		Pluck("failed_login_attempts", &failures).Error
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+	if user == nil {
+		return nil
+	}
+
+	logging.GetLogger().LogAuthEvent("login_failed", user.Username, user.ID, false, client.IPAddress)
+
+	if as.lockout.MaxAttempts <= 0 || failures < as.lockout.MaxAttempts {
+		return nil
+	}
+
+	lockout := as.lockoutDuration(failures)
+	lockedUntil := time.Now().Add(lockout)
+	if err := config.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("locked_until", &lockedUntil).Error; err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+
+	logging.GetLogger().WithFields(map[string]interface{}{
+		"failed_attempts": failures,
+		"locked_until":    lockedUntil.UTC().Format(time.RFC3339),
+	}).LogAuthEvent("account_locked", user.Username, user.ID, false, client.IPAddress)
+
+	return &LockoutError{Err: ErrAccountLocked, RetryAfter: lockout}
+}
+
+// lockoutDuration doubles BaseLockout for every failure past MaxAttempts
+func (as *AuthService) lockoutDuration(failures int) time.Duration {
+	lockout := as.lockout.BaseLockout
+	for i := as.lockout.MaxAttempts; i < failures && lockout < as.lockout.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if as.lockout.MaxLockout > 0 && lockout > as.lockout.MaxLockout {
+		lockout = as.lockout.MaxLockout
+	}
+	return lockout
+}
+
+func clearLockout(db *gorm.DB, userID uint) error {
+	err := db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to clear lockout: %w", err)
+	}
+	return nil
+}
+
+// loginThrottle counts failed logins per IP address and email in process
+// memory
+type loginThrottle struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	limit    int
+	window   time.Duration
+}
+
+func newLoginThrottle(limit int, window time.Duration) *loginThrottle {
+	t := &loginThrottle{
+		failures: make(map[string][]time.Time),
+		limit:    limit,
+		window:   window,
+	}
+
+	if limit > 0 && window > 0 {
+		// Start cleanup goroutine
+		go t.cleanup()
+	}
+
+	return t
+}
+
+func throttleKey(email string, client ClientInfo) string {
+	return client.IPAddress + "|" + strings.ToLower(email)
+}
+
+// retryAfter returns how long the key has to wait, or 0 if it may log in
+func (t *loginThrottle) retryAfter(key string) time.Duration {
+	if t.limit <= 0 || t.window <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failures := t.recent(key, time.Now())
+	if len(failures) < t.limit {
+		return 0
+	}
+	return time.Until(failures[len(failures)-t.limit].Add(t.window))
+}
+
+func (t *loginThrottle) fail(key string) {
+	if t.limit <= 0 || t.window <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.failures[key] = append(t.recent(key, now), now)
+}
+
+func (t *loginThrottle) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.failures, key)
+}
+
+// resetEmail forgets the failures for email from every IP address
+func (t *loginThrottle) resetEmail(email string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	suffix := "|" + strings.ToLower(email)
+	for key := range t.failures {
+		if strings.HasSuffix(key, suffix) {
+			delete(t.failures, key)
+		}
+	}
+}
+
+// recent drops failures outside the window; the caller holds the lock
+func (t *loginThrottle) recent(key string, now time.Time) []time.Time {
+	cutoff := now.Add(-t.window)
+	failures := t.failures[key]
+
+	i := 0
+	for i < len(failures) && !failures[i].After(cutoff) {
+		i++
+	}
+	failures = failures[i:]
+
+	if len(failures) == 0 {
+		delete(t.failures, key)
+	} else {
+		t.failures[key] = failures
+	}
+	return failures
+}
+
+func (t *loginThrottle) cleanup() {
+	ticker := time.NewTicker(t.window)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		t.mu.Lock()
+		now := time.Now()
+		for key := range t.failures {
+			t.recent(key, now)
+		}
+		t.mu.Unlock()
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-crud/models"
+
+	"gorm.io/gorm"
+)
+
+// newLockoutTest returns an auth service with options and a user whose
+// password is "Sup3r-secret"
+func newLockoutTest(t *testing.T, options LockoutOptions) (*AuthService, *gorm.DB, *models.User) {
+	t.Helper()
+
+	as, db, user := newSessionTest(t)
+	as.SetLockoutOptions(options)
+
+	hashed, err := as.HashPassword("Sup3r-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(user).Update("password", hashed).Error; err != nil {
+		t.Fatal(err)
+	}
+	return as, db, user
+}
+
+// expireLockout ends the lockout of user as if its time had passed
+func expireLockout(t *testing.T, db *gorm.DB, user *models.User) {
+	t.Helper()
+
+	if err := db.Model(user).Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	as, db, user := newLockoutTest(t, LockoutOptions{MaxAttempts: 3, BaseLockout: time.Minute, MaxLockout: 3 * time.Minute})
+	client := ClientInfo{IPAddress: "192.0.2.1"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := as.Authenticate(user.Email, "wrong", client); err == nil || errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("failure %d: err = %v, want invalid credentials", i+1, err)
+		}
+	}
+
+	// Each failure past the limit doubles the lockout, up to MaxLockout
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		var lockout *LockoutError
+		if _, err := as.Authenticate(user.Email, "wrong", client); !errors.As(err, &lockout) || !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("failure %d: err = %v, want a lockout", i+3, err)
+		}
+		if lockout.RetryAfter != want {
+			t.Errorf("failure %d: RetryAfter = %v, want %v", i+3, lockout.RetryAfter, want)
+		}
+
+		// The right password does not help while locked
+		if _, err := as.Authenticate(user.Email, "Sup3r-secret", client); !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("right password while locked: err = %v, want %v", err, ErrAccountLocked)
+		}
+		expireLockout(t, db, user)
+	}
+
+	if _, err := as.Authenticate(user.Email, "Sup3r-secret", client); err != nil {
+		t.Fatalf("after the lockout: %v", err)
+	}
+	var stored models.User
+	db.First(&stored, user.ID)
+	if stored.FailedLoginAttempts != 0 || stored.LockedUntil != nil {
+		t.Errorf("after a successful login: failed_login_attempts = %d, locked_until = %v", stored.FailedLoginAttempts, stored.LockedUntil)
+	}
+}
+
+func TestUnlockAccount(t *testing.T) {
+	as, _, user := newLockoutTest(t, LockoutOptions{MaxAttempts: 1, BaseLockout: time.Hour, MaxLockout: time.Hour})
+
+	if err := as.UnlockAccount(user.ID, ClientInfo{}); !errors.Is(err, ErrAccountNotLocked) {
+		t.Errorf("unlock before any failure: err = %v, want %v", err, ErrAccountNotLocked)
+	}
+	if _, err := as.Authenticate(user.Email, "wrong", ClientInfo{}); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("err = %v, want %v", err, ErrAccountLocked)
+	}
+
+	if err := as.UnlockAccount(user.ID, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.Authenticate(user.Email, "Sup3r-secret", ClientInfo{}); err != nil {
+		t.Errorf("after unlock: %v", err)
+	}
+	if err := as.UnlockAccount(0, ClientInfo{}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("unknown user: err = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func TestClientThrottle(t *testing.T) {
+	as, db, user := newLockoutTest(t, LockoutOptions{ClientMaxAttempts: 2, ClientWindow: time.Minute})
+	attacker := ClientInfo{IPAddress: "192.0.2.1"}
+
+	for _, email := range []string{user.Email, "nobody@example.com"} {
+		for i := 0; i < 2; i++ {
+			if _, err := as.Authenticate(email, "wrong", attacker); err == nil || errors.Is(err, ErrTooManyAttempts) {
+				t.Fatalf("%s failure %d: err = %v, want invalid credentials", email, i+1, err)
+			}
+		}
+
+		var lockout *LockoutError
+		if _, err := as.Authenticate(email, "Sup3r-secret", attacker); !errors.As(err, &lockout) || !errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("%s after the limit: err = %v, want %v", email, err, ErrTooManyAttempts)
+		}
+		if lockout.RetryAfter <= 0 || lockout.RetryAfter > time.Minute {
+			t.Errorf("%s: RetryAfter = %v", email, lockout.RetryAfter)
+		}
+	}
+
+	// Other addresses are not affected and the account itself is not locked
+	if _, err := as.Authenticate(user.Email, "Sup3r-secret", ClientInfo{IPAddress: "198.51.100.7"}); err != nil {
+		t.Errorf("other IP address: %v", err)
+	}
+	var stored models.User
+	db.First(&stored, user.ID)
+	if stored.LockedUntil != nil {
+		t.Errorf("account locked until %v by the client throttle", stored.LockedUntil)
+	}
+}
+
+func TestLoginThrottleWindow(t *testing.T) {
+	throttle := newLoginThrottle(2, time.Minute)
+	key := throttleKey("Alice@Example.com", ClientInfo{IPAddress: "192.0.2.1"})
+
+	// Failures that left the window no longer count
+	throttle.failures[key] = []time.Time{time.Now().Add(-2 * time.Minute), time.Now().Add(-30 * time.Second)}
+	if wait := throttle.retryAfter(key); wait != 0 {
+		t.Errorf("one recent failure: retryAfter = %v, want 0", wait)
+	}
+
+	throttle.fail(key)
+	if wait := throttle.retryAfter(key); wait <= 0 || wait > 30*time.Second {
+		t.Errorf("two recent failures: retryAfter = %v, want until the older one leaves the window", wait)
+	}
+
+	throttle.resetEmail("alice@example.com")
+	if wait := throttle.retryAfter(key); wait != 0 {
+		t.Errorf("after resetEmail: retryAfter = %v, want 0", wait)
+	}
+}
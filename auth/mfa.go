@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/config"
+	"go-crud/logging"
+	"go-crud/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled      = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge")
+	ErrMFALocked           = errors.New("too many invalid two-factor codes")
+)
+
+const (
+	recoveryCodeCount = 10
+	maxMFAAttempts    = 5 // codes tried per MFA challenge
+)
+
+// TOTPEnrollment is the secret a user adds to an authenticator app
+type TOTPEnrollment struct {
+	Secret string
+	URI    string // otpauth:// URI for QR codes
+}
+
+// MFAEnabled reports whether the user has a confirmed authenticator
+func (as *AuthService) MFAEnabled(userID uint) (bool, error) {
+	var count int64
+	err := config.DB.Model(&models.UserMFA{}).
+		Where("user_id = ? AND enabled = ?", userID, true).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check two-factor authentication: %w", err)
+	}
+	return count > 0, nil
+}
+
+// EnrollTOTP generates a new TOTP secret for user. Two-factor authentication
+// stays disabled until the secret is confirmed with ConfirmTOTP; enrolling
+// again replaces an unconfirmed secret.
+func (as *AuthService) EnrollTOTP(user *models.User) (*TOTPEnrollment, error) {
+	var mfa models.UserMFA
+	if err := config.DB.Where("user_id = ?", user.ID).First(&mfa).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load two-factor authentication: %w", err)
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	mfa.UserID = user.ID
+	mfa.Secret = secret
+	mfa.LastCounter = 0
+	if err := config.DB.Save(&mfa).Error; err != nil {
+		return nil, fmt.Errorf("failed to save two-factor authentication: %w", err)
+	}
+
+	issuer := as.options.Issuer
+	if issuer == "" {
+		issuer = DefaultTokenOptions().Issuer
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    TOTPURI(issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once code proves the
+// authenticator was set up, and returns the user's recovery codes. The codes
+// are only stored hashed, so this is the only time they can be shown.
+func (as *AuthService) ConfirmTOTP(userID uint, code string) ([]string, error) {
+	var mfa models.UserMFA
+	if err := config.DB.Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, fmt.Errorf("failed to load two-factor authentication: %w", err)
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	ok, err := useTOTP(config.DB, &mfa, normalizeMFACode(code))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	var codes []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&mfa).Updates(map[string]interface{}{
+			"enabled":      true,
+			"confirmed_at": &now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	logging.GetLogger().LogAuthEvent("mfa_enabled", "", userID, true, "")
+	return codes, nil
+}
+
+// DisableTOTP removes the authenticator and recovery codes of a user after
+// checking a current TOTP or recovery code (see checkManagementCode)
+func (as *AuthService) DisableTOTP(userID uint, code string) error {
+	if err := as.checkManagementCode(userID, code); err != nil {
+		return err
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+
+	logging.GetLogger().LogAuthEvent("mfa_disabled", "", userID, true, "")
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user after
+// checking a current TOTP or recovery code (see checkManagementCode)
+func (as *AuthService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if err := as.checkManagementCode(userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// VerifyMFA completes a login: the challenge returned by Login is exchanged,
+// together with a TOTP or recovery code, for a token pair. A challenge
+// allows maxMFAAttempts codes and can only be completed once.
+func (as *AuthService) VerifyMFA(challenge, code string, client ClientInfo) (*models.User, *TokenPair, error) {
+	var userToken models.UserToken
+	if err := config.DB.Where("token_hash = ? AND purpose = ?", hashToken(challenge), PurposeMFAChallenge).First(&userToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidMFAChallenge
+		}
+		return nil, nil, err
+	}
+	if time.Now().After(userToken.ExpiresAt) {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	// Count the attempt before checking the code, so concurrent guesses
+	// cannot exceed the limit
+	result := config.DB.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL AND attempts < ?", userToken.ID, maxMFAAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	ok, err := as.verifySecondFactor(userToken.UserID, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		logging.GetLogger().LogAuthEvent("mfa_verify", "", userToken.UserID, false, client.IPAddress)
+		return nil, nil, ErrInvalidMFACode
+	}
+
+	if _, err := consumeUserToken(config.DB, PurposeMFAChallenge, challenge); err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			return nil, nil, ErrInvalidMFAChallenge
+		}
+		return nil, nil, err
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userToken.UserID).Error; err != nil || !user.IsActive {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	tokens, err := as.CreateSession(&user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logging.GetLogger().LogAuthEvent("mfa_verify", user.Username, user.ID, true, client.IPAddress)
+	return &user, tokens, nil
+}
+
+// checkManagementCode checks the code of a request changing two-factor
+// authentication. Unlike a login challenge it is sent with a session that
+// may have been stolen, so wrong codes count per user like failed logins:
+// after LockoutOptions.MaxAttempts of them the second factor is locked for
+// the lockout duration, doubled by every further failure. It returns nil,
+// ErrInvalidMFACode, or a *LockoutError wrapping ErrMFALocked.
+func (as *AuthService) checkManagementCode(userID uint, code string) error {
+	var mfa models.UserMFA
+	if err := config.DB.Where("user_id = ? AND enabled = ?", userID, true).First(&mfa).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMFANotEnrolled
+		}
+		return fmt.Errorf("failed to load two-factor authentication: %w", err)
+	}
+
+	// Count the attempt before checking the code, so concurrent guesses
+	// cannot slip past the lockout
+	now := time.Now()
+	result := config.DB.Model(&models.UserMFA{}).
+		Where("id = ? AND (locked_until IS NULL OR locked_until <= ?)", mfa.ID, now).
+		Update("failed_attempts", gorm.Expr("failed_attempts + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to record two-factor attempt: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return &LockoutError{Err: ErrMFALocked, RetryAfter: time.Until(*mfa.LockedUntil)}
+	}
+
+	ok, err := as.verifySecondFactor(userID, code)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return config.DB.Model(&models.UserMFA{}).Where("id = ?", mfa.ID).Updates(map[string]interface{}{
+			"failed_attempts": 0,
+			"locked_until":    nil,
+		}).Error
+	}
+
+	var failures int
+	if err := config.DB.Model(&models.UserMFA{}).Where("id = ?", mfa.ID).Pluck("failed_attempts", &failures).Error; err != nil {
+		return fmt.Errorf("failed to record two-factor attempt: %w", err)
+	}
+	logging.GetLogger().LogAuthEvent("mfa_code_failed", "", userID, false, "")
+
+	if as.lockout.MaxAttempts <= 0 || failures < as.lockout.MaxAttempts {
+		return ErrInvalidMFACode
+	}
+
+	lockout := as.lockoutDuration(failures)
+	lockedUntil := time.Now().Add(lockout)
+	if err := config.DB.Model(&models.UserMFA{}).Where("id = ?", mfa.ID).Update("locked_until", &lockedUntil).Error; err != nil {
+		return fmt.Errorf("failed to lock two-factor authentication: %w", err)
+	}
+
+	logging.GetLogger().WithFields(map[string]interface{}{
+		"failed_attempts": failures,
+		"locked_until":    lockedUntil.UTC().Format(time.RFC3339),
+	}).LogAuthEvent("mfa_locked", "", userID, false, "")
+
+	return &LockoutError{Err: ErrMFALocked, RetryAfter: lockout}
+}
+
+// verifySecondFactor checks a TOTP code, or consumes a recovery code, of a
+// user with two-factor authentication enabled
+func (as *AuthService) verifySecondFactor(userID uint, code string) (bool, error) {
+	var mfa models.UserMFA
+	if err := config.DB.Where("user_id = ? AND enabled = ?", userID, true).First(&mfa).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrMFANotEnrolled
+		}
+		return false, fmt.Errorf("failed to load two-factor authentication: %w", err)
+	}
+
+	code = normalizeMFACode(code)
+	if len(code) == totpDigits && strings.Trim(code, "0123456789") == "" {
+		return useTOTP(config.DB, &mfa, code)
+	}
+
+	result := config.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to check recovery code: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		logging.GetLogger().LogAuthEvent("recovery_code_used", "", userID, true, "")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// useTOTP accepts code if it is valid and newer than the last accepted code
+func useTOTP(db *gorm.DB, mfa *models.UserMFA, code string) (bool, error) {
+	counter, ok := verifyTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// Only one request can use a code, even when two race
+	result := db.Model(&models.UserMFA{}).
+		Where("id = ? AND last_counter < ?", mfa.ID, counter).
+		Update("last_counter", counter)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to check code: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of a user and returns
+// recoveryCodeCount new ones formatted as xxxx-xxxx-xxxx-xxxx
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := GenerateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		// 16 base32 characters carry 80 random bits
+		code := strings.ToLower(secret[:16])
+
+		codes = append(codes, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: hashToken(code)})
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeMFACode strips the separators users type or paste with codes
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
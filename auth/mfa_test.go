@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-crud/config"
+	"go-crud/models"
+)
+
+// enrollTestMFA enables two-factor authentication for a new user and
+// returns the user's ID and recovery codes
+func enrollTestMFA(t *testing.T, as *AuthService) (uint, []string) {
+	t.Helper()
+
+	db := openTestDB(t)
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	enrollment, err := as.EnrollTOTP(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := GenerateTOTP(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := as.ConfirmTOTP(user.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID, recoveryCodes
+}
+
+// nextTOTP returns the user's code for the next time step. The code of the
+// current step was used to confirm the enrollment.
+func nextTOTP(t *testing.T, userID uint) string {
+	t.Helper()
+
+	var mfa models.UserMFA
+	if err := config.DB.Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		t.Fatal(err)
+	}
+	code, err := GenerateTOTP(mfa.Secret, time.Now().Add(totpPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// mfaLogin logs the test user in with a password of "Sup3r-secret"
+func mfaLogin(t *testing.T, as *AuthService, userID uint) *LoginResult {
+	t.Helper()
+
+	hashed, err := as.HashPassword("Sup3r-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.DB.Model(&models.User{}).Where("id = ?", userID).Update("password", hashed).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := as.Login("alice@example.com", "Sup3r-secret", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	as := NewAuthService("secret")
+	db := openTestDB(t)
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := as.ConfirmTOTP(user.ID, "123456"); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Errorf("confirm before enrolling: err = %v, want %v", err, ErrMFANotEnrolled)
+	}
+
+	first, err := as.EnrollTOTP(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := as.EnrollTOTP(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(second.URI, "secret="+second.Secret) || !strings.Contains(second.URI, ":alice@example.com?") {
+		t.Errorf("URI = %s", second.URI)
+	}
+
+	// Enrolling again replaces the unconfirmed secret
+	stale, _ := GenerateTOTP(first.Secret, time.Now())
+	if _, err := as.ConfirmTOTP(user.ID, stale); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("code of the replaced secret: err = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if enabled, _ := as.MFAEnabled(user.ID); enabled {
+		t.Fatal("enabled before confirmation")
+	}
+
+	code, _ := GenerateTOTP(second.Secret, time.Now())
+	codes, err := as.ConfirmTOTP(user.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	if enabled, _ := as.MFAEnabled(user.ID); !enabled {
+		t.Error("not enabled after confirmation")
+	}
+	if _, err := as.EnrollTOTP(&user); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("enroll while enabled: err = %v, want %v", err, ErrMFAAlreadyEnabled)
+	}
+}
+
+func TestLoginWithMFA(t *testing.T) {
+	as := NewAuthService("secret")
+	userID, _ := enrollTestMFA(t, as)
+
+	result := mfaLogin(t, as, userID)
+	if result.Tokens != nil || result.MFAChallenge == "" || result.MFAExpiresIn <= 0 {
+		t.Fatalf("login result = %+v, want only a challenge", result)
+	}
+
+	if _, _, err := as.VerifyMFA("not-a-challenge", nextTOTP(t, userID), ClientInfo{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("unknown challenge: err = %v, want %v", err, ErrInvalidMFAChallenge)
+	}
+
+	code := nextTOTP(t, userID)
+	user, tokens, err := as.VerifyMFA(result.MFAChallenge, code, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != userID || tokens == nil || tokens.AccessToken == "" {
+		t.Errorf("user = %+v, tokens = %+v", user, tokens)
+	}
+
+	// Neither the challenge nor the code can be used twice
+	if _, _, err := as.VerifyMFA(result.MFAChallenge, code, ClientInfo{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("used challenge: err = %v, want %v", err, ErrInvalidMFAChallenge)
+	}
+	again := mfaLogin(t, as, userID)
+	if _, _, err := as.VerifyMFA(again.MFAChallenge, code, ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replayed code: err = %v, want %v", err, ErrInvalidMFACode)
+	}
+}
+
+func TestLoginWithRecoveryCode(t *testing.T) {
+	as := NewAuthService("secret")
+	userID, recoveryCodes := enrollTestMFA(t, as)
+
+	// Codes are accepted however they are typed
+	typed := " " + strings.ToUpper(recoveryCodes[0]) + " "
+	if _, _, err := as.VerifyMFA(mfaLogin(t, as, userID).MFAChallenge, typed, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := as.VerifyMFA(mfaLogin(t, as, userID).MFAChallenge, recoveryCodes[0], ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("used recovery code: err = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if _, _, err := as.VerifyMFA(mfaLogin(t, as, userID).MFAChallenge, strings.ReplaceAll(recoveryCodes[1], "-", ""), ClientInfo{}); err != nil {
+		t.Errorf("recovery code without dashes: %v", err)
+	}
+
+	// Regenerating replaces every remaining code
+	fresh, err := as.RegenerateRecoveryCodes(userID, recoveryCodes[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := as.VerifyMFA(mfaLogin(t, as, userID).MFAChallenge, recoveryCodes[3], ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replaced recovery code: err = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if _, _, err := as.VerifyMFA(mfaLogin(t, as, userID).MFAChallenge, fresh[0], ClientInfo{}); err != nil {
+		t.Errorf("new recovery code: %v", err)
+	}
+}
+
+func TestMFAChallengeLimits(t *testing.T) {
+	as := NewAuthService("secret")
+	userID, recoveryCodes := enrollTestMFA(t, as)
+
+	challenge := mfaLogin(t, as, userID).MFAChallenge
+	for i := 0; i < maxMFAAttempts; i++ {
+		if _, _, err := as.VerifyMFA(challenge, "000000", ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: err = %v, want %v", i+1, err, ErrInvalidMFACode)
+		}
+	}
+	if _, _, err := as.VerifyMFA(challenge, recoveryCodes[0], ClientInfo{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("valid code after %d failures: err = %v, want %v", maxMFAAttempts, err, ErrInvalidMFAChallenge)
+	}
+
+	expired := mfaLogin(t, as, userID).MFAChallenge
+	config.DB.Model(&models.UserToken{}).Where("token_hash = ?", hashToken(expired)).Update("expires_at", time.Now().Add(-time.Second))
+	if _, _, err := as.VerifyMFA(expired, recoveryCodes[0], ClientInfo{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("expired challenge: err = %v, want %v", err, ErrInvalidMFAChallenge)
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	as := NewAuthService("secret")
+	userID, recoveryCodes := enrollTestMFA(t, as)
+
+	if err := as.DisableTOTP(userID, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("wrong code: err = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if err := as.DisableTOTP(userID, nextTOTP(t, userID)); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, _ := as.MFAEnabled(userID); enabled {
+		t.Error("still enabled")
+	}
+
+	// Without a second factor the password is enough again
+	if result := mfaLogin(t, as, userID); result.Tokens == nil {
+		t.Errorf("login result = %+v, want tokens", result)
+	}
+	if err := as.DisableTOTP(userID, recoveryCodes[0]); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Errorf("disable again: err = %v, want %v", err, ErrMFANotEnrolled)
+	}
+}
+
+func TestManagementCodeLockout(t *testing.T) {
+	as := NewAuthService("secret")
+	as.SetLockoutOptions(LockoutOptions{MaxAttempts: 3, BaseLockout: time.Minute, MaxLockout: time.Hour})
+	userID, recoveryCodes := enrollTestMFA(t, as)
+
+	manage := []struct {
+		name string
+		call func(code string) error
+	}{
+		{"disable", func(code string) error { return as.DisableTOTP(userID, code) }},
+		{"regenerate", func(code string) error {
+			_, err := as.RegenerateRecoveryCodes(userID, code)
+			return err
+		}},
+	}
+
+	// Failures count across both endpoints
+	for i := 0; i < 2; i++ {
+		if err := manage[i%2].call("000000"); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: err = %v, want %v", i+1, err, ErrInvalidMFACode)
+		}
+	}
+
+	var lockout *LockoutError
+	if err := manage[0].call("000000"); !errors.Is(err, ErrMFALocked) || !errors.As(err, &lockout) {
+		t.Fatalf("attempt 3: err = %v, want a lockout", err)
+	}
+	if lockout.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter = %v, want %v", lockout.RetryAfter, time.Minute)
+	}
+
+	// A valid code is refused, and not consumed, while locked
+	for _, m := range manage {
+		if err := m.call(recoveryCodes[0]); !errors.Is(err, ErrMFALocked) {
+			t.Errorf("%s while locked: err = %v, want %v", m.name, err, ErrMFALocked)
+		}
+	}
+	if enabled, _ := as.MFAEnabled(userID); !enabled {
+		t.Fatal("two-factor authentication disabled while locked")
+	}
+
+	// Once the lockout expires a valid code works and clears the count
+	if err := config.DB.Model(&models.UserMFA{}).Where("user_id = ?", userID).Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := manage[1].call(recoveryCodes[0]); err != nil {
+		t.Fatalf("regenerate after lockout: %v", err)
+	}
+
+	var mfa models.UserMFA
+	if err := config.DB.Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		t.Fatal(err)
+	}
+	if mfa.FailedAttempts != 0 || mfa.LockedUntil != nil {
+		t.Errorf("after success: failed_attempts = %d, locked_until = %v", mfa.FailedAttempts, mfa.LockedUntil)
+	}
+}
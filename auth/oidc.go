@@ -0,0 +1,648 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-crud/config"
+	"go-crud/logging"
+	"go-crud/models"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOIDCNotConfigured    = errors.New("OIDC login is not configured")
+	ErrInvalidOIDCState     = errors.New("invalid or expired OIDC login state")
+	ErrInvalidIDToken       = errors.New("invalid ID token")
+	ErrOIDCEmailNotVerified = errors.New("OIDC provider has not verified the email")
+	ErrOIDCSignupDisabled   = errors.New("no account is linked to the OIDC identity")
+)
+
+// jwksRefreshInterval limits how often unknown key ids refetch the JWKS
+const jwksRefreshInterval = time.Minute
+
+// OIDCOptions configures the OpenID Connect relying party
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // sent with HTTP basic auth; empty for public clients
+	RedirectURL  string
+	Scopes       []string
+
+	AllowSignup bool          // provision accounts for unknown verified emails
+	StateTTL    time.Duration // time to complete the login at the provider
+
+	HTTPClient *http.Client // defaults to a client with a 10 second timeout
+}
+
+// OIDCOptionsFromConfig returns the relying party options of cfg
+func OIDCOptionsFromConfig(cfg *config.OIDCConfig) OIDCOptions {
+	return OIDCOptions{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+		AllowSignup:  cfg.AllowSignup,
+		StateTTL:     cfg.StateTTL,
+	}
+}
+
+// OIDCProvider is an OpenID Connect provider. Its discovery document is
+// fetched on first use and its signing keys whenever an ID token names an
+// unknown key.
+type OIDCProvider struct {
+	options OIDCOptions
+	client  *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]crypto.PublicKey
+	keysRefreshed time.Time // last refetch for an unknown key
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims are the claims of an ID token used to find or create the user
+type IDTokenClaims struct {
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp,omitempty"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	GivenName         string   `json:"given_name"`
+	FamilyName        string   `json:"family_name"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts true and "true"; some providers send booleans as strings
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseBool(strings.Trim(string(data), `"`))
+	if err != nil {
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	*b = flexBool(value)
+	return nil
+}
+
+func NewOIDCProvider(options OIDCOptions) *OIDCProvider {
+	if len(options.Scopes) == 0 {
+		options.Scopes = []string{"openid", "email", "profile"}
+	}
+	if options.StateTTL <= 0 {
+		options.StateTTL = 10 * time.Minute
+	}
+
+	client := options.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &OIDCProvider{options: options, client: client}
+}
+
+// SetOIDCProvider enables single sign-on with provider
+func (as *AuthService) SetOIDCProvider(provider *OIDCProvider) {
+	as.oidc = provider
+}
+
+// BeginOIDCLogin returns the provider URL to send the user to. The login is
+// bound to a single-use state, a PKCE verifier and an ID token nonce, which
+// CompleteOIDCLogin checks.
+func (as *AuthService) BeginOIDCLogin(ctx context.Context) (string, error) {
+	if as.oidc == nil {
+		return "", ErrOIDCNotConfigured
+	}
+
+	discovery, err := as.oidc.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	// Forget logins that were never completed
+	if err := config.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		return "", fmt.Errorf("failed to clean up login states: %w", err)
+	}
+
+	err = config.DB.Create(&models.OIDCLoginState{
+		StateHash:    hashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(as.oidc.options.StateTTL),
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", as.oidc.options.ClientID)
+	query.Set("redirect_uri", as.oidc.options.RedirectURL)
+	query.Set("scope", as.oidc.scope())
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// CompleteOIDCLogin finishes a login the provider redirected back with. The
+// ID token's identity is looked up among linked identities first; otherwise
+// it is linked to the account with the same email, or a new account is
+// created, but only if the provider has verified the email. A session is
+// started like for a password login; second factors are left to the
+// provider.
+func (as *AuthService) CompleteOIDCLogin(ctx context.Context, state, code string, client ClientInfo) (*LoginResult, error) {
+	if as.oidc == nil {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	loginState, err := consumeOIDCState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := as.oidc.exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := as.oidc.verifyIDToken(ctx, rawIDToken, loginState.Nonce, as.options.Leeway)
+	if err != nil {
+		logging.GetLogger().LogAuthEvent("oidc_login", "", 0, false, client.IPAddress)
+		return nil, err
+	}
+
+	user, provisioned, err := as.oidcUser(claims, client)
+	if err != nil {
+		logging.GetLogger().LogAuthEvent("oidc_login", claims.Email, 0, false, client.IPAddress)
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
+
+	tokens, err := as.CreateSession(user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.GetLogger().LogAuthEvent("oidc_login", user.Username, user.ID, true, client.IPAddress)
+	return &LoginResult{User: user, Tokens: tokens, Provisioned: provisioned}, nil
+}
+
+// oidcUser finds, links or creates the user of a verified ID token
+func (as *AuthService) oidcUser(claims *IDTokenClaims, client ClientInfo) (*models.User, bool, error) {
+	var identity models.UserIdentity
+	err := config.DB.Where("issuer = ? AND subject = ?", claims.Issuer, claims.Subject).First(&identity).Error
+	if err == nil {
+		var user models.User
+		if err := config.DB.First(&user, identity.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, false, ErrAccountDisabled
+			}
+			return nil, false, fmt.Errorf("failed to find user: %w", err)
+		}
+		return &user, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, fmt.Errorf("failed to find identity: %w", err)
+	}
+
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return nil, false, ErrOIDCEmailNotVerified
+	}
+
+	var user models.User
+	err = config.DB.Where("email = ?", claims.Email).First(&user).Error
+	switch {
+	case err == nil:
+		if err := as.linkOIDCIdentity(&user, claims, client); err != nil {
+			return nil, false, err
+		}
+		return &user, false, nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !as.oidc.options.AllowSignup {
+			return nil, false, ErrOIDCSignupDisabled
+		}
+		created, err := as.provisionOIDCUser(claims, client)
+		if err != nil {
+			return nil, false, err
+		}
+		return created, true, nil
+	default:
+		return nil, false, fmt.Errorf("failed to find user: %w", err)
+	}
+}
+
+// linkOIDCIdentity links the identity to the account registered with its
+// email. If that email was never verified, whoever registered it may not own
+// the mailbox: the password is replaced and every token and API key of the
+// account is revoked, so only the verified owner keeps access.
+func (as *AuthService) linkOIDCIdentity(user *models.User, claims *IDTokenClaims, client ClientInfo) error {
+	takeover := !user.EmailVerified
+
+	var unusablePassword string
+	if takeover {
+		secret, err := randomToken(32)
+		if err != nil {
+			return err
+		}
+		if unusablePassword, err = as.HashPassword(secret); err != nil {
+			return err
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(newUserIdentity(user.ID, claims)).Error; err != nil {
+			return err
+		}
+		if !takeover {
+			return nil
+		}
+
+		now := time.Now()
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password":          unusablePassword,
+			"email_verified":    true,
+			"email_verified_at": &now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.APIKey{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	if takeover {
+		if err := as.RevokeUserTokens(user.ID); err != nil {
+			return err
+		}
+	}
+
+	logging.GetLogger().WithFields(map[string]interface{}{
+		"issuer": claims.Issuer,
+	}).LogAuthEvent("oidc_linked", user.Username, user.ID, true, client.IPAddress)
+	return nil
+}
+
+// provisionOIDCUser creates an active, verified account with the DefaultRole
+// and without a usable password; a password can be set later with a reset
+// link
+func (as *AuthService) provisionOIDCUser(claims *IDTokenClaims, client ClientInfo) (*models.User, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := as.HashPassword(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	username, err := availableUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Username:        username,
+		Email:           claims.Email,
+		Password:        hashedPassword,
+		FirstName:       truncate(claims.GivenName, 50),
+		LastName:        truncate(claims.FamilyName, 50),
+		IsActive:        true,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&UserRole{UserID: user.ID, Role: string(DefaultRole)}).Error; err != nil {
+			return err
+		}
+		return tx.Create(newUserIdentity(user.ID, claims)).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	logging.GetLogger().WithFields(map[string]interface{}{
+		"issuer": claims.Issuer,
+	}).LogAuthEvent("oidc_provisioned", user.Username, user.ID, true, client.IPAddress)
+	return user, nil
+}
+
+func newUserIdentity(userID uint, claims *IDTokenClaims) *models.UserIdentity {
+	return &models.UserIdentity{
+		UserID:  userID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// availableUsername derives a valid, unused username from the preferred
+// username or the local part of the email
+func availableUsername(claims *IDTokenClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" || strings.Contains(base, "@") {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = truncate(usernameInvalidChars.ReplaceAllString(base, "_"), 15)
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for i := 0; i < 10; i++ {
+		var count int64
+		if err := config.DB.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check username: %w", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+
+		suffix, err := randomHex(2)
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "_" + suffix
+	}
+	return "", errors.New("no available username")
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
+
+// consumeOIDCState deletes the stored login state, so it works only once
+func consumeOIDCState(state string) (*models.OIDCLoginState, error) {
+	var loginState models.OIDCLoginState
+	if err := config.DB.Where("state_hash = ?", hashToken(state)).First(&loginState).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	result := config.DB.Delete(&models.OIDCLoginState{}, loginState.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(loginState.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	return &loginState, nil
+}
+
+func (p *OIDCProvider) scope() string {
+	scopes := []string{"openid"}
+	for _, scope := range p.options.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// discover fetches and caches the provider's discovery document
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	wellKnown := strings.TrimRight(p.options.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	// The issuer must match exactly, or tokens of another issuer could pass
+	if discovery.Issuer != p.options.Issuer {
+		return nil, fmt.Errorf("OIDC discovery failed: issuer %q does not match %q", discovery.Issuer, p.options.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery failed: missing endpoints")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// exchange redeems the authorization code for the ID token
+func (p *OIDCProvider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.options.RedirectURL},
+		"client_id":     {p.options.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.options.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.options.ClientID), url.QueryEscape(p.options.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("OIDC token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("OIDC token request failed: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// invalid_grant: the code was used, expired or not issued for us
+		if body.Error == "invalid_grant" {
+			return "", ErrInvalidOIDCState
+		}
+		return "", fmt.Errorf("OIDC token request failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: missing from token response", ErrInvalidIDToken)
+	}
+
+	return body.IDToken, nil
+}
+
+// verifyIDToken checks the signature against the provider's JWKS and the
+// issuer, audience, lifetime and nonce of an ID token
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawIDToken, nonce string, leeway time.Duration) (*IDTokenClaims, error) {
+	var claims IDTokenClaims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(p.options.Issuer),
+		jwt.WithAudience(p.options.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.options.ClientID {
+		return nil, fmt.Errorf("%w: issued to another party", ErrInvalidIDToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// key returns the provider key kid. The JWKS is fetched on first use and
+// refetched for unknown keys, at most once per jwksRefreshInterval, so the
+// provider can rotate keys. Tokens without kid are accepted if the provider
+// publishes a single key.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if p.keys != nil {
+		if time.Since(p.keysRefreshed) < jwksRefreshInterval {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		p.keysRefreshed = time.Now()
+	}
+
+	var set JWKSet
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key; the caller holds the lock
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "go-crud"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://app.example.com/api/v1/auth/oidc/callback"
+)
+
+// fakeOIDCProvider is an OpenID Connect provider serving discovery, JWKS
+// and an authorization code token endpoint that enforces PKCE
+type fakeOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu             sync.Mutex
+	published      []*SigningKey // keys in the JWKS
+	signer         *SigningKey   // key signing ID tokens
+	codes          map[string]fakeAuthorization
+	discoveryFetch int
+	jwksFetch      int
+
+	// claims adjusts the claims of the next ID token
+	claims func(jwt.MapClaims)
+}
+
+// fakeAuthorization is a code issued for one authorization request
+type fakeAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+
+	p := &fakeOIDCProvider{t: t, codes: map[string]fakeAuthorization{}}
+	p.rotate()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.serveDiscovery)
+	mux.HandleFunc("/jwks", p.serveJWKS)
+	mux.HandleFunc("/token", p.serveToken)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) issuer() string {
+	return p.server.URL
+}
+
+// rotate publishes a new key and signs with it from now on
+func (p *fakeOIDCProvider) rotate() {
+	key, err := GenerateSigningKey("ES256")
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, key)
+	p.signer = key
+}
+
+// signWith signs ID tokens with key without publishing it
+func (p *fakeOIDCProvider) signWith(key *SigningKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.signer = key
+}
+
+// fetches returns how often discovery and the JWKS were fetched
+func (p *fakeOIDCProvider) fetches() (discovery, jwks int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.discoveryFetch, p.jwksFetch
+}
+
+func (p *fakeOIDCProvider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.discoveryFetch++
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.issuer(),
+		"authorization_endpoint": p.issuer() + "/authorize",
+		"token_endpoint":         p.issuer() + "/token",
+		"jwks_uri":               p.issuer() + "/jwks",
+	})
+}
+
+func (p *fakeOIDCProvider) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.jwksFetch++
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range p.published {
+		jwk, _ := key.jwk()
+		set.Keys = append(set.Keys, jwk)
+	}
+	writeJSON(w, http.StatusOK, set)
+}
+
+// serveToken redeems a code once, for the client it was issued to and with
+// the verifier of its code challenge
+func (p *fakeOIDCProvider) serveToken(w http.ResponseWriter, r *http.Request) {
+	invalidGrant := map[string]string{"error": "invalid_grant"}
+
+	if id, secret, ok := r.BasicAuth(); !ok || id != testClientID || secret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != testRedirectURL {
+		writeJSON(w, http.StatusBadRequest, invalidGrant)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	code := r.PostFormValue("code")
+	authorization, ok := p.codes[code]
+	delete(p.codes, code)
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != authorization.challenge {
+		writeJSON(w, http.StatusBadRequest, invalidGrant)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.issuer(),
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          authorization.nonce,
+		"email":          "sso@example.com",
+		"email_verified": true,
+	}
+	if p.claims != nil {
+		p.claims(claims)
+	}
+
+	token := jwt.NewWithClaims(p.signer.Method, claims)
+	token.Header["kid"] = p.signer.ID
+	idToken, err := token.SignedString(p.signer.signKey)
+	if err != nil {
+		p.t.Error(err)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+}
+
+// authorize stands in for the user logging in at the provider: it checks
+// the authorization URL and returns the state and code of the redirect back
+func (p *fakeOIDCProvider) authorize(authURL string) (state, code string) {
+	p.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("client_id") != testClientID || query.Get("redirect_uri") != testRedirectURL ||
+		query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		p.t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	code, err = randomToken(16)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = fakeAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	return query.Get("state"), code
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// newOIDCTest returns an AuthService using the fake provider
+func newOIDCTest(t *testing.T) (*AuthService, *fakeOIDCProvider) {
+	t.Helper()
+
+	openTestDB(t)
+	provider := newFakeOIDCProvider(t)
+
+	as := NewAuthService("secret")
+	as.SetOIDCProvider(NewOIDCProvider(OIDCOptions{
+		Issuer:       provider.issuer(),
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		AllowSignup:  true,
+	}))
+	return as, provider
+}
+
+// oidcLogin runs a login through the fake provider
+func oidcLogin(t *testing.T, as *AuthService, provider *fakeOIDCProvider) (*LoginResult, error) {
+	t.Helper()
+
+	authURL, err := as.BeginOIDCLogin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := provider.authorize(authURL)
+	return as.CompleteOIDCLogin(context.Background(), state, code, ClientInfo{IPAddress: "192.0.2.1"})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	as, provider := newOIDCTest(t)
+
+	result, err := oidcLogin(t, as, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Provisioned || result.User.Email != "sso@example.com" || result.Tokens == nil {
+		t.Fatalf("first login = %+v, want a provisioned user with tokens", result)
+	}
+
+	// The linked identity signs in to the same account
+	again, err := oidcLogin(t, as, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Provisioned || again.User.ID != result.User.ID {
+		t.Errorf("second login = user %d (provisioned %v), want user %d", again.User.ID, again.Provisioned, result.User.ID)
+	}
+
+	if discovery, jwks := provider.fetches(); discovery != 1 || jwks != 1 {
+		t.Errorf("discovery fetched %d times, JWKS %d times, want both cached after the first login", discovery, jwks)
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	as, provider := newOIDCTest(t)
+	as.SetOIDCProvider(NewOIDCProvider(OIDCOptions{
+		Issuer:      provider.issuer() + "/",
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}))
+
+	if _, err := as.BeginOIDCLogin(context.Background()); err == nil {
+		t.Error("BeginOIDCLogin accepted a discovery document of another issuer")
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	as, provider := newOIDCTest(t)
+
+	if _, err := oidcLogin(t, as, provider); err != nil {
+		t.Fatal(err)
+	}
+
+	// A token signed with a new key refetches the JWKS
+	provider.rotate()
+	if _, err := oidcLogin(t, as, provider); err != nil {
+		t.Fatalf("login after key rotation: %v", err)
+	}
+	if _, jwks := provider.fetches(); jwks != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", jwks)
+	}
+
+	// Unknown keys do not refetch again within the refresh interval
+	unpublished, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.signWith(unpublished)
+	if _, err := oidcLogin(t, as, provider); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("unpublished key: err = %v, want %v", err, ErrInvalidIDToken)
+	}
+	if _, jwks := provider.fetches(); jwks != 2 {
+		t.Errorf("JWKS fetched %d times, want 2 within the refresh interval", jwks)
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+	}{
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "other" }},
+		{"missing nonce", func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{"other authorized party", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other-client"}
+			c["azp"] = "other-client"
+		}},
+		{"expired", func(c jwt.MapClaims) {
+			c["iat"] = time.Now().Add(-time.Hour).Unix()
+			c["exp"] = time.Now().Add(-10 * time.Minute).Unix()
+		}},
+		{"missing expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"missing subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, provider := newOIDCTest(t)
+			provider.claims = tt.claims
+
+			if _, err := oidcLogin(t, as, provider); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginBadSignature(t *testing.T) {
+	as, provider := newOIDCTest(t)
+
+	// Same kid as the published key, signed by another private key
+	forged, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.ID = provider.published[0].ID
+	provider.signWith(forged)
+
+	if _, err := oidcLogin(t, as, provider); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestOIDCLoginBadState(t *testing.T) {
+	as, provider := newOIDCTest(t)
+	ctx := context.Background()
+	client := ClientInfo{IPAddress: "192.0.2.1"}
+
+	authURL, err := as.BeginOIDCLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := provider.authorize(authURL)
+
+	if _, err := as.CompleteOIDCLogin(ctx, "forged-state", code, client); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("unknown state: err = %v, want %v", err, ErrInvalidOIDCState)
+	}
+	if _, err := as.CompleteOIDCLogin(ctx, state, code, client); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.CompleteOIDCLogin(ctx, state, code, client); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("reused state: err = %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
+
+func TestOIDCLoginPKCE(t *testing.T) {
+	as, provider := newOIDCTest(t)
+	ctx := context.Background()
+
+	// A code issued to one login cannot be redeemed by another: the token
+	// endpoint gets the other login's verifier
+	victimURL, err := as.BeginOIDCLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attackerURL, err := as.BeginOIDCLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := provider.authorize(victimURL)
+	attackerState, _ := provider.authorize(attackerURL)
+
+	_, err = as.CompleteOIDCLogin(ctx, attackerState, code, ClientInfo{IPAddress: "192.0.2.1"})
+	if !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-crud/config"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnsupportedHash = errors.New("unsupported password hash")
+
+// PasswordHasher hashes passwords into PHC strings
+// ($id$param=value,...$salt$hash). bcrypt keeps its own $2b$ format, which
+// PHC tools accept as well.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password with the hasher's parameters
+	Hash(password string) (string, error)
+	// Supports reports whether encoded was produced by this algorithm
+	Supports(encoded string) bool
+	// Verify reports whether password matches encoded
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash reports whether encoded uses other parameters than Hash
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idParams are the cost parameters of Argon2id (RFC 9106)
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Time        uint32 // iterations
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the OWASP recommendation of 19 MiB memory
+// and 2 iterations
+func DefaultArgon2idParams() Argon2idParams {
+	return Argon2idParams{
+		Memory:      19 * 1024,
+		Time:        2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// Argon2idHasher encodes hashes as $argon2id$v=19$m=...,t=...,p=...$salt$hash
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Time, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	encode := base64.RawStdEncoding.EncodeToString
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Time, h.params.Parallelism, encode(salt), encode(key)), nil
+}
+
+func (h *Argon2idHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	return err != nil || params != h.params
+}
+
+// decodeArgon2id parses an Argon2id PHC string of the current version
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: argon2id version %q", ErrUnsupportedHash, parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: argon2id parameters %q", ErrUnsupportedHash, parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: argon2id salt", ErrUnsupportedHash)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: argon2id hash", ErrUnsupportedHash)
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes with bcrypt at a fixed cost
+type BcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+// Passwords hashes new passwords with its current hasher and verifies hashes
+// of any of its hashers, so the algorithm and its cost can change over time:
+// outdated hashes keep working and are reported for rehashing.
+type Passwords struct {
+	current PasswordHasher
+	hashers []PasswordHasher
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewPasswords hashes with current and also verifies hashes of legacy
+func NewPasswords(current PasswordHasher, legacy ...PasswordHasher) *Passwords {
+	return &Passwords{
+		current: current,
+		hashers: append([]PasswordHasher{current}, legacy...),
+	}
+}
+
+// DefaultPasswords hashes with Argon2id and still accepts bcrypt hashes
+func DefaultPasswords() *Passwords {
+	return NewPasswords(NewArgon2idHasher(DefaultArgon2idParams()), NewBcryptHasher(bcrypt.DefaultCost))
+}
+
+// NewPasswordsFromConfig hashes with the algorithm of cfg and accepts hashes
+// of the other supported algorithm
+func NewPasswordsFromConfig(cfg *config.PasswordConfig) (*Passwords, error) {
+	argon := NewArgon2idHasher(Argon2idParams{
+		Memory:      cfg.Argon2Memory,
+		Time:        cfg.Argon2Time,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+	bcryptHasher := NewBcryptHasher(cfg.BcryptCost)
+
+	switch cfg.Algorithm {
+	case "argon2id":
+		return NewPasswords(argon, bcryptHasher), nil
+	case "bcrypt":
+		return NewPasswords(bcryptHasher, argon), nil
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm: %s", cfg.Algorithm)
+	}
+}
+
+// Hash hashes password with the current hasher
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.current.Hash(password)
+}
+
+// Verify reports whether password matches encoded, and whether encoded
+// should be replaced by a hash from the current hasher
+func (p *Passwords) Verify(encoded, password string) (match bool, rehash bool, err error) {
+	for _, hasher := range p.hashers {
+		if !hasher.Supports(encoded) {
+			continue
+		}
+
+		match, err := hasher.Verify(encoded, password)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, hasher != p.current || p.current.NeedsRehash(encoded), nil
+	}
+	return false, false, ErrUnsupportedHash
+}
+
+// VerifyDummy costs the same as verifying a current hash. It is used when
+// there is no hash to check, so response times do not reveal that.
+func (p *Passwords) VerifyDummy(password string) {
+	p.dummyOnce.Do(func() {
+		p.dummy, _ = p.current.Hash("dummy password")
+	})
+	p.current.Verify(p.dummy, password)
+}
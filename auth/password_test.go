@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-crud/config"
+	"go-crud/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idParams keeps hashing cheap in tests
+var testArgon2idParams = Argon2idParams{Memory: 64, Time: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHashers(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		prefix string
+	}{
+		{"argon2id", NewArgon2idHasher(testArgon2idParams), "$argon2id$v=19$m=64,t=1,p=1$"},
+		{"bcrypt", NewBcryptHasher(bcrypt.MinCost), "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hasher.Hash("Sup3r-secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(encoded, tt.prefix) || !tt.hasher.Supports(encoded) {
+				t.Fatalf("hash = %s, want prefix %s", encoded, tt.prefix)
+			}
+			if other, _ := tt.hasher.Hash("Sup3r-secret"); other == encoded {
+				t.Error("two hashes of the same password are equal")
+			}
+
+			if ok, err := tt.hasher.Verify(encoded, "Sup3r-secret"); err != nil || !ok {
+				t.Errorf("right password: %v, %v", ok, err)
+			}
+			if ok, err := tt.hasher.Verify(encoded, "wrong"); err != nil || ok {
+				t.Errorf("wrong password: %v, %v", ok, err)
+			}
+			if tt.hasher.NeedsRehash(encoded) {
+				t.Error("NeedsRehash for its own hash")
+			}
+		})
+	}
+}
+
+func TestArgon2idRejectsMalformedHashes(t *testing.T) {
+	hasher := NewArgon2idHasher(testArgon2idParams)
+
+	for _, encoded := range []string{
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64;t=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64$aGFzaA",
+	} {
+		if _, err := hasher.Verify(encoded, "Sup3r-secret"); !errors.Is(err, ErrUnsupportedHash) {
+			t.Errorf("Verify(%q): err = %v, want %v", encoded, err, ErrUnsupportedHash)
+		}
+		if !hasher.NeedsRehash(encoded) {
+			t.Errorf("NeedsRehash(%q) = false", encoded)
+		}
+	}
+}
+
+func TestPasswordsVerify(t *testing.T) {
+	argon := NewArgon2idHasher(testArgon2idParams)
+	passwords := NewPasswords(argon, NewBcryptHasher(bcrypt.MinCost))
+
+	current, _ := argon.Hash("Sup3r-secret")
+	legacy, _ := NewBcryptHasher(bcrypt.MinCost).Hash("Sup3r-secret")
+	weaker, _ := NewArgon2idHasher(Argon2idParams{Memory: 32, Time: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("Sup3r-secret")
+
+	tests := []struct {
+		name    string
+		encoded string
+		rehash  bool
+	}{
+		{"current hash", current, false},
+		{"other algorithm", legacy, true},
+		{"other parameters", weaker, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := passwords.Verify(tt.encoded, "Sup3r-secret")
+			if err != nil || !match || rehash != tt.rehash {
+				t.Errorf("Verify = %v, %v, %v, want true, %v, nil", match, rehash, err, tt.rehash)
+			}
+			if match, rehash, err := passwords.Verify(tt.encoded, "wrong"); err != nil || match || rehash {
+				t.Errorf("wrong password: Verify = %v, %v, %v", match, rehash, err)
+			}
+		})
+	}
+
+	if _, _, err := passwords.Verify("$md5$abc", "Sup3r-secret"); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("unknown algorithm: err = %v, want %v", err, ErrUnsupportedHash)
+	}
+}
+
+func TestNewPasswordsFromConfig(t *testing.T) {
+	cfg := &config.PasswordConfig{Algorithm: "bcrypt", Argon2Memory: 64, Argon2Time: 1, Argon2Parallelism: 1, BcryptCost: bcrypt.MinCost}
+	passwords, err := NewPasswordsFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := passwords.Hash("Sup3r-secret")
+	if !strings.HasPrefix(encoded, "$2a$04$") {
+		t.Errorf("hash = %s, want bcrypt", encoded)
+	}
+
+	// The other algorithm is still accepted
+	argon, _ := NewArgon2idHasher(testArgon2idParams).Hash("Sup3r-secret")
+	if match, rehash, err := passwords.Verify(argon, "Sup3r-secret"); err != nil || !match || !rehash {
+		t.Errorf("argon2id hash: Verify = %v, %v, %v", match, rehash, err)
+	}
+
+	cfg.Algorithm = "md5"
+	if _, err := NewPasswordsFromConfig(cfg); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
+
+func TestLoginRehashesOutdatedHashes(t *testing.T) {
+	as, db, user := newSessionTest(t)
+	as.SetPasswords(NewPasswords(NewArgon2idHasher(testArgon2idParams), NewBcryptHasher(bcrypt.MinCost)))
+
+	legacy, _ := NewBcryptHasher(bcrypt.MinCost).Hash("Sup3r-secret")
+	if err := db.Model(user).Update("password", legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := as.Authenticate(user.Email, "wrong", ClientInfo{}); err == nil {
+		t.Fatal("wrong password accepted")
+	}
+	var stored models.User
+	db.First(&stored, user.ID)
+	if stored.Password != legacy {
+		t.Error("hash replaced after a failed login")
+	}
+
+	if _, err := as.Authenticate(user.Email, "Sup3r-secret", ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&stored, user.ID)
+	if !strings.HasPrefix(stored.Password, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash after login = %s, want argon2id", stored.Password)
+	}
+
+	// The new hash works and is kept
+	upgraded := stored.Password
+	if _, err := as.Authenticate(user.Email, "Sup3r-secret", ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&stored, user.ID)
+	if stored.Password != upgraded {
+		t.Error("current hash replaced again")
+	}
+}
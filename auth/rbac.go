@@ -1,10 +1,16 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"go-crud/models"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Role string
@@ -15,6 +21,10 @@ const (
 	Guest  Role = "guest"
 )
 
+// DefaultRole is assigned to every account created by registration or
+// single sign-on
+const DefaultRole = User
+
 type Permission string
 
 const (
@@ -33,95 +43,499 @@ const (
 	UpdateComment Permission = "update:comment"
 	DeleteComment Permission = "delete:comment"
 	
+	// Records of the datastore API (/api/v1/datastore)
+	CreateData Permission = "create:data"
+	ReadData   Permission = "read:data"
+	UpdateData Permission = "update:data"
+	DeleteData Permission = "delete:data"
+	
 	ManageSystem Permission = "manage:system"
+	
+	// AnyPermission matches every permission
+	AnyPermission Permission = "*:*"
 )
 
-type UserRole struct {
-	ID     uint   `gorm:"primaryKey" json:"id"`
-	UserID uint   `gorm:"not null" json:"user_id"`
-	Role   string `gorm:"size:50;not null" json:"role"`
+// permissionWildcard stands for any action or any resource in a permission
+// such as "*:post" or "read:*"
+const permissionWildcard = "*"
+
+var (
+	// ErrRoleCycle is returned when a role would end up inheriting from itself
+	ErrRoleCycle = errors.New("role inheritance cycle")
+	
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleExists   = errors.New("role already exists")
+	
+	// ErrSystemRole is returned when deleting one of the built-in roles
+	ErrSystemRole = errors.New("system roles cannot be deleted")
+)
+
+// systemRoles are created by InitializeDefaultRoles
+var systemRoles = map[Role]string{
+	Admin: "Full access to the API",
+	User:  "Registered user managing their own posts and comments",
+	Guest: "Read-only access",
+}
+
+// AllPermissions lists every permission known to the API
+func AllPermissions() []Permission {
+	return []Permission{
+		CreateUser, ReadUser, UpdateUser, DeleteUser,
+		CreatePost, ReadPost, UpdatePost, DeletePost,
+		CreateComment, ReadComment, UpdateComment, DeleteComment,
+		CreateData, ReadData, UpdateData, DeleteData,
+		ManageSystem,
+	}
+}
+
+// ParsePermission returns the permission named s. Wildcards are accepted in
+// place of a known action or resource, e.g. "*:post" or "read:*".
+func ParsePermission(s string) (Permission, error) {
+	action, resource, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", fmt.Errorf("unknown permission: %s", s)
+	}
 	
-	User models.User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user,omitempty"`
+	knownAction := action == permissionWildcard
+	knownResource := resource == permissionWildcard
+	for _, permission := range AllPermissions() {
+		if string(permission) == s {
+			return permission, nil
+		}
+		a, r, _ := strings.Cut(string(permission), ":")
+		knownAction = knownAction || a == action
+		knownResource = knownResource || r == resource
+	}
+	if (action == permissionWildcard || resource == permissionWildcard) && knownAction && knownResource {
+		return Permission(s), nil
+	}
+	return "", fmt.Errorf("unknown permission: %s", s)
+}
+
+// Matches reports whether holding p grants required. A wildcard action or
+// resource in p matches any value in required.
+func (p Permission) Matches(required Permission) bool {
+	if p == required {
+		return true
+	}
+	
+	action, resource, ok := strings.Cut(string(p), ":")
+	if !ok {
+		return false
+	}
+	requiredAction, requiredResource, ok := strings.Cut(string(required), ":")
+	if !ok {
+		return false
+	}
+	return (action == permissionWildcard || action == requiredAction) &&
+		(resource == permissionWildcard || resource == requiredResource)
+}
+
+// permissionSet holds granted permissions, keeping wildcards apart so exact
+// permissions are matched with a map lookup
+type permissionSet struct {
+	exact     map[Permission]bool
+	wildcards []Permission
+}
+
+func newPermissionSet() *permissionSet {
+	return &permissionSet{exact: make(map[Permission]bool)}
+}
+
+func (ps *permissionSet) add(permission Permission) {
+	if !strings.Contains(string(permission), permissionWildcard) {
+		ps.exact[permission] = true
+		return
+	}
+	for _, p := range ps.wildcards {
+		if p == permission {
+			return
+		}
+	}
+	ps.wildcards = append(ps.wildcards, permission)
+}
+
+func (ps *permissionSet) merge(other *permissionSet) {
+	for permission := range other.exact {
+		ps.exact[permission] = true
+	}
+	for _, permission := range other.wildcards {
+		ps.add(permission)
+	}
+}
+
+func (ps *permissionSet) allows(required Permission) bool {
+	if ps.exact[required] {
+		return true
+	}
+	for _, p := range ps.wildcards {
+		if p.Matches(required) {
+			return true
+		}
+	}
+	return false
 }
 
-type RolePermission struct {
-	ID           uint   `gorm:"primaryKey" json:"id"`
-	Role         string `gorm:"size:50;not null" json:"role"`
-	Permission   string `gorm:"size:100;not null" json:"permission"`
+// list returns the granted permissions, wildcards included, sorted
+func (ps *permissionSet) list() []string {
+	permissions := make([]string, 0, len(ps.exact)+len(ps.wildcards))
+	for permission := range ps.exact {
+		permissions = append(permissions, string(permission))
+	}
+	for _, permission := range ps.wildcards {
+		permissions = append(permissions, string(permission))
+	}
+	sort.Strings(permissions)
+	return permissions
 }
 
+// The RBAC tables live in models so models.AutoMigrate can create them
+type (
+	UserRole       = models.UserRole
+	RolePermission = models.RolePermission
+	RoleParent     = models.RoleParent
+)
+
+// RBACService resolves the roles and permissions of users. Resolved access
+// is cached in process memory for the cache TTL (DefaultPermissionCacheTTL);
+// changes made through the service invalidate the cache at once.
 type RBACService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	cache *permissionCache
+	
+	rolesChanged func(userIDs ...uint) error
 }
 
 func NewRBACService(db *gorm.DB) *RBACService {
-	return &RBACService{db: db}
+	return &RBACService{
+		db:    db,
+		cache: newPermissionCache(DefaultPermissionCacheTTL),
+	}
+}
+
+// SetCacheTTL changes how long resolved access is cached; 0 disables caching
+func (rs *RBACService) SetCacheTTL(ttl time.Duration) {
+	rs.cache.setTTL(ttl)
+}
+
+// OnRolesChanged registers fn to be called with the users whose effective
+// roles were changed through the service. Access tokens embed the roles of
+// their user, so fn usually revokes them (AuthService.RevokeAccessTokens).
+func (rs *RBACService) OnRolesChanged(fn func(userIDs ...uint) error) {
+	rs.rolesChanged = fn
+}
+
+func (rs *RBACService) notifyRolesChanged(userIDs []uint) error {
+	if rs.rolesChanged == nil || len(userIDs) == 0 {
+		return nil
+	}
+	if err := rs.rolesChanged(userIDs...); err != nil {
+		return fmt.Errorf("failed to apply role change: %w", err)
+	}
+	return nil
 }
 
+// AssignRole gives a role to a user; assigning a role twice is a no-op
 func (rs *RBACService) AssignRole(userID uint, role Role) error {
 	userRole := &UserRole{
 		UserID: userID,
 		Role:   string(role),
 	}
 	
-	return rs.db.Create(userRole).Error
+	defer rs.cache.invalidateUser(userID)
+	result := rs.db.Clauses(clause.OnConflict{DoNothing: true}).Create(userRole)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return rs.notifyRolesChanged([]uint{userID})
 }
 
 func (rs *RBACService) RemoveRole(userID uint, role Role) error {
-	return rs.db.Where("user_id = ? AND role = ?", userID, string(role)).Delete(&UserRole{}).Error
+	defer rs.cache.invalidateUser(userID)
+	result := rs.db.Where("user_id = ? AND role = ?", userID, string(role)).Delete(&UserRole{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return rs.notifyRolesChanged([]uint{userID})
 }
 
-func (rs *RBACService) GetUserRoles(userID uint) ([]string, error) {
+// GetAssignedRoles returns the roles assigned to a user, without the roles
+// they inherit from
+func (rs *RBACService) GetAssignedRoles(userID uint) ([]string, error) {
 	var roles []string
-	err := rs.db.Model(&UserRole{}).Where("user_id = ?", userID).Pluck("role", &roles).Error
+	err := rs.db.Model(&UserRole{}).Where("user_id = ?", userID).Order("role").Pluck("role", &roles).Error
 	return roles, err
 }
 
+// GetUserRoles returns the roles assigned to a user followed by the roles
+// they inherit from
+func (rs *RBACService) GetUserRoles(userID uint) ([]string, error) {
+	access, err := rs.userAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), access.roles...), nil
+}
+
+// GetUserPermissions returns the permissions granted by all roles of a user,
+// inherited ones included. Wildcard permissions are returned as stored.
+func (rs *RBACService) GetUserPermissions(userID uint) ([]string, error) {
+	access, err := rs.userAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+	return access.permissions.list(), nil
+}
+
 func (rs *RBACService) HasRole(userID uint, role Role) (bool, error) {
-	var count int64
-	err := rs.db.Model(&UserRole{}).Where("user_id = ? AND role = ?", userID, string(role)).Count(&count).Error
-	return count > 0, err
+	access, err := rs.userAccess(userID)
+	if err != nil {
+		return false, err
+	}
+	return access.hasRole(role), nil
 }
 
+// AddPermission grants a permission to a role; granting it twice is a no-op
 func (rs *RBACService) AddPermission(role Role, permission Permission) error {
 	rolePermission := &RolePermission{
 		Role:       string(role),
 		Permission: string(permission),
 	}
 	
-	return rs.db.Create(rolePermission).Error
+	defer rs.cache.invalidateAll()
+	return rs.db.Clauses(clause.OnConflict{DoNothing: true}).Create(rolePermission).Error
 }
 
 func (rs *RBACService) RemovePermission(role Role, permission Permission) error {
+	defer rs.cache.invalidateAll()
 	return rs.db.Where("role = ? AND permission = ?", string(role), string(permission)).Delete(&RolePermission{}).Error
 }
 
+// AddRoleParent makes role inherit from parent. It fails with ErrRoleCycle
+// if parent already inherits from role.
+func (rs *RBACService) AddRoleParent(role, parent Role) error {
+	if role == parent {
+		return ErrRoleCycle
+	}
+	
+	defer rs.cache.invalidateAll()
+	var affected []uint
+	err := rs.db.Transaction(func(tx *gorm.DB) error {
+		var rows []RoleParent
+		if err := tx.Find(&rows).Error; err != nil {
+			return err
+		}
+		
+		hierarchy := newRoleHierarchy(rows)
+		for _, r := range hierarchy.expand([]string{string(parent)}) {
+			if r == string(role) {
+				return fmt.Errorf("%w: %s already inherits from %s", ErrRoleCycle, parent, role)
+			}
+		}
+		
+		var count int64
+		if err := tx.Model(&RoleParent{}).Where("role = ? AND parent = ?", string(role), string(parent)).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		if err := tx.Create(&RoleParent{Role: string(role), Parent: string(parent)}).Error; err != nil {
+			return err
+		}
+		
+		var err error
+		affected, err = usersHolding(tx, string(role))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return rs.notifyRolesChanged(affected)
+}
+
+func (rs *RBACService) RemoveRoleParent(role, parent Role) error {
+	defer rs.cache.invalidateAll()
+	var affected []uint
+	err := rs.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("role = ? AND parent = ?", string(role), string(parent)).Delete(&RoleParent{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		
+		var err error
+		affected, err = usersHolding(tx, string(role))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return rs.notifyRolesChanged(affected)
+}
+
+// GetRoleParents returns the roles role inherits from directly
+func (rs *RBACService) GetRoleParents(role Role) ([]string, error) {
+	var parents []string
+	err := rs.db.Model(&RoleParent{}).Where("role = ?", string(role)).Order("parent").Pluck("parent", &parents).Error
+	return parents, err
+}
+
 func (rs *RBACService) GetRolePermissions(role Role) ([]string, error) {
 	var permissions []string
-	err := rs.db.Model(&RolePermission{}).Where("role = ?", string(role)).Pluck("permission", &permissions).Error
+	err := rs.db.Model(&RolePermission{}).Where("role = ?", string(role)).Order("permission").Pluck("permission", &permissions).Error
 	return permissions, err
 }
 
-func (rs *RBACService) HasPermission(userID uint, permission Permission) (bool, error) {
-	// Get user roles
-	roles, err := rs.GetUserRoles(userID)
-	if err != nil {
-		return false, err
+// ListRoles returns the role catalogue ordered by name
+func (rs *RBACService) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := rs.db.Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// GetRole returns a role of the catalogue or ErrRoleNotFound
+func (rs *RBACService) GetRole(role Role) (*models.Role, error) {
+	var entry models.Role
+	if err := rs.db.Where("name = ?", string(role)).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
 	}
+	return &entry, nil
+}
+
+// CreateRole adds a custom role inheriting from parents, which must exist
+func (rs *RBACService) CreateRole(role Role, description string, parents []Role) (*models.Role, error) {
+	entry := &models.Role{Name: string(role), Description: description}
 	
-	// Check if any role has the permission
-	for _, role := range roles {
+	defer rs.cache.invalidateAll()
+	err := rs.db.Transaction(func(tx *gorm.DB) error {
 		var count int64
-		err := rs.db.Model(&RolePermission{}).Where("role = ? AND permission = ?", role, string(permission)).Count(&count).Error
-		if err != nil {
-			return false, err
+		if err := tx.Model(&models.Role{}).Where("name = ?", string(role)).Count(&count).Error; err != nil {
+			return err
 		}
 		if count > 0 {
-			return true, nil
+			return ErrRoleExists
+		}
+		
+		for _, parent := range parents {
+			if err := tx.Model(&models.Role{}).Where("name = ?", string(parent)).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return fmt.Errorf("%w: %s", ErrRoleNotFound, parent)
+			}
+		}
+		
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		
+		// A new role has no children, so its parents cannot form a cycle
+		for _, parent := range parents {
+			rp := &RoleParent{Role: string(role), Parent: string(parent)}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(rp).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// DeleteRole removes a custom role together with its grants, its place in
+// the hierarchy and its assignments to users
+func (rs *RBACService) DeleteRole(role Role) error {
+	defer rs.cache.invalidateAll()
+	var affected []uint
+	err := rs.db.Transaction(func(tx *gorm.DB) error {
+		var entry models.Role
+		if err := tx.Where("name = ?", string(role)).First(&entry).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return err
+		}
+		if entry.System {
+			return ErrSystemRole
+		}
+		
+		var err error
+		if affected, err = usersHolding(tx, entry.Name); err != nil {
+			return err
+		}
+		
+		if err := tx.Where("role = ?", entry.Name).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ?", entry.Name).Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ? OR parent = ?", entry.Name, entry.Name).Delete(&RoleParent{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entry).Error
+	})
+	if err != nil {
+		return err
+	}
+	return rs.notifyRolesChanged(affected)
+}
+
+// usersHolding returns the users assigned role or a role inheriting from it
+func usersHolding(tx *gorm.DB, role string) ([]uint, error) {
+	var rows []RoleParent
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	hierarchy := newRoleHierarchy(rows)
+	
+	var assigned []string
+	if err := tx.Model(&UserRole{}).Distinct().Pluck("role", &assigned).Error; err != nil {
+		return nil, err
+	}
+	
+	var holding []string
+	for _, r := range assigned {
+		if slices.Contains(hierarchy.expand([]string{r}), role) {
+			holding = append(holding, r)
 		}
 	}
+	if len(holding) == 0 {
+		return nil, nil
+	}
+	
+	var userIDs []uint
+	err := tx.Model(&UserRole{}).Where("role IN ?", holding).Distinct().Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+func (rs *RBACService) HasPermission(userID uint, permission Permission) (bool, error) {
+	access, err := rs.userAccess(userID)
+	if err != nil {
+		return false, err
+	}
+	return access.permissions.allows(permission), nil
+}
+
+// RolesHavePermission reports whether any of roles grants permission. It is
+// used with the roles embedded in an access token, which already include
+// inherited roles.
+func (rs *RBACService) RolesHavePermission(roles []string, permission Permission) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
 	
-	return false, nil
+	_, generation := rs.cache.role(roles[0])
+	granted, err := rs.rolePermissions(roles, generation)
+	if err != nil {
+		return false, err
+	}
+	return granted.allows(permission), nil
 }
 
 func (rs *RBACService) RequirePermission(userID uint, permission Permission) error {
@@ -151,12 +565,13 @@ func (rs *RBACService) RequireRole(userID uint, role Role) error {
 }
 
 func (rs *RBACService) RequireAnyRole(userID uint, roles ...Role) error {
+	access, err := rs.userAccess(userID)
+	if err != nil {
+		return fmt.Errorf("failed to check role: %w", err)
+	}
+	
 	for _, role := range roles {
-		hasRole, err := rs.HasRole(userID, role)
-		if err != nil {
-			return fmt.Errorf("failed to check role: %w", err)
-		}
-		if hasRole {
+		if access.hasRole(role) {
 			return nil
 		}
 	}
@@ -175,21 +590,29 @@ func (rs *RBACService) RequireOwnershipOrRole(userID uint, resourceUserID uint,
 }
 
 func (rs *RBACService) InitializeDefaultRoles() error {
-	// Initialize default role permissions
+	for role, description := range systemRoles {
+		entry := models.Role{Name: string(role), Description: description, System: true}
+		if err := rs.db.Where("name = ?", string(role)).Attrs(entry).FirstOrCreate(&entry).Error; err != nil {
+			return fmt.Errorf("failed to create role %s: %w", role, err)
+		}
+	}
+	
+	// admin inherits user, which inherits guest
+	defaultParents := []RoleParent{
+		{Role: string(Admin), Parent: string(User)},
+		{Role: string(User), Parent: string(Guest)},
+	}
+	for _, rp := range defaultParents {
+		if err := rs.AddRoleParent(Role(rp.Role), Role(rp.Parent)); err != nil {
+			return fmt.Errorf("failed to make role %s inherit from %s: %w", rp.Role, rp.Parent, err)
+		}
+	}
+	
+	// Each role only lists what it adds to the roles it inherits from
 	defaultPermissions := map[Role][]Permission{
-		Admin: {
-			CreateUser, ReadUser, UpdateUser, DeleteUser,
-			CreatePost, ReadPost, UpdatePost, DeletePost,
-			CreateComment, ReadComment, UpdateComment, DeleteComment,
-			ManageSystem,
-		},
-		User: {
-			CreatePost, ReadPost, UpdatePost, DeletePost,
-			CreateComment, ReadComment, UpdateComment, DeleteComment,
-		},
-		Guest: {
-			ReadPost, ReadComment,
-		},
+		Admin: {AnyPermission},
+		User:  {"*:post", "*:comment"},
+		Guest: {ReadPost, ReadComment},
 	}
 	
 	for role, permissions := range defaultPermissions {
@@ -208,3 +631,140 @@ func (rs *RBACService) InitializeDefaultRoles() error {
 	
 	return nil
 }
+
+// userAccess returns the roles and permissions of a user. On a cache miss
+// the assigned roles and their permissions are read with a single query;
+// inherited roles come from the role cache.
+func (rs *RBACService) userAccess(userID uint) (*userAccess, error) {
+	access, generation := rs.cache.user(userID)
+	if access != nil {
+		return access, nil
+	}
+	
+	var rows []struct {
+		Role       string
+		Permission *string
+	}
+	err := rs.db.Model(&UserRole{}).
+		Select("user_roles.role, role_permissions.permission").
+		Joins("LEFT JOIN role_permissions ON role_permissions.role = user_roles.role").
+		Where("user_roles.user_id = ?", userID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	
+	access = &userAccess{permissions: newPermissionSet()}
+	var assigned []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		if !seen[row.Role] {
+			seen[row.Role] = true
+			assigned = append(assigned, row.Role)
+		}
+		if row.Permission != nil {
+			access.permissions.add(Permission(*row.Permission))
+		}
+	}
+	
+	hierarchy, err := rs.roleHierarchy(generation)
+	if err != nil {
+		return nil, err
+	}
+	access.roles = hierarchy.expand(assigned)
+	if inherited := access.roles[len(assigned):]; len(inherited) > 0 {
+		granted, err := rs.rolePermissions(inherited, generation)
+		if err != nil {
+			return nil, err
+		}
+		access.permissions.merge(granted)
+	}
+	
+	rs.cache.setUser(userID, access, generation)
+	return access, nil
+}
+
+// rolePermissions returns the permissions granted by roles, loading every
+// uncached role with a single query. roles are not expanded.
+func (rs *RBACService) rolePermissions(roles []string, generation uint64) (*permissionSet, error) {
+	granted := newPermissionSet()
+	var missing []string
+	for _, role := range roles {
+		access, _ := rs.cache.role(role)
+		if access == nil {
+			missing = append(missing, role)
+			continue
+		}
+		granted.merge(access.permissions)
+	}
+	if len(missing) == 0 {
+		return granted, nil
+	}
+	
+	var rows []RolePermission
+	if err := rs.db.Where("role IN ?", missing).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	
+	loaded := make(map[string]*roleAccess, len(missing))
+	for _, role := range missing {
+		loaded[role] = &roleAccess{permissions: newPermissionSet()}
+	}
+	for _, row := range rows {
+		loaded[row.Role].permissions.add(Permission(row.Permission))
+	}
+	
+	for role, access := range loaded {
+		rs.cache.setRole(role, access, generation)
+		granted.merge(access.permissions)
+	}
+	return granted, nil
+}
+
+// roleHierarchy returns the inheritance between all roles, read with a
+// single query on a cache miss
+func (rs *RBACService) roleHierarchy(generation uint64) (*roleHierarchy, error) {
+	if hierarchy, _ := rs.cache.roleHierarchy(); hierarchy != nil {
+		return hierarchy, nil
+	}
+	
+	var rows []RoleParent
+	if err := rs.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	
+	hierarchy := newRoleHierarchy(rows)
+	rs.cache.setRoleHierarchy(hierarchy, generation)
+	return hierarchy, nil
+}
+
+func newRoleHierarchy(rows []RoleParent) *roleHierarchy {
+	hierarchy := &roleHierarchy{parents: make(map[string][]string)}
+	for _, row := range rows {
+		hierarchy.parents[row.Role] = append(hierarchy.parents[row.Role], row.Parent)
+	}
+	return hierarchy
+}
+
+// expand returns roles followed by every role they inherit from, each once.
+// Roles already visited are skipped, so a cycle stored by a concurrent
+// AddRoleParent cannot loop forever.
+func (h *roleHierarchy) expand(roles []string) []string {
+	expanded := make([]string, 0, len(roles))
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		if !seen[role] {
+			seen[role] = true
+			expanded = append(expanded, role)
+		}
+	}
+	for i := 0; i < len(expanded); i++ {
+		for _, parent := range h.parents[expanded[i]] {
+			if !seen[parent] {
+				seen[parent] = true
+				expanded = append(expanded, parent)
+			}
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultPermissionCacheTTL bounds how long another instance's role and
+// permission changes can take to apply; changes made through this
+// RBACService apply immediately.
+const DefaultPermissionCacheTTL = time.Minute
+
+// maxCachedEntries triggers a sweep of expired entries
+const maxCachedEntries = 10000
+
+// userAccess is the resolved roles and permissions of one user. roles
+// include the roles inherited from the assigned ones.
+type userAccess struct {
+	roles       []string
+	permissions *permissionSet
+	expiresAt   time.Time
+}
+
+func (a *userAccess) hasRole(role Role) bool {
+	for _, r := range a.roles {
+		if r == string(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionCache keeps resolved access per user and the permissions of
+// each role in process memory. Every invalidation bumps the generation, so
+// a lookup that raced with a change does not store its stale result.
+type permissionCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	generation uint64
+	users      map[uint]*userAccess
+	roles      map[string]*roleAccess
+	hierarchy  *roleHierarchy
+}
+
+type roleAccess struct {
+	permissions *permissionSet
+	expiresAt   time.Time
+}
+
+// roleHierarchy maps each role to the roles it inherits from
+type roleHierarchy struct {
+	parents   map[string][]string
+	expiresAt time.Time
+}
+
+func newPermissionCache(ttl time.Duration) *permissionCache {
+	return &permissionCache{
+		ttl:   ttl,
+		users: make(map[uint]*userAccess),
+		roles: make(map[string]*roleAccess),
+	}
+}
+
+// user returns the cached access of userID and the current generation
+func (pc *permissionCache) user(userID uint) (*userAccess, uint64) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	access, ok := pc.users[userID]
+	if !ok || time.Now().After(access.expiresAt) {
+		return nil, pc.generation
+	}
+	return access, pc.generation
+}
+
+func (pc *permissionCache) setUser(userID uint, access *userAccess, generation uint64) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.ttl <= 0 || generation != pc.generation {
+		return
+	}
+	if len(pc.users) >= maxCachedEntries {
+		pc.sweep(time.Now())
+	}
+	access.expiresAt = time.Now().Add(pc.ttl)
+	pc.users[userID] = access
+}
+
+func (pc *permissionCache) role(role string) (*roleAccess, uint64) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	access, ok := pc.roles[role]
+	if !ok || time.Now().After(access.expiresAt) {
+		return nil, pc.generation
+	}
+	return access, pc.generation
+}
+
+func (pc *permissionCache) setRole(role string, access *roleAccess, generation uint64) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.ttl <= 0 || generation != pc.generation {
+		return
+	}
+	access.expiresAt = time.Now().Add(pc.ttl)
+	pc.roles[role] = access
+}
+
+func (pc *permissionCache) roleHierarchy() (*roleHierarchy, uint64) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.hierarchy == nil || time.Now().After(pc.hierarchy.expiresAt) {
+		return nil, pc.generation
+	}
+	return pc.hierarchy, pc.generation
+}
+
+func (pc *permissionCache) setRoleHierarchy(hierarchy *roleHierarchy, generation uint64) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.ttl <= 0 || generation != pc.generation {
+		return
+	}
+	hierarchy.expiresAt = time.Now().Add(pc.ttl)
+	pc.hierarchy = hierarchy
+}
+
+// invalidateUser forgets the access of one user, e.g. after a role change
+func (pc *permissionCache) invalidateUser(userID uint) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.generation++
+	delete(pc.users, userID)
+}
+
+// invalidateAll forgets everything, e.g. after a role's permissions or
+// parents changed
+func (pc *permissionCache) invalidateAll() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.reset()
+}
+
+func (pc *permissionCache) setTTL(ttl time.Duration) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.ttl = ttl
+	pc.reset()
+}
+
+// reset drops every entry; the caller holds the lock
+func (pc *permissionCache) reset() {
+	pc.generation++
+	pc.users = make(map[uint]*userAccess)
+	pc.roles = make(map[string]*roleAccess)
+	pc.hierarchy = nil
+}
+
+// sweep drops expired entries; the caller holds the lock
+func (pc *permissionCache) sweep(now time.Time) {
+	for userID, access := range pc.users {
+		if now.After(access.expiresAt) {
+			delete(pc.users, userID)
+		}
+	}
+	for role, access := range pc.roles {
+		if now.After(access.expiresAt) {
+			delete(pc.roles, role)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go-crud/models"
+)
+
+// newTestRBAC returns an RBACService with the default roles and users
+// holding each of roles, in order
+func newTestRBAC(tb testing.TB, roles ...Role) (*RBACService, []uint) {
+	tb.Helper()
+
+	db := openTestDB(tb)
+	rs := NewRBACService(db)
+	if err := rs.InitializeDefaultRoles(); err != nil {
+		tb.Fatal(err)
+	}
+
+	var userIDs []uint
+	for i, role := range roles {
+		user := models.User{Username: "user" + string(rune('a'+i)), Email: string(rune('a'+i)) + "@example.com", Password: "x", IsActive: true}
+		if err := db.Create(&user).Error; err != nil {
+			tb.Fatal(err)
+		}
+		if err := rs.AssignRole(user.ID, role); err != nil {
+			tb.Fatal(err)
+		}
+		userIDs = append(userIDs, user.ID)
+	}
+	return rs, userIDs
+}
+
+func TestRoleChangesRevokeAccessTokens(t *testing.T) {
+	rs, users := newTestRBAC(t, Admin, User, Guest)
+	admin, user, guest := users[0], users[1], users[2]
+
+	if _, err := rs.CreateRole("editor", "", []Role{Guest}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.CreateRole("reader", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.AssignRole(guest, "editor"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func() error
+		changed []uint
+	}{
+		{"assign", func() error { return rs.AssignRole(user, "editor") }, []uint{user}},
+		{"assign again", func() error { return rs.AssignRole(user, "editor") }, nil},
+		{"remove", func() error { return rs.RemoveRole(admin, Admin) }, []uint{admin}},
+		{"remove unassigned", func() error { return rs.RemoveRole(admin, Admin) }, nil},
+		{"add parent", func() error { return rs.AddRoleParent("editor", User) }, []uint{user, guest}},
+		{"add parent again", func() error { return rs.AddRoleParent("editor", User) }, nil},
+		{"remove parent", func() error { return rs.RemoveRoleParent("editor", User) }, []uint{user, guest}},
+		{"add parent to inherited role", func() error { return rs.AddRoleParent(Guest, "reader") }, []uint{user, guest}},
+		{"permission", func() error { return rs.AddPermission("editor", ManageSystem) }, nil},
+		{"delete role", func() error { return rs.DeleteRole("editor") }, []uint{user, guest}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changed []uint
+			rs.OnRolesChanged(func(userIDs ...uint) error {
+				changed = append(changed, userIDs...)
+				return nil
+			})
+
+			if err := tt.change(); err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(changed)
+			if !slices.Equal(changed, tt.changed) {
+				t.Errorf("changed users = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestRemovedRoleRevokesIssuedTokens(t *testing.T) {
+	rs, users := newTestRBAC(t, Admin)
+	admin := users[0]
+
+	as := NewAuthService("secret")
+	as.SetRoleProvider(rs)
+	rs.OnRolesChanged(as.RevokeAccessTokens)
+
+	// Issued before the change; iat has whole-second precision
+	claims := claimsIssuedAt(admin, "issued-before", time.Now().Add(-time.Minute))
+	claims.Roles = []string{string(Admin)}
+
+	if revoked, _ := as.IsRevoked(&claims); revoked {
+		t.Fatal("token revoked before the role change")
+	}
+	if err := rs.RemoveRole(admin, Admin); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := as.IsRevoked(&claims); !revoked {
+		t.Error("token carrying the removed role is still accepted")
+	}
+}
+
+func TestRoleChangesInvalidatePermissionCache(t *testing.T) {
+	rs, users := newTestRBAC(t, Guest)
+	user := users[0]
+
+	steps := []struct {
+		name   string
+		change func() error
+		want   bool
+	}{
+		{"add permission to unassigned role", func() error { return rs.AddPermission("editor", UpdatePost) }, false},
+		{"assign role", func() error { return rs.AssignRole(user, "editor") }, true},
+		{"remove role", func() error { return rs.RemoveRole(user, "editor") }, false},
+		{"add permission to assigned role", func() error { return rs.AddPermission(Guest, UpdatePost) }, true},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			// Warm the cache, and start a lookup that races with the change
+			if _, err := rs.HasPermission(user, UpdatePost); err != nil {
+				t.Fatal(err)
+			}
+			_, before := rs.cache.user(user)
+
+			if err := step.change(); err != nil {
+				t.Fatal(err)
+			}
+
+			access, after := rs.cache.user(user)
+			if after <= before {
+				t.Errorf("generation = %d, want more than %d", after, before)
+			}
+			if access != nil {
+				t.Error("access cached before the change is still cached")
+			}
+
+			// The racing lookup finishes with what it read before the change
+			rs.cache.setUser(user, &userAccess{permissions: newPermissionSet()}, before)
+			if access, _ := rs.cache.user(user); access != nil {
+				t.Error("stale access stored after the change")
+			}
+
+			if allowed, err := rs.HasPermission(user, UpdatePost); err != nil || allowed != step.want {
+				t.Errorf("HasPermission = %v, %v, want %v", allowed, err, step.want)
+			}
+		})
+	}
+}
+
+// hasPermissionPerRole resolves permissions the way HasPermission did before
+// the cache: one query for the user's roles, then one per role
+func hasPermissionPerRole(rs *RBACService, userID uint, permission Permission) (bool, error) {
+	var roles []string
+	if err := rs.db.Model(&UserRole{}).Where("user_id = ?", userID).Pluck("role", &roles).Error; err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		var count int64
+		if err := rs.db.Model(&RolePermission{}).Where("role = ? AND permission = ?", role, string(permission)).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BenchmarkHasPermission checks a permission none of a user's five roles
+// grants, so every role has to be looked at
+func BenchmarkHasPermission(b *testing.B) {
+	rs, users := newTestRBAC(b, Guest)
+	user := users[0]
+
+	for _, name := range []Role{"author", "editor", "moderator", "reviewer"} {
+		for _, permission := range []Permission{ReadPost, UpdatePost, UpdateComment} {
+			if err := rs.AddPermission(name, permission); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := rs.AssignRole(user, name); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	benchmarks := []struct {
+		name    string
+		ttl     time.Duration
+		resolve func(userID uint, permission Permission) (bool, error)
+	}{
+		{"query per role", 0, func(userID uint, permission Permission) (bool, error) {
+			return hasPermissionPerRole(rs, userID, permission)
+		}},
+		{"uncached", 0, rs.HasPermission},
+		{"cached", DefaultPermissionCacheTTL, rs.HasPermission},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			rs.SetCacheTTL(bm.ttl)
+			for i := 0; i < b.N; i++ {
+				if allowed, err := bm.resolve(user, ManageSystem); err != nil || allowed {
+					b.Fatalf("HasPermission = %v, %v", allowed, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRoleInheritance(t *testing.T) {
+	rs, users := newTestRBAC(t, Admin, User, Guest)
+	admin, user, guest := users[0], users[1], users[2]
+
+	tests := []struct {
+		userID     uint
+		permission Permission
+		want       bool
+	}{
+		{guest, ReadPost, true},
+		{guest, CreatePost, false},
+		{user, ReadPost, true}, // from guest
+		{user, DeleteComment, true},
+		{user, ManageSystem, false},
+		{admin, ReadComment, true},
+		{admin, DeleteUser, true},
+		{admin, ManageSystem, true},
+	}
+	for _, tt := range tests {
+		if allowed, err := rs.HasPermission(tt.userID, tt.permission); err != nil || allowed != tt.want {
+			t.Errorf("user %d %s: HasPermission = %v, %v, want %v", tt.userID, tt.permission, allowed, err, tt.want)
+		}
+	}
+
+	roles, err := rs.GetUserRoles(admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(roles, []string{"admin", "user", "guest"}) {
+		t.Errorf("admin roles = %v, want admin, user, guest", roles)
+	}
+	if ok, _ := rs.HasRole(user, Guest); !ok {
+		t.Error("user does not have the inherited guest role")
+	}
+	if ok, _ := rs.HasRole(user, Admin); ok {
+		t.Error("user has the admin role")
+	}
+
+	// Removing an edge takes the inherited permissions with it
+	if err := rs.RemoveRoleParent(User, Guest); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _ := rs.HasPermission(user, ReadPost); !allowed {
+		t.Error("read:post lost although *:post is granted directly")
+	}
+	if ok, _ := rs.HasRole(user, Guest); ok {
+		t.Error("guest role still inherited after removing the edge")
+	}
+}
+
+func TestAddRoleParentRejectsCycles(t *testing.T) {
+	rs, _ := newTestRBAC(t)
+
+	for _, edge := range [][2]Role{
+		{Guest, Admin}, // admin -> user -> guest
+		{User, Admin},
+		{Guest, Guest},
+	} {
+		if err := rs.AddRoleParent(edge[0], edge[1]); !errors.Is(err, ErrRoleCycle) {
+			t.Errorf("%s inheriting from %s: err = %v, want %v", edge[0], edge[1], err, ErrRoleCycle)
+		}
+	}
+	if parents, _ := rs.GetRoleParents(Guest); len(parents) != 0 {
+		t.Errorf("guest parents = %v after rejected edges", parents)
+	}
+
+	// A second path to the same role is no cycle, and adding it twice is a no-op
+	for i := 0; i < 2; i++ {
+		if err := rs.AddRoleParent(Admin, Guest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if parents, _ := rs.GetRoleParents(Admin); !slices.Equal(parents, []string{"guest", "user"}) {
+		t.Errorf("admin parents = %v, want guest, user", parents)
+	}
+}
+
+func TestRoleHierarchyExpandStopsAtCycles(t *testing.T) {
+	// A cycle can only be stored by racing writers; expansion must still end
+	hierarchy := newRoleHierarchy([]RoleParent{
+		{Role: "a", Parent: "b"},
+		{Role: "b", Parent: "c"},
+		{Role: "c", Parent: "a"},
+		{Role: "c", Parent: "d"},
+	})
+	if got := hierarchy.expand([]string{"b", "b"}); !slices.Equal(got, []string{"b", "c", "a", "d"}) {
+		t.Errorf("expand = %v, want b, c, a, d", got)
+	}
+}
+
+func TestPermissionWildcards(t *testing.T) {
+	tests := []struct {
+		held     Permission
+		required Permission
+		want     bool
+	}{
+		{ReadPost, ReadPost, true},
+		{ReadPost, ReadComment, false},
+		{"*:post", DeletePost, true},
+		{"*:post", DeleteComment, false},
+		{"read:*", ReadUser, true},
+		{"read:*", UpdateUser, false},
+		{AnyPermission, ManageSystem, true},
+		{"*", ReadPost, false},
+	}
+	for _, tt := range tests {
+		if got := tt.held.Matches(tt.required); got != tt.want {
+			t.Errorf("%s matches %s = %v, want %v", tt.held, tt.required, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"*:post", "read:*", "*:*"} {
+		if _, err := ParsePermission(s); err != nil {
+			t.Errorf("ParsePermission(%q): %v", s, err)
+		}
+	}
+	for _, s := range []string{"*:plane", "fly:*", "*", "read:post:*"} {
+		if _, err := ParsePermission(s); err == nil {
+			t.Errorf("ParsePermission(%q) accepted", s)
+		}
+	}
+}
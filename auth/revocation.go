@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"fmt"
+	"go-crud/models"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevocationStore is a denylist of access tokens checked on every
+// authenticated request. Entries only need to outlive the tokens they revoke.
+type RevocationStore interface {
+	// RevokeToken revokes the access token with the given jti until it expires
+	RevokeToken(tokenID string, expiresAt time.Time) error
+	// RevokeUserTokens revokes every access token of userID issued up to the
+	// current millisecond (see revocationCutoff). until is the latest time any
+	// of those tokens can still be accepted.
+	RevokeUserTokens(userID uint, until time.Time) error
+	// IsRevoked reports whether the token described by claims was revoked
+	IsRevoked(claims *Claims) (bool, error)
+}
+
+// MemoryRevocationStore keeps revocations in process memory. It is suitable
+// for a single instance; revocations are lost on restart.
+type MemoryRevocationStore struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time    // jti -> token expiry
+	users  map[uint]userRevocation // user id -> revocation of all tokens
+}
+
+type userRevocation struct {
+	cutoff time.Time
+	until  time.Time
+}
+
+func init() {
+	// Access tokens are issued in whole milliseconds (see GenerateToken).
+	// Numeric dates are encoded in microseconds so that parsing the JSON
+	// number cannot truncate iat into the previous millisecond.
+	jwt.TimePrecision = time.Microsecond
+}
+
+// revocationCutoff returns the issue time up to which the tokens of a user
+// are revoked by a revocation at now. Milliseconds are the finest precision
+// every supported database keeps, so both the cutoff and iat are truncated
+// to them, and tokens issued within the cutoff millisecond are revoked too;
+// AuthService.RevokeAccessTokens waits for the next millisecond, so tokens
+// issued after a revocation has returned stay valid.
+func revocationCutoff(now time.Time) time.Time {
+	return now.Truncate(time.Millisecond)
+}
+
+// issuedAt returns the iat of claims, or the zero time without one. A parsed
+// iat can fall a microsecond short of its millisecond by float rounding, so
+// it is rounded to the millisecond it was issued in.
+func issuedAt(claims *Claims) time.Time {
+	if claims.IssuedAt == nil {
+		return time.Time{}
+	}
+	return claims.IssuedAt.Time.Round(time.Millisecond)
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	s := &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[uint]userRevocation),
+	}
+
+	// Start cleanup goroutine
+	go s.cleanup()
+
+	return s
+}
+
+func (s *MemoryRevocationStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeUserTokens(userID uint, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[userID] = userRevocation{cutoff: revocationCutoff(time.Now()), until: until}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(claims *Claims) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[claims.ID]; ok && claims.ID != "" {
+		return true, nil
+	}
+
+	if revocation, ok := s.users[claims.UserID]; ok {
+		return !issuedAt(claims).After(revocation.cutoff), nil
+	}
+
+	return false, nil
+}
+
+func (s *MemoryRevocationStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+
+		for tokenID, expiresAt := range s.tokens {
+			if now.After(expiresAt) {
+				delete(s.tokens, tokenID)
+			}
+		}
+
+		for userID, revocation := range s.users {
+			if now.After(revocation.until) {
+				delete(s.users, userID)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// DBRevocationStore keeps revocations in the revoked_tokens table so they are
+// shared between instances and survive restarts
+type DBRevocationStore struct {
+	db *gorm.DB
+}
+
+func NewDBRevocationStore(db *gorm.DB) *DBRevocationStore {
+	return &DBRevocationStore{db: db}
+}
+
+func (s *DBRevocationStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	entry := models.RevokedToken{TokenID: &tokenID, ExpiresAt: expiresAt}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func (s *DBRevocationStore) RevokeUserTokens(userID uint, until time.Time) error {
+	cutoff := revocationCutoff(time.Now())
+	entry := models.RevokedToken{
+		UserID:       &userID,
+		IssuedBefore: &cutoff,
+		ExpiresAt:    until,
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *DBRevocationStore) IsRevoked(claims *Claims) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.RevokedToken{}).
+		Where("expires_at > ?", time.Now()).
+		Where(s.db.Where("token_id = ?", claims.ID).
+			Or("user_id = ? AND issued_before >= ?", claims.UserID, issuedAt(claims))).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return count > 0, nil
+}
+
+// PurgeExpired deletes entries whose tokens have expired
+func (s *DBRevocationStore) PurgeExpired() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&models.RevokedToken{}).Error
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"go-crud/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+func TestRevocationStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) (RevocationStore, func(userID uint) time.Time){
+		"memory": func(t *testing.T) (RevocationStore, func(uint) time.Time) {
+			store := NewMemoryRevocationStore()
+			return store, func(userID uint) time.Time {
+				return store.users[userID].cutoff
+			}
+		},
+		"db": func(t *testing.T) (RevocationStore, func(uint) time.Time) {
+			db := openTestDB(t)
+			return NewDBRevocationStore(db), func(userID uint) time.Time {
+				var entry models.RevokedToken
+				if err := db.Where("user_id = ?", userID).First(&entry).Error; err != nil {
+					t.Fatal(err)
+				}
+				return *entry.IssuedBefore
+			}
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, cutoffOf := newStore(t)
+
+			if err := store.RevokeToken("revoked-jti", time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.RevokeUserTokens(1, time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			cutoff := cutoffOf(1)
+			if !cutoff.Equal(cutoff.Truncate(time.Millisecond)) {
+				t.Fatalf("cutoff %v is not in whole milliseconds", cutoff)
+			}
+
+			tests := []struct {
+				name    string
+				claims  Claims
+				revoked bool
+			}{
+				{"revoked jti", claimsIssuedAt(2, "revoked-jti", cutoff), true},
+				{"other jti", claimsIssuedAt(2, "other-jti", cutoff.Add(-time.Minute)), false},
+				{"issued a millisecond before", claimsIssuedAt(1, "a", cutoff.Add(-time.Millisecond)), true},
+				{"issued within the revocation millisecond", claimsIssuedAt(1, "b", cutoff), true},
+				{"issued a millisecond after", claimsIssuedAt(1, "c", cutoff.Add(time.Millisecond)), false},
+				{"without iat", Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{ID: "d"}}, true},
+				{"other user", claimsIssuedAt(2, "e", cutoff.Add(-time.Minute)), false},
+			}
+			for _, tt := range tests {
+				revoked, err := store.IsRevoked(&tt.claims)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if revoked != tt.revoked {
+					t.Errorf("%s: revoked = %v, want %v", tt.name, revoked, tt.revoked)
+				}
+			}
+		})
+	}
+}
+
+func TestRevokeUserTokensEndsSessions(t *testing.T) {
+	as, db, user := newSessionTest(t)
+
+	pair, err := as.CreateSession(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := as.ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := as.RevokeUserTokens(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := as.IsRevoked(claims); err != nil || !revoked {
+		t.Errorf("access token: revoked = %v, %v, want revoked", revoked, err)
+	}
+	if !familyRevoked(t, db, pair.SessionID) {
+		t.Error("session still active after revoking the user's tokens")
+	}
+}
+
+func TestRevocationCoversTokensOfTheSameSecond(t *testing.T) {
+	stores := map[string]func(db *gorm.DB) RevocationStore{
+		"memory": func(*gorm.DB) RevocationStore { return NewMemoryRevocationStore() },
+		"db":     func(db *gorm.DB) RevocationStore { return NewDBRevocationStore(db) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			as, db, user := newSessionTest(t)
+			as.SetRevocationStore(newStore(db))
+
+			issue := func() *Claims {
+				t.Helper()
+				token, err := as.GenerateToken(user, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				claims, err := as.ValidateToken(token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return claims
+			}
+
+			// Issued and revoked well within one second
+			before := issue()
+			if err := as.RevokeAccessTokens(user.ID); err != nil {
+				t.Fatal(err)
+			}
+			if revoked, err := as.IsRevoked(before); err != nil || !revoked {
+				t.Errorf("token issued before the revocation: revoked = %v, %v, want revoked", revoked, err)
+			}
+
+			if revoked, err := as.IsRevoked(issue()); err != nil || revoked {
+				t.Errorf("token issued after the revocation: revoked = %v, %v, want valid", revoked, err)
+			}
+		})
+	}
+}
+
+// claimsIssuedAt encodes iat the way issued tokens do, in milliseconds
+func claimsIssuedAt(userID uint, tokenID string, issuedAt time.Time) Claims {
+	return Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       tokenID,
+			IssuedAt: jwt.NewNumericDate(issuedAt),
+		},
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-crud/config"
+	"go-crud/logging"
+	"go-crud/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// ClientInfo describes the client a session is issued to
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// TokenPair is the access and refresh token issued on login or refresh
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // access token lifetime in seconds
+	SessionID    string
+}
+
+// CreateSession starts a new session family for user and issues its first
+// token pair
+func (as *AuthService) CreateSession(user *models.User, client ClientInfo) (*TokenPair, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	return as.issueSession(config.DB, user, familyID, client)
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. The presented
+// token is consumed; presenting it again means it was stolen or replayed, so
+// every session of its family is revoked.
+func (as *AuthService) RefreshToken(refreshToken string, client ClientInfo) (*TokenPair, error) {
+	var pair *TokenPair
+	var session models.Session
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", hashToken(refreshToken)).First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Only one request can consume a token, even when two race
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND rotated_at IS NULL", session.ID).
+			Update("rotated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var user models.User
+		if err := tx.First(&user, session.UserID).Error; err != nil || !user.IsActive {
+			return ErrInvalidRefreshToken
+		}
+
+		var err error
+		pair, err = as.issueSession(tx, &user, session.FamilyID, client)
+		return err
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		logging.GetLogger().LogAuthEvent("refresh_token_reuse", "", session.UserID, false, client.IPAddress)
+		if revokeErr := as.RevokeSession(session.FamilyID); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// RevokeSession revokes every refresh token of a session family
+func (as *AuthService) RevokeSession(familyID string) error {
+	err := config.DB.Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every refresh token of a user
+func (as *AuthService) RevokeUserSessions(userID uint) error {
+	err := config.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+func (as *AuthService) issueSession(tx *gorm.DB, user *models.User, familyID string, client ClientInfo) (*TokenPair, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := client.UserAgent
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	session := models.Session{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		UserAgent: userAgent,
+		IPAddress: client.IPAddress,
+		ExpiresAt: time.Now().Add(as.options.RefreshTTL),
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	accessToken, err := as.GenerateToken(user, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(as.options.AccessTTL / time.Second),
+		SessionID:    familyID,
+	}, nil
+}
+
+// hashToken returns the hex encoded SHA-256 of a refresh token. Refresh
+// tokens are random, so a fast unsalted hash is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
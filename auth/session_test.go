@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-crud/models"
+
+	"gorm.io/gorm"
+)
+
+// newSessionTest returns an auth service and an active user on a fresh database
+func newSessionTest(t *testing.T) (*AuthService, *gorm.DB, *models.User) {
+	t.Helper()
+
+	db := openTestDB(t)
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthService("secret"), db, user
+}
+
+// familyRevoked reports whether every session of the family is revoked
+func familyRevoked(t *testing.T, db *gorm.DB, familyID string) bool {
+	t.Helper()
+
+	var active int64
+	if err := db.Model(&models.Session{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Count(&active).Error; err != nil {
+		t.Fatal(err)
+	}
+	return active == 0
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	as, db, user := newSessionTest(t)
+	client := ClientInfo{UserAgent: "test", IPAddress: "192.0.2.1"}
+
+	first, err := as.CreateSession(user, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := as.CreateSession(user, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := as.RefreshToken(first.RefreshToken, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.SessionID != first.SessionID {
+		t.Fatalf("rotated pair = %+v, want a new refresh token in session %s", second, first.SessionID)
+	}
+	claims, err := as.ValidateToken(second.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != user.ID || claims.SessionID != first.SessionID {
+		t.Errorf("access token claims = %+v", claims)
+	}
+
+	third, err := as.RefreshToken(second.RefreshToken, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying a consumed token revokes the whole family, including the
+	// tokens issued after it
+	if _, err := as.RefreshToken(first.RefreshToken, client); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if !familyRevoked(t, db, first.SessionID) {
+		t.Error("family still has active sessions after a replay")
+	}
+	if _, err := as.RefreshToken(third.RefreshToken, client); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("latest token after replay: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	// Other logins of the user are not affected
+	if familyRevoked(t, db, other.SessionID) {
+		t.Error("replay revoked an unrelated session family")
+	}
+	if _, err := as.RefreshToken(other.RefreshToken, client); err != nil {
+		t.Errorf("unrelated session: %v", err)
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	as, db, user := newSessionTest(t)
+
+	tests := []struct {
+		name  string
+		setup func(pair *TokenPair)
+	}{
+		{"expired", func(pair *TokenPair) {
+			db.Model(&models.Session{}).Where("family_id = ?", pair.SessionID).Update("expires_at", time.Now().Add(-time.Minute))
+		}},
+		{"revoked", func(pair *TokenPair) {
+			if err := as.RevokeSession(pair.SessionID); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"all sessions of the user revoked", func(pair *TokenPair) {
+			if err := as.RevokeUserSessions(user.ID); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"deactivated user", func(pair *TokenPair) {
+			db.Model(user).Update("is_active", false)
+			t.Cleanup(func() { db.Model(user).Update("is_active", true) })
+		}},
+		{"unknown token", func(pair *TokenPair) {
+			pair.RefreshToken = "not-a-token"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, err := as.CreateSession(user, ClientInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(pair)
+
+			if _, err := as.RefreshToken(pair.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidRefreshToken)
+			}
+		})
+	}
+}
+
+func TestConcurrentRefreshTokenRotation(t *testing.T) {
+	as, db, user := newSessionTest(t)
+
+	// SQLite takes one writer at a time; without this the losers would fail
+	// with "database table is locked" instead of reaching the rotation guard
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	pair, err := as.CreateSession(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 8
+	errs := make([]error, requests)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = as.RefreshToken(pair.RefreshToken, ClientInfo{})
+		}(i)
+	}
+	wg.Wait()
+
+	// The first loser detects the reuse and revokes the family; losers that
+	// look the token up after that find it revoked
+	var succeeded, reused int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrRefreshTokenReused):
+			reused++
+		case !errors.Is(err, ErrInvalidRefreshToken):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 || reused == 0 {
+		t.Errorf("%d succeeded and %d detected reuse, want 1 and at least 1", succeeded, reused)
+	}
+	if !familyRevoked(t, db, pair.SessionID) {
+		t.Error("family still has active sessions after concurrent reuse")
+	}
+}
+
+// TestRefreshTokenRotationRace lets a competing refresh rotate the token
+// between the lookup and the rotation of another refresh, which only the
+// rotated_at IS NULL guard on the update can catch
+func TestRefreshTokenRotationRace(t *testing.T) {
+	as, db, user := newSessionTest(t)
+
+	pair, err := as.CreateSession(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raced := false
+	err = db.Callback().Update().Before("gorm:update").Register("test:competing_refresh", func(tx *gorm.DB) {
+		updates, ok := tx.Statement.Dest.(map[string]interface{})
+		if _, rotating := updates["rotated_at"]; !ok || !rotating || raced {
+			return
+		}
+		raced = true
+		tx.Statement.ConnPool.ExecContext(tx.Statement.Context,
+			"UPDATE sessions SET rotated_at = ? WHERE family_id = ?", time.Now(), pair.SessionID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Callback().Update().Remove("test:competing_refresh") })
+
+	if _, err := as.RefreshToken(pair.RefreshToken, ClientInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if !raced {
+		t.Fatal("the competing refresh did not run")
+	}
+	if !familyRevoked(t, db, pair.SessionID) {
+		t.Error("family still has active sessions after losing the race")
+	}
+}
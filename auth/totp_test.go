@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1, truncated to six digits
+func TestGenerateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := GenerateTOTP(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.want {
+			t.Errorf("GenerateTOTP at %d = %s, want %s", tt.unix, code, tt.want)
+		}
+	}
+
+	// Authenticator apps show secrets in lowercase groups
+	spaced := strings.ToLower(secret[:4] + " " + secret[4:])
+	if code, err := GenerateTOTP(spaced, time.Unix(59, 0)); err != nil || code != "287082" {
+		t.Errorf("GenerateTOTP with a formatted secret = %s, %v", code, err)
+	}
+	if _, err := GenerateTOTP("not base32!", time.Now()); err == nil {
+		t.Error("GenerateTOTP accepted an invalid secret")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		valid  bool
+		offset int64 // of the returned counter from the current step
+	}{
+		{"current step", now, true, 0},
+		{"previous step", now.Add(-totpPeriod), true, -1},
+		{"next step", now.Add(totpPeriod), true, 1},
+		{"two steps ago", now.Add(-2 * totpPeriod), false, 0},
+		{"two steps ahead", now.Add(2 * totpPeriod), false, 0},
+	}
+	for _, tt := range tests {
+		code, _ := GenerateTOTP(secret, tt.at)
+		counter, ok := verifyTOTP(secret, code, now)
+		if ok != tt.valid {
+			t.Errorf("%s: valid = %v, want %v", tt.name, ok, tt.valid)
+		}
+		if ok && counter != totpCounter(now)+tt.offset {
+			t.Errorf("%s: counter = %d, want %d", tt.name, counter, totpCounter(now)+tt.offset)
+		}
+	}
+
+	if _, ok := verifyTOTP(secret, "12345", now); ok {
+		t.Error("accepted a five digit code")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Go CRUD", "alice@example.com", "SECRET"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Go CRUD:alice@example.com" {
+		t.Errorf("URI = %s", uri)
+	}
+	query := uri.Query()
+	for key, want := range map[string]string{"secret": "SECRET", "issuer": "Go CRUD", "digits": "6", "period": "30", "algorithm": "SHA1"} {
+		if got := query.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JWTConfig holds token signing and validation configuration
+type JWTConfig struct {
+	Secret           string
+	Algorithm        string   // HS256, RS256, ES256, EdDSA, ...
+	PrivateKeyFiles  []string // PEM keys for asymmetric algorithms, oldest first
+	RotationInterval time.Duration
+
+	Issuer     string
+	Audience   []string // the first audience identifies this API
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Leeway     time.Duration // tolerated clock skew
+
+	MFAChallengeTTL time.Duration // time to enter the second factor after the password
+}
+
+// LoadJWTConfig loads JWT configuration from environment variables.
+// JWT_PRIVATE_KEY_FILES is a comma separated list; the file name without
+// extension is used as the key id and the last key signs new tokens. With an
+// asymmetric algorithm and no key files, a key is generated at startup and,
+// if JWT_KEY_ROTATION_HOURS is set, replaced on that schedule.
+// JWT_EXPIRE_HOURS is honoured as the access token lifetime when
+// JWT_ACCESS_TTL is not set.
+func LoadJWTConfig() *JWTConfig {
+	rotationHours, _ := strconv.Atoi(getEnv("JWT_KEY_ROTATION_HOURS", "0"))
+
+	accessTTL := 15 * time.Minute
+	if hours, err := strconv.Atoi(getEnv("JWT_EXPIRE_HOURS", "")); err == nil && hours > 0 {
+		accessTTL = time.Duration(hours) * time.Hour
+	}
+
+	return &JWTConfig{
+		Secret:           getEnv("JWT_SECRET", ""),
+		Algorithm:        getEnv("JWT_ALGORITHM", "HS256"),
+		PrivateKeyFiles:  splitEnvList(getEnv("JWT_PRIVATE_KEY_FILES", "")),
+		RotationInterval: time.Duration(rotationHours) * time.Hour,
+		Issuer:           getEnv("JWT_ISSUER", "go-crud"),
+		Audience:         splitEnvList(getEnv("JWT_AUDIENCE", "go-crud-api")),
+		AccessTTL:        getDurationEnv("JWT_ACCESS_TTL", accessTTL),
+		RefreshTTL:       getDurationEnv("JWT_REFRESH_TTL", 30*24*time.Hour),
+		Leeway:           getDurationEnv("JWT_LEEWAY", 30*time.Second),
+		MFAChallengeTTL:  getDurationEnv("MFA_CHALLENGE_TTL", 5*time.Minute),
+	}
+}
+
+// getDurationEnv parses a duration such as "15m" or "720h", falling back to
+// defaultValue when the variable is unset or invalid
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func splitEnvList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// LockoutConfig holds the brute-force protection settings of password login
+type LockoutConfig struct {
+	MaxAttempts int           // failed logins before an account is locked
+	BaseLockout time.Duration // first lockout, doubled by every further failure
+	MaxLockout  time.Duration
+
+	ClientMaxAttempts int // failed logins per IP address and email
+	ClientWindow      time.Duration
+}
+
+// LoadLockoutConfig loads lockout configuration from environment variables
+func LoadLockoutConfig() *LockoutConfig {
+	maxAttempts, err := strconv.Atoi(getEnv("LOGIN_MAX_ATTEMPTS", "5"))
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	clientMaxAttempts, err := strconv.Atoi(getEnv("LOGIN_CLIENT_MAX_ATTEMPTS", "10"))
+	if err != nil || clientMaxAttempts <= 0 {
+		clientMaxAttempts = 10
+	}
+
+	return &LockoutConfig{
+		MaxAttempts:       maxAttempts,
+		BaseLockout:       getDurationEnv("LOGIN_LOCKOUT_BASE", time.Minute),
+		MaxLockout:        getDurationEnv("LOGIN_LOCKOUT_MAX", time.Hour),
+		ClientMaxAttempts: clientMaxAttempts,
+		ClientWindow:      getDurationEnv("LOGIN_CLIENT_WINDOW", 15*time.Minute),
+	}
+}
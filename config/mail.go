@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// MailConfig holds outgoing mail and account email configuration
+type MailConfig struct {
+	Driver    string // smtp, file or memory
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	From      string
+	OutboxDir string // used by the file driver
+
+	AppURL               string // base URL of the links sent by email
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+}
+
+// LoadMailConfig loads mail configuration from environment variables. The
+// file driver writes messages to MAIL_OUTBOX_DIR instead of sending them.
+func LoadMailConfig() *MailConfig {
+	port, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+
+	return &MailConfig{
+		Driver:               getEnv("MAIL_DRIVER", "file"),
+		Host:                 getEnv("SMTP_HOST", "localhost"),
+		Port:                 port,
+		Username:             getEnv("SMTP_USERNAME", ""),
+		Password:             getEnv("SMTP_PASSWORD", ""),
+		From:                 getEnv("MAIL_FROM", "Go-CRUD <no-reply@localhost>"),
+		OutboxDir:            getEnv("MAIL_OUTBOX_DIR", "./outbox"),
+		AppURL:               getEnv("APP_URL", "http://localhost:8080"),
+		PasswordResetTTL:     getDurationEnv("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL: getDurationEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+	}
+}
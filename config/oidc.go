@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// OIDCConfig holds the OpenID Connect provider used for single sign-on.
+// Login federation is disabled while Issuer is empty.
+type OIDCConfig struct {
+	Issuer       string // discovery is read from Issuer/.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string // empty for public clients relying on PKCE alone
+	RedirectURL  string // the callback route of this API
+	Scopes       []string
+
+	AllowSignup bool          // create accounts for unknown users
+	StateTTL    time.Duration // time to complete the login at the provider
+}
+
+// Enabled reports whether an OIDC provider is configured
+func (c *OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+// LoadOIDCConfig loads OIDC configuration from environment variables.
+// OIDC_SCOPES is a comma separated list; "openid" is always requested.
+func LoadOIDCConfig() *OIDCConfig {
+	allowSignup, err := strconv.ParseBool(getEnv("OIDC_ALLOW_SIGNUP", "true"))
+	if err != nil {
+		allowSignup = true
+	}
+
+	return &OIDCConfig{
+		Issuer:       getEnv("OIDC_ISSUER", ""),
+		ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback"),
+		Scopes:       splitEnvList(getEnv("OIDC_SCOPES", "openid,email,profile")),
+		AllowSignup:  allowSignup,
+		StateTTL:     getDurationEnv("OIDC_STATE_TTL", 10*time.Minute),
+	}
+}
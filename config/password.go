@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strconv"
+)
+
+// PasswordConfig holds password hashing configuration. Hashes of the other
+// algorithm, or with other parameters, are upgraded on the next login.
+type PasswordConfig struct {
+	Algorithm string // argon2id or bcrypt
+
+	Argon2Memory      uint32 // KiB
+	Argon2Time        uint32
+	Argon2Parallelism uint8
+
+	BcryptCost int
+}
+
+// LoadPasswordConfig loads password hashing configuration from environment variables
+func LoadPasswordConfig() *PasswordConfig {
+	memory, err := strconv.ParseUint(getEnv("ARGON2_MEMORY_KB", "19456"), 10, 32)
+	if err != nil || memory == 0 {
+		memory = 19456
+	}
+	iterations, err := strconv.ParseUint(getEnv("ARGON2_TIME", "2"), 10, 32)
+	if err != nil || iterations == 0 {
+		iterations = 2
+	}
+	parallelism, err := strconv.ParseUint(getEnv("ARGON2_PARALLELISM", "1"), 10, 8)
+	if err != nil || parallelism == 0 {
+		parallelism = 1
+	}
+	cost, err := strconv.Atoi(getEnv("BCRYPT_COST", "10"))
+	if err != nil {
+		cost = 10
+	}
+
+	return &PasswordConfig{
+		Algorithm:         getEnv("PASSWORD_HASH", "argon2id"),
+		Argon2Memory:      uint32(memory),
+		Argon2Time:        uint32(iterations),
+		Argon2Parallelism: uint8(parallelism),
+		BcryptCost:        cost,
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"strconv"
+)
+
+// PolicyConfig holds the resource policies evaluated by the policy engine
+type PolicyConfig struct {
+	RulesFile    string // JSON array of rules added to the defaults; optional
+	DefaultRules bool   // admins and authors may change posts and comments
+}
+
+// LoadPolicyConfig loads policy configuration from environment variables
+func LoadPolicyConfig() *PolicyConfig {
+	defaultRules, err := strconv.ParseBool(getEnv("POLICY_DEFAULT_RULES", "true"))
+	if err != nil {
+		defaultRules = true
+	}
+
+	return &PolicyConfig{
+		RulesFile:    getEnv("POLICY_RULES_FILE", ""),
+		DefaultRules: defaultRules,
+	}
+}
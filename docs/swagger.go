@@ -11,6 +11,8 @@ type UserResponse struct {
 	IsActive  bool   `json:"is_active" example:"true"`
 	CreatedAt string `json:"created_at" example:"2023-01-01T00:00:00Z"`
 	UpdatedAt string `json:"updated_at" example:"2023-01-01T00:00:00Z"`
+
+	EmailVerified bool `json:"email_verified" example:"true"`
 }
 
 // UserCreateRequest represents the request payload for creating a user
@@ -30,7 +32,10 @@ type UserUpdateRequest struct {
 	Email     *string `json:"email,omitempty" example:"john@example.com" format:"email"`
 	FirstName *string `json:"first_name,omitempty" example:"John" maxLength:"50"`
 	LastName  *string `json:"last_name,omitempty" example:"Doe" maxLength:"50"`
+	Password  *string `json:"password,omitempty" example:"SecurePass123!" minLength:"8"`
 	IsActive  *bool   `json:"is_active,omitempty" example:"true"`
+	// Required when users change their own email or password
+	CurrentPassword *string `json:"current_password,omitempty" example:"OldPass123!"`
 }
 
 // LoginRequest represents the login request payload
@@ -41,10 +46,194 @@ type LoginRequest struct {
 }
 
 // LoginResponse represents the login response
-// @Description Login response with token
+// @Description Login response with tokens
 type LoginResponse struct {
-	Token string       `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
-	User  UserResponse `json:"user"`
+	TokenResponse
+	User UserResponse `json:"user"`
+}
+
+// TokenResponse represents an issued access and refresh token pair
+// @Description Access and refresh token pair
+type TokenResponse struct {
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refresh_token" example:"Jx1vQm3k9ZrT0cY8n2Lw5pHs4dFg7aBe6iUo_KyXqWc"`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int64  `json:"expires_in" example:"900"`
+}
+
+// RefreshRequest represents the token refresh request payload
+// @Description Token refresh request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"Jx1vQm3k9ZrT0cY8n2Lw5pHs4dFg7aBe6iUo_KyXqWc"`
+}
+
+// ForgotPasswordRequest represents the password reset request payload
+// @Description Password reset link request
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required" example:"john@example.com" format:"email"`
+}
+
+// ResetPasswordRequest represents the payload setting a new password
+// @Description Password reset with an emailed token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"q8mZ2vR4tY6wX0bN1cV3kL5jH7gF9dS_aP-oI2uE4yT"`
+	Password string `json:"password" binding:"required" example:"NewSecurePass123!" minLength:"8"`
+}
+
+// VerifyEmailRequest represents the email verification payload
+// @Description Email verification with an emailed token
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required" example:"q8mZ2vR4tY6wX0bN1cV3kL5jH7gF9dS_aP-oI2uE4yT"`
+}
+
+// MFAChallengeResponse is returned by login when a second factor is required
+// @Description Two-factor login challenge
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required" example:"true"`
+	MFAToken    string `json:"mfa_token" example:"n3Vb8xQ1mK5zR7tY2wP4aL6cJ9dF0gH_sE-uI3oT8yB"`
+	ExpiresIn   int64  `json:"expires_in" example:"300"`
+}
+
+// MFAVerifyRequest completes a two-factor login
+// @Description Two-factor login verification
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required" example:"n3Vb8xQ1mK5zR7tY2wP4aL6cJ9dF0gH_sE-uI3oT8yB"`
+	Code     string `json:"code" binding:"required" example:"123456"`
+}
+
+// MFACodeRequest carries a TOTP or recovery code
+// @Description TOTP or recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// TOTPSetupResponse is the secret to add to an authenticator app
+// @Description TOTP enrollment
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/go-crud:john%40example.com?algorithm=SHA1&digits=6&issuer=go-crud&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+}
+
+// RecoveryCodesResponse lists single-use recovery codes
+// @Description Recovery codes, shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"k3m9-x2pq-7hvd-r4tn"`
+}
+
+// OIDCLoginResponse is the provider URL to continue single sign-on at
+// @Description OIDC authorization URL
+type OIDCLoginResponse struct {
+	AuthorizationURL string `json:"authorization_url" example:"https://sso.example.com/authorize?client_id=go-crud&code_challenge=...&response_type=code&state=..."`
+}
+
+// APIKeyResponse represents a personal API key without its secret
+// @Description Personal API key
+type APIKeyResponse struct {
+	ID         uint     `json:"id" example:"1"`
+	Name       string   `json:"name" example:"nightly export"`
+	Prefix     string   `json:"prefix" example:"gck_3f9a1c2b7d4e8f60"`
+	Scopes     []string `json:"scopes" example:"read:post"`
+	ExpiresAt  *string  `json:"expires_at,omitempty" example:"2024-01-01T00:00:00Z"`
+	LastUsedAt *string  `json:"last_used_at,omitempty" example:"2023-06-01T12:00:00Z"`
+	LastUsedIP string   `json:"last_used_ip,omitempty" example:"203.0.113.7"`
+	CreatedAt  string   `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// APIKeyCreateRequest represents the payload creating an API key
+// @Description API key creation request
+type APIKeyCreateRequest struct {
+	Name      string   `json:"name" binding:"required" example:"nightly export" maxLength:"100"`
+	Scopes    []string `json:"scopes" binding:"required" example:"read:post"`
+	ExpiresAt *string  `json:"expires_at,omitempty" example:"2024-01-01T00:00:00Z"`
+}
+
+// APIKeyUpdateRequest represents the payload renaming or rescoping an API key
+// @Description API key update request
+type APIKeyUpdateRequest struct {
+	Name   *string  `json:"name,omitempty" example:"nightly export" maxLength:"100"`
+	Scopes []string `json:"scopes,omitempty" example:"read:post"`
+}
+
+// APIKeyCreatedResponse includes the key, which is shown only once
+// @Description Created API key
+type APIKeyCreatedResponse struct {
+	APIKeyResponse
+	Key string `json:"key" example:"gck_3f9a1c2b7d4e8f60.Jx1vQm3k9ZrT0cY8n2Lw5pHs4dFg7aBe6iUo_KyXqWc"`
+}
+
+// RoleResponse represents a role with its direct parents and permissions
+// @Description Role
+type RoleResponse struct {
+	Name        string   `json:"name" example:"moderator"`
+	Description string   `json:"description" example:"Moderates comments"`
+	System      bool     `json:"system" example:"false"`
+	Parents     []string `json:"parents" example:"user"`
+	Permissions []string `json:"permissions" example:"*:comment"`
+	CreatedAt   string   `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// RoleCreateRequest represents the payload creating a custom role
+// @Description Role creation request
+type RoleCreateRequest struct {
+	Name        string   `json:"name" binding:"required" example:"moderator" maxLength:"50"`
+	Description string   `json:"description,omitempty" example:"Moderates comments" maxLength:"255"`
+	Parents     []string `json:"parents,omitempty" example:"user"`
+	Permissions []string `json:"permissions,omitempty" example:"*:comment"`
+}
+
+// RolePermissionRequest represents the payload granting a permission to a role
+// @Description Permission grant request
+type RolePermissionRequest struct {
+	Permission string `json:"permission" binding:"required" example:"delete:comment"`
+}
+
+// RoleParentRequest represents the payload making a role inherit from another
+// @Description Parent role request
+type RoleParentRequest struct {
+	Parent string `json:"parent" binding:"required" example:"user"`
+}
+
+// UserRoleRequest represents the payload assigning a role to a user
+// @Description Role assignment request
+type UserRoleRequest struct {
+	Role string `json:"role" binding:"required" example:"moderator"`
+}
+
+// UserRolesResponse lists the roles assigned to a user and those in effect
+// through inheritance
+// @Description User roles
+type UserRolesResponse struct {
+	UserID         uint     `json:"user_id" example:"1"`
+	Roles          []string `json:"roles" example:"moderator"`
+	EffectiveRoles []string `json:"effective_roles" example:"moderator,user,guest"`
+}
+
+// UserPermissionsResponse lists the effective permissions of a user
+// @Description User permissions
+type UserPermissionsResponse struct {
+	UserID      uint     `json:"user_id" example:"1"`
+	Roles       []string `json:"roles" example:"moderator,user,guest"`
+	Permissions []string `json:"permissions" example:"*:comment,*:post"`
+}
+
+// ACLEntryResponse represents a relation of a user to one resource
+// @Description ACL entry
+type ACLEntryResponse struct {
+	ID           uint   `json:"id" example:"1"`
+	UserID       uint   `json:"user_id" example:"2"`
+	ResourceType string `json:"resource_type" example:"category"`
+	ResourceID   uint   `json:"resource_id" example:"3"`
+	Relation     string `json:"relation" example:"editor"`
+	CreatedAt    string `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// ACLGrantRequest represents the payload granting a user a relation to a resource
+// @Description ACL grant request
+type ACLGrantRequest struct {
+	UserID       uint   `json:"user_id" binding:"required" example:"2"`
+	ResourceType string `json:"resource_type" binding:"required" example:"category" maxLength:"50"`
+	ResourceID   uint   `json:"resource_id" binding:"required" example:"3"`
+	Relation     string `json:"relation" binding:"required" example:"editor" maxLength:"50"`
 }
 
 // ErrorResponse represents an error response
@@ -55,6 +244,22 @@ type ErrorResponse struct {
 	Details string `json:"details,omitempty" example:"Username is required"`
 }
 
+// ValidationErrorResponse represents a field-level validation failure (HTTP 422)
+// @Description Validation error response
+type ValidationErrorResponse struct {
+	Error  string            `json:"error" example:"Validation failed"`
+	Code   string            `json:"code" example:"VALIDATION_ERROR"`
+	Errors []ValidationError `json:"errors"`
+}
+
+// ValidationError represents a single invalid field
+// @Description Validation error for one field
+type ValidationError struct {
+	Field   string `json:"field" example:"email"`
+	Message string `json:"message" example:"Invalid email format"`
+	Code    string `json:"code" example:"INVALID_EMAIL"`
+}
+
 // SuccessResponse represents a success response
 // @Description Success response
 type SuccessResponse struct {
@@ -72,12 +277,33 @@ type PaginationResponse struct {
 // Pagination represents pagination information
 // @Description Pagination information
 type Pagination struct {
-	Page       int  `json:"page" example:"1"`
-	PerPage    int  `json:"per_page" example:"10"`
-	Total      int  `json:"total" example:"100"`
-	TotalPages int  `json:"total_pages" example:"10"`
-	HasNext    bool `json:"has_next" example:"true"`
-	HasPrev    bool `json:"has_prev" example:"false"`
+	Page       int    `json:"page" example:"1"`
+	PerPage    int    `json:"per_page" example:"10"`
+	Total      int    `json:"total" example:"100"`
+	TotalPages int    `json:"total_pages" example:"10"`
+	HasNext    bool   `json:"has_next" example:"true"`
+	HasPrev    bool   `json:"has_prev" example:"false"`
+	Sort       string `json:"sort" example:"id"`
+	Order      string `json:"order" example:"asc" enums:"asc,desc"`
+}
+
+// CursorPaginationResponse represents a page fetched with ?cursor=...&limit=...
+// @Description Cursor paginated response
+type CursorPaginationResponse struct {
+	Data       interface{}      `json:"data"`
+	Pagination CursorPagination `json:"pagination"`
+}
+
+// CursorPagination represents keyset pagination information
+// @Description Cursor pagination information
+type CursorPagination struct {
+	Limit      int    `json:"limit" example:"10"`
+	Sort       string `json:"sort" example:"-created_at,-id"`
+	NextCursor string `json:"next_cursor,omitempty" example:"eyJzIjoiLWNyZWF0ZWRfYXQsLWlkIiwidiI6WyIyMDIzLTAxLTAxVDAwOjAwOjAwWiIsMTBdfQ"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	HasNext    bool   `json:"has_next" example:"true"`
+	HasPrev    bool   `json:"has_prev" example:"false"`
+	Total      *int64 `json:"total,omitempty" example:"100"`
 }
 
 // Post represents a blog post
@@ -140,6 +366,29 @@ type CategoryCreateRequest struct {
 	Slug string `json:"slug" binding:"required" example:"technology" minLength:"1" maxLength:"100"`
 }
 
+// Tag represents a post tag
+// @Description Tag information
+type TagResponse struct {
+	ID        uint   `json:"id" example:"1"`
+	Name      string `json:"name" example:"golang"`
+	Slug      string `json:"slug" example:"golang"`
+	CreatedAt string `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt string `json:"updated_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// TagCreateRequest represents the request payload for creating a tag
+// @Description Tag creation request
+type TagCreateRequest struct {
+	Name string `json:"name" binding:"required" example:"golang" minLength:"1" maxLength:"50"`
+	Slug string `json:"slug" example:"golang" maxLength:"50"`
+}
+
+// PostTagsRequest represents the request payload for attaching tags to a post
+// @Description Post tags request
+type PostTagsRequest struct {
+	TagIDs []uint `json:"tag_ids" binding:"required" example:"1,2"`
+}
+
 // HealthCheck represents the health check response
 // @Description Health check response
 type HealthCheck struct {
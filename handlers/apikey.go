@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"errors"
+	"go-crud/auth"
+	"go-crud/docs"
+	"go-crud/models"
+	"go-crud/validation"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// APIKeyHandler lets users manage their personal API keys
+type APIKeyHandler struct {
+	authService *auth.AuthService
+	rbacService *auth.RBACService
+}
+
+func NewAPIKeyHandler(authService *auth.AuthService, rbacService *auth.RBACService) *APIKeyHandler {
+	return &APIKeyHandler{
+		authService: authService,
+		rbacService: rbacService,
+	}
+}
+
+// ListAPIKeys returns the authenticated user's keys
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return
+	}
+
+	keys, err := h.authService.ListAPIKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to list API keys", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	response := make([]docs.APIKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = toAPIKeyResponse(&keys[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// CreateAPIKey creates a key limited to permissions the user holds. The
+// key is part of this response only.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return
+	}
+
+	var req validation.APIKeyCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateAPIKeyCreate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	scopes, ok := h.grantableScopes(c, userID, req.Scopes)
+	if !ok {
+		return
+	}
+
+	key, rawKey, err := h.authService.CreateAPIKey(userID, req.Name, scopes, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to create API key", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, docs.APIKeyCreatedResponse{APIKeyResponse: toAPIKeyResponse(key), Key: rawKey})
+}
+
+// GetAPIKey returns one of the authenticated user's keys
+func (h *APIKeyHandler) GetAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	key, err := h.authService.GetAPIKey(userID, id)
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAPIKeyResponse(key))
+}
+
+// UpdateAPIKey renames a key or replaces its scopes
+func (h *APIKeyHandler) UpdateAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req validation.APIKeyUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateAPIKeyUpdate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	update := auth.APIKeyUpdate{Name: req.Name}
+	if req.Scopes != nil {
+		update.Scopes, ok = h.grantableScopes(c, userID, req.Scopes)
+		if !ok {
+			return
+		}
+	}
+
+	key, err := h.authService.UpdateAPIKey(userID, id, update)
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAPIKeyResponse(key))
+}
+
+// DeleteAPIKey revokes one of the authenticated user's keys
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.authService.DeleteAPIKey(userID, id); err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.SuccessResponse{Message: "API key revoked"})
+}
+
+// grantableScopes parses the requested scopes and makes sure the user holds
+// each of them, so a key never grants more than its owner has
+func (h *APIKeyHandler) grantableScopes(c *gin.Context, userID uint, names []string) ([]auth.Permission, bool) {
+	validator := validation.NewValidator()
+	scopes := make([]auth.Permission, 0, len(names))
+	seen := make(map[auth.Permission]bool)
+	for _, name := range names {
+		scope, err := auth.ParsePermission(name)
+		if err != nil {
+			validator.AddError("scopes", err.Error(), "INVALID_SCOPE")
+			continue
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if validator.HasErrors() {
+		respondValidationErrors(c, validator.GetErrors())
+		return nil, false
+	}
+
+	for _, scope := range scopes {
+		allowed, err := h.rbacService.HasPermission(userID, scope)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to check permissions", Code: "INTERNAL_ERROR"})
+			return nil, false
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, docs.ErrorResponse{
+				Error:   "Cannot grant a permission you do not hold",
+				Code:    "FORBIDDEN",
+				Details: string(scope),
+			})
+			return nil, false
+		}
+	}
+
+	return scopes, true
+}
+
+func respondAPIKeyError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, docs.ErrorResponse{Error: "API key not found", Code: "NOT_FOUND"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "API key operation failed", Code: "INTERNAL_ERROR"})
+}
+
+func toAPIKeyResponse(key *models.APIKey) docs.APIKeyResponse {
+	scopes := auth.APIKeyScopes(key)
+	response := docs.APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     make([]string, len(scopes)),
+		LastUsedIP: key.LastUsedIP,
+		CreatedAt:  key.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	for i, scope := range scopes {
+		response.Scopes[i] = string(scope)
+	}
+	if key.ExpiresAt != nil {
+		expiresAt := key.ExpiresAt.UTC().Format(time.RFC3339)
+		response.ExpiresAt = &expiresAt
+	}
+	if key.LastUsedAt != nil {
+		lastUsedAt := key.LastUsedAt.UTC().Format(time.RFC3339)
+		response.LastUsedAt = &lastUsedAt
+	}
+	return response
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-crud/auth"
+	"go-crud/docs"
+	"go-crud/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	authService := auth.NewAuthService("secret")
+	rbacService := auth.NewRBACService(db)
+	handler := NewAPIKeyHandler(authService, rbacService)
+	if err := rbacService.InitializeDefaultRoles(); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	if err := db.Create(&alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := rbacService.AssignRole(alice.ID, auth.User); err != nil {
+		t.Fatal(err)
+	}
+
+	// The X-User-ID header stands in for AuthMiddleware
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-User-ID"), &userID)
+		c.Set("user_id", userID)
+	})
+	router.POST("/api-keys", handler.CreateAPIKey)
+	router.PATCH("/api-keys/:id", handler.UpdateAPIKey)
+
+	asAlice := []string{"X-User-ID", fmt.Sprint(alice.ID)}
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+		code string
+	}{
+		{"unknown scope", `{"name":"ci","scopes":["read:post","fly:plane"]}`, http.StatusUnprocessableEntity, "VALIDATION_ERROR"},
+		{"scope not held", `{"name":"ci","scopes":["read:post","manage:system"]}`, http.StatusForbidden, "FORBIDDEN"},
+		{"no scopes", `{"name":"ci","scopes":[]}`, http.StatusUnprocessableEntity, "VALIDATION_ERROR"},
+		{"expiry in the past", `{"name":"ci","scopes":["read:post"],"expires_at":"` + past + `"}`, http.StatusUnprocessableEntity, "VALIDATION_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPost, "/api-keys", tt.body, asAlice...)
+			var body docs.ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != tt.want || body.Code != tt.code {
+				t.Errorf("status = %d, body = %s, want %d %s", w.Code, w.Body, tt.want, tt.code)
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&models.APIKey{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d keys created by rejected requests", count)
+	}
+
+	w := serve(router, http.MethodPost, "/api-keys", `{"name":"ci","scopes":["read:post","read:post","create:post"],"expires_at":"`+future+`"}`, asAlice...)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body = %s", w.Code, w.Body)
+	}
+	var created docs.APIKeyCreatedResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Key == "" || len(created.Scopes) != 2 || created.ExpiresAt == nil || *created.ExpiresAt != future {
+		t.Errorf("created key = %+v", created)
+	}
+	if _, err := authService.AuthenticateAPIKey(created.Key, auth.ClientInfo{}); err != nil {
+		t.Errorf("created key does not authenticate: %v", err)
+	}
+
+	// Updating the scopes is held to the same rule
+	path := fmt.Sprintf("/api-keys/%d", created.ID)
+	if w := serve(router, http.MethodPatch, path, `{"scopes":["delete:user"]}`, asAlice...); w.Code != http.StatusForbidden {
+		t.Errorf("update to a scope not held: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serve(router, http.MethodPatch, path, `{"name":"mine now"}`, "X-User-ID", "999"); w.Code != http.StatusNotFound {
+		t.Errorf("update another user's key: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/auth"
+	"go-crud/docs"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/validation"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AuthHandler exposes the AuthService over HTTP
+type AuthHandler struct {
+	authService *auth.AuthService
+}
+
+func NewAuthHandler(authService *auth.AuthService) *AuthHandler {
+	return &AuthHandler{
+		authService: authService,
+	}
+}
+
+// Register creates a new account and starts a session for it
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req validation.UserCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateUserCreate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	// Usernames are public, so a taken username may be reported. A taken
+	// email may not: that case is answered exactly like a new account.
+	var count int64
+	if err := db.Unscoped().Model(&models.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Registration failed", Code: "INTERNAL_ERROR"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, docs.ErrorResponse{Error: "Username is already taken", Code: "ALREADY_EXISTS"})
+		return
+	}
+
+	_, err := h.authService.Register(&models.User{
+		Username:  req.Username,
+		Email:     req.Email,
+		Password:  req.Password,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	})
+	if err != nil && !errors.Is(err, auth.ErrEmailRegistered) {
+		logging.GetLogger().Error("Registration failed", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Registration failed", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, docs.SuccessResponse{Message: "Registration received. Check your email to verify your account, then log in"})
+}
+
+// Login exchanges email and password for an access and refresh token
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req validation.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateLogin(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	result, err := h.authService.Login(req.Email, req.Password, clientInfo(c))
+	if err != nil {
+		respondLoginError(c, err)
+		return
+	}
+
+	// Two-factor users continue at /auth/mfa/verify
+	if result.MFAChallenge != "" {
+		c.JSON(http.StatusOK, docs.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    result.MFAChallenge,
+			ExpiresIn:   result.MFAExpiresIn,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, toLoginResponse(result.User, result.Tokens))
+}
+
+// VerifyMFA completes a two-factor login with a TOTP or recovery code
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req validation.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	user, tokens, err := h.authService.VerifyMFA(req.MFAToken, req.Code, clientInfo(c))
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toLoginResponse(user, tokens))
+}
+
+// SetupTOTP starts TOTP enrollment and returns the secret for the
+// authenticator app
+func (h *AuthHandler) SetupTOTP(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Unable to enroll authenticator", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	enrollment, err := h.authService.EnrollTOTP(&user)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.TOTPSetupResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURI: enrollment.URI,
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication and returns the recovery
+// codes, which are shown only once
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	userID, req, ok := bindMFACode(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.authService.ConfirmTOTP(userID, req.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	userID, req, ok := bindMFACode(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.DisableTOTP(userID, req.Code); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.SuccessResponse{Message: "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the authenticated user
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, req, ok := bindMFACode(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Refresh rotates a refresh token: the presented token is consumed and a new
+// access/refresh token pair is returned
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req validation.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Refresh token is required", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.RefreshToken(req.RefreshToken, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Refresh token has already been used; the session was revoked", Code: "TOKEN_REUSED"})
+		case errors.Is(err, auth.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Invalid or expired refresh token", Code: "INVALID_TOKEN"})
+		default:
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Unable to refresh token", Code: "INTERNAL_ERROR"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toTokenResponse(tokens))
+}
+
+// Logout revokes the access token and its session, invalidating the
+// session's refresh tokens
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if claims, ok := c.Get("claims"); ok {
+		if err := h.authService.RevokeToken(claims.(*auth.Claims)); err != nil {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Logout failed", Code: "INTERNAL_ERROR"})
+			return
+		}
+	}
+
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		if err := h.authService.RevokeSession(sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Logout failed", Code: "INTERNAL_ERROR"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, docs.SuccessResponse{Message: "Logged out successfully"})
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the email is registered.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req validation.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateForgotPassword(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(req.Email); err != nil {
+		logging.GetLogger().Error("Failed to request password reset", map[string]interface{}{"error": err.Error()})
+	}
+
+	c.JSON(http.StatusAccepted, docs.SuccessResponse{Message: "If the email is registered, a password reset link has been sent"})
+}
+
+// ResetPassword sets a new password with an emailed token and signs the
+// user out everywhere
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req validation.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateResetPassword(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if _, err := h.authService.ResetPassword(req.Token, req.Password, clientInfo(c)); err != nil {
+		if errors.Is(err, auth.ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid or expired reset token", Code: "INVALID_TOKEN"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Unable to reset password", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.SuccessResponse{Message: "Password has been reset"})
+}
+
+// VerifyEmail confirms the user's email address with an emailed token
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req validation.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Verification token is required", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	user, err := h.authService.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid or expired verification token", Code: "INVALID_TOKEN"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Unable to verify email", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.SuccessResponse{Message: "Email verified", Data: toUserResponse(user)})
+}
+
+// ResendVerification sends a new verification link to the authenticated user
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Unable to send verification email", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, docs.ErrorResponse{Error: "Email is already verified", Code: "ALREADY_VERIFIED"})
+		return
+	}
+
+	if err := h.authService.SendEmailVerification(&user); err != nil {
+		if errors.Is(err, auth.ErrMailerNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, docs.ErrorResponse{Error: "Email delivery is not available", Code: "MAIL_UNAVAILABLE"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Unable to send verification email", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, docs.SuccessResponse{Message: "Verification email sent"})
+}
+
+// OIDCLogin sends the user to the OIDC provider. With ?redirect=false the
+// provider URL is returned as JSON instead, e.g. for single-page apps.
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	authURL, err := h.authService.BeginOIDCLogin(c.Request.Context())
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+
+	if c.Query("redirect") == "false" {
+		c.JSON(http.StatusOK, docs.OIDCLoginResponse{AuthorizationURL: authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes a login the OIDC provider redirected back with and
+// issues our tokens
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Single sign-on was not completed", Code: "OIDC_ERROR", Details: providerErr + " " + c.Query("error_description")})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "state and code are required", Code: "BAD_REQUEST"})
+		return
+	}
+
+	result, err := h.authService.CompleteOIDCLogin(c.Request.Context(), state, code, clientInfo(c))
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toLoginResponse(result.User, result.Tokens))
+}
+
+// Me returns the authenticated user
+func (h *AuthHandler) Me(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, docs.ErrorResponse{Error: "User not found", Code: "NOT_FOUND"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: err.Error(), Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toUserResponse(&user))
+}
+
+// JWKS publishes the public keys other services use to verify access tokens
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(auth.JWKSMaxAge/time.Second)))
+	c.JSON(http.StatusOK, h.authService.JWKS())
+}
+
+// bindMFACode reads the code of an MFA management request by the
+// authenticated user
+func bindMFACode(c *gin.Context) (uint, validation.MFACodeRequest, bool) {
+	var req validation.MFACodeRequest
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authentication required", Code: "UNAUTHORIZED"})
+		return 0, req, false
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Code is required", Code: "BAD_REQUEST", Details: err.Error()})
+		return 0, req, false
+	}
+
+	return userID, req, true
+}
+
+// respondLoginError answers every credential failure, including locked
+// accounts, with the same 401 so the response does not reveal whether an
+// email is registered. Client throttling applies to any email alike and is
+// reported with 429 and the time until it may be retried.
+func respondLoginError(c *gin.Context, err error) {
+	var lockout *auth.LockoutError
+	switch {
+	case errors.Is(err, auth.ErrTooManyAttempts) && errors.As(err, &lockout):
+		retryAfter := int(math.Ceil(lockout.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, docs.ErrorResponse{
+			Error:   "Too many failed login attempts",
+			Code:    "TOO_MANY_ATTEMPTS",
+			Details: fmt.Sprintf("retry after %d seconds", retryAfter),
+		})
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Invalid email or password", Code: "INVALID_CREDENTIALS"})
+	case errors.Is(err, auth.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, docs.ErrorResponse{Error: "Account is deactivated", Code: "ACCOUNT_DISABLED"})
+	default:
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Login failed", Code: "INTERNAL_ERROR"})
+	}
+}
+
+func respondMFAError(c *gin.Context, err error) {
+	var lockout *auth.LockoutError
+	switch {
+	case errors.Is(err, auth.ErrMFALocked) && errors.As(err, &lockout):
+		retryAfter := int(math.Ceil(lockout.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, docs.ErrorResponse{
+			Error:   "Too many invalid two-factor codes",
+			Code:    "TOO_MANY_ATTEMPTS",
+			Details: fmt.Sprintf("retry after %d seconds", retryAfter),
+		})
+	case errors.Is(err, auth.ErrInvalidMFAChallenge):
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Invalid or expired MFA token", Code: "INVALID_TOKEN"})
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Invalid two-factor code", Code: "INVALID_MFA_CODE"})
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, docs.ErrorResponse{Error: "Two-factor authentication is already enabled", Code: "MFA_ALREADY_ENABLED"})
+	case errors.Is(err, auth.ErrMFANotEnrolled):
+		c.JSON(http.StatusConflict, docs.ErrorResponse{Error: "Two-factor authentication is not set up", Code: "MFA_NOT_ENROLLED"})
+	default:
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Two-factor authentication failed", Code: "INTERNAL_ERROR"})
+	}
+}
+
+func respondOIDCError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrOIDCNotConfigured):
+		c.JSON(http.StatusNotFound, docs.ErrorResponse{Error: "Single sign-on is not configured", Code: "OIDC_NOT_CONFIGURED"})
+	case errors.Is(err, auth.ErrInvalidOIDCState):
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid or expired login, please start again", Code: "INVALID_STATE"})
+	case errors.Is(err, auth.ErrInvalidIDToken):
+		c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Invalid ID token", Code: "INVALID_ID_TOKEN"})
+	case errors.Is(err, auth.ErrOIDCEmailNotVerified):
+		c.JSON(http.StatusForbidden, docs.ErrorResponse{Error: "The provider has not verified your email", Code: "EMAIL_NOT_VERIFIED"})
+	case errors.Is(err, auth.ErrOIDCSignupDisabled):
+		c.JSON(http.StatusForbidden, docs.ErrorResponse{Error: "No account exists for this identity", Code: "SIGNUP_DISABLED"})
+	case errors.Is(err, auth.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, docs.ErrorResponse{Error: "Account is deactivated", Code: "ACCOUNT_DISABLED"})
+	default:
+		logging.GetLogger().Error("Single sign-on failed", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusBadGateway, docs.ErrorResponse{Error: "Single sign-on failed", Code: "OIDC_PROVIDER_ERROR"})
+	}
+}
+
+// currentUserID returns the user ID set by middleware.AuthMiddleware
+func currentUserID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	userID, ok := value.(uint)
+	return userID, ok
+}
+
+// clientInfo describes the requesting client for session bookkeeping
+func clientInfo(c *gin.Context) auth.ClientInfo {
+	return auth.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+func toTokenResponse(tokens *auth.TokenPair) docs.TokenResponse {
+	return docs.TokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokens.ExpiresIn,
+	}
+}
+
+func toLoginResponse(user *models.User, tokens *auth.TokenPair) docs.LoginResponse {
+	return docs.LoginResponse{
+		TokenResponse: toTokenResponse(tokens),
+		User:          toUserResponse(user),
+	}
+}
+
+func toUserResponse(user *models.User) docs.UserResponse {
+	return docs.UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		IsActive:  user.IsActive,
+		CreatedAt: user.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt: user.UpdatedAt.UTC().Format(time.RFC3339),
+
+		EmailVerified: user.EmailVerified,
+	}
+}
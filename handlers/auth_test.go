@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-crud/auth"
+	"go-crud/docs"
+	"go-crud/mailer"
+	"go-crud/middleware"
+	"go-crud/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const registerAlice = `{"username":"alice","email":"alice@example.com","password":"Sup3r-secret"}`
+
+// loginToken logs in through the router's /login and returns the access token
+func loginToken(t *testing.T, router http.Handler, email, password string) string {
+	t.Helper()
+
+	w := serve(router, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status = %d, body = %s", w.Code, w.Body)
+	}
+	var login docs.LoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+	if login.Token == "" {
+		t.Fatalf("login response = %s", w.Body)
+	}
+	return login.Token
+}
+
+// waitForMail waits until outbox has sent n messages. Account emails are
+// sent in the background.
+func waitForMail(t *testing.T, outbox *mailer.MemoryMailer, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); len(outbox.Messages()) < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d emails sent, want %d", len(outbox.Messages()), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRegisterLoginAndMe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	authService := auth.NewAuthService("secret")
+	outbox := mailer.NewMemoryMailer("noreply@example.com")
+	authService.SetMailer(outbox, auth.DefaultAccountOptions())
+	rbacService := auth.NewRBACService(db)
+	handler := NewAuthHandler(authService)
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+	router.POST("/login", handler.Login)
+	router.GET("/me", middleware.AuthMiddleware(authService), handler.Me)
+
+	registered := serve(router, http.MethodPost, "/register", registerAlice)
+	if registered.Code != http.StatusAccepted {
+		t.Fatalf("register: status = %d, body = %s", registered.Code, registered.Body)
+	}
+	var user models.User
+	if err := db.Where("email = ?", "alice@example.com").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := rbacService.HasRole(user.ID, auth.User); err != nil || !ok {
+		t.Errorf("registered user has the user role: %v, %v", ok, err)
+	}
+	waitForMail(t, outbox, 1)
+	if msg, _ := outbox.Last("alice@example.com"); msg.Subject != "Verify your email address" {
+		t.Errorf("email after registration = %q", msg.Subject)
+	}
+
+	// A taken email is answered like a new registration; the owner is told
+	w := serve(router, http.MethodPost, "/register", `{"username":"alice2","email":"alice@example.com","password":"Sup3r-secret"}`)
+	if w.Code != registered.Code || w.Body.String() != registered.Body.String() {
+		t.Errorf("taken email: %d %s, want %d %s", w.Code, w.Body, registered.Code, registered.Body)
+	}
+	waitForMail(t, outbox, 2)
+	if msg, _ := outbox.Last("alice@example.com"); msg.Subject != "You already have an account" {
+		t.Errorf("email after registering a taken email = %q", msg.Subject)
+	}
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d users after registering a taken email, want 1", count)
+	}
+
+	if w := serve(router, http.MethodPost, "/register", `{"username":"alice","email":"other@example.com","password":"Sup3r-secret"}`); w.Code != http.StatusConflict {
+		t.Errorf("taken username: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := serve(router, http.MethodPost, "/register", `{"username":"bob","email":"bob@example.com","password":"short"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("weak password: status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	if w := serve(router, http.MethodPost, "/login", `{"email":"alice@example.com","password":"wrong-Passw0rd"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	token := loginToken(t, router, "alice@example.com", "Sup3r-secret")
+
+	if w := serve(router, http.MethodGet, "/me", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("me without token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = serve(router, http.MethodGet, "/me", "", "Authorization", "Bearer "+token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("me: status = %d, body = %s", w.Code, w.Body)
+	}
+	var me docs.UserResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &me); err != nil {
+		t.Fatal(err)
+	}
+	if me.Email != "alice@example.com" {
+		t.Errorf("me = %+v", me)
+	}
+}
+
+func TestRegisterDeletedUsername(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	handler := NewAuthHandler(auth.NewAuthService("secret"))
+	router := gin.New()
+	router.POST("/register", handler.Register)
+
+	deleted := models.User{Username: "carol", Email: "carol@example.com", Password: "x"}
+	if err := db.Create(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The username of a deleted account stays taken
+	w := serve(router, http.MethodPost, "/register", `{"username":"carol","email":"new@example.com","password":"Sup3r-secret"}`)
+	var body docs.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusConflict || body.Code != "ALREADY_EXISTS" {
+		t.Errorf("status = %d, body = %s, want %d ALREADY_EXISTS", w.Code, w.Body, http.StatusConflict)
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	authService := auth.NewAuthService("secret")
+	handler := NewAuthHandler(authService)
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+	router.POST("/login", handler.Login)
+	router.POST("/logout", middleware.AuthMiddleware(authService), handler.Logout)
+	router.GET("/me", middleware.AuthMiddleware(authService), handler.Me)
+
+	if w := serve(router, http.MethodPost, "/register", registerAlice); w.Code != http.StatusAccepted {
+		t.Fatalf("register: status = %d, body = %s", w.Code, w.Body)
+	}
+	bearer := "Bearer " + loginToken(t, router, "alice@example.com", "Sup3r-secret")
+
+	if w := serve(router, http.MethodGet, "/me", "", "Authorization", bearer); w.Code != http.StatusOK {
+		t.Fatalf("me before logout: status = %d, body = %s", w.Code, w.Body)
+	}
+	if w := serve(router, http.MethodPost, "/logout", "", "Authorization", bearer); w.Code != http.StatusOK {
+		t.Fatalf("logout: status = %d, body = %s", w.Code, w.Body)
+	}
+
+	w := serve(router, http.MethodGet, "/me", "", "Authorization", bearer)
+	var body docs.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusUnauthorized || body.Code != "TOKEN_REVOKED" {
+		t.Errorf("me after logout: status = %d, body = %s, want %d TOKEN_REVOKED", w.Code, w.Body, http.StatusUnauthorized)
+	}
+}
+
+func TestForgotPasswordDoesNotRevealAccounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	authService := auth.NewAuthService("secret")
+	outbox := mailer.NewMemoryMailer("noreply@example.com")
+	authService.SetMailer(outbox, auth.DefaultAccountOptions())
+	handler := NewAuthHandler(authService)
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+	router.POST("/password/forgot", handler.ForgotPassword)
+	router.POST("/password/reset", handler.ResetPassword)
+
+	if w := serve(router, http.MethodPost, "/register", registerAlice); w.Code != http.StatusAccepted {
+		t.Fatalf("register: status = %d, body = %s", w.Code, w.Body)
+	}
+	waitForMail(t, outbox, 1)
+	outbox.Reset()
+
+	known := serve(router, http.MethodPost, "/password/forgot", `{"email":"alice@example.com"}`)
+	unknown := serve(router, http.MethodPost, "/password/forgot", `{"email":"nobody@example.com"}`)
+	if known.Code != http.StatusAccepted || unknown.Code != known.Code || unknown.Body.String() != known.Body.String() {
+		t.Errorf("known: %d %s, unknown: %d %s, want the same 202", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+	waitForMail(t, outbox, 1)
+	if msg, _ := outbox.Last("alice@example.com"); msg.Subject != "Reset your password" {
+		t.Errorf("email = %q, want a password reset", msg.Subject)
+	}
+
+	w := serve(router, http.MethodPost, "/password/reset", `{"token":"not-a-token","password":"N3w-password"}`)
+	var body docs.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || body.Code != "INVALID_TOKEN" {
+		t.Errorf("reset with a bad token: status = %d, body = %s", w.Code, w.Body)
+	}
+}
+
+func TestLoginFailuresLookTheSame(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	authService := auth.NewAuthService("secret")
+	hash, err := authService.HashPassword("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockedUntil := time.Now().Add(time.Hour)
+	users := []models.User{
+		{Username: "alice", Email: "alice@example.com", Password: hash, IsActive: true},
+		{Username: "bob", Email: "bob@example.com", Password: hash, IsActive: true, LockedUntil: &lockedUntil},
+	}
+	for i := range users {
+		if err := db.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := gin.New()
+	router.POST("/login", NewAuthHandler(authService).Login)
+
+	login := func(email, password string) string {
+		return `{"email":"` + email + `","password":"` + password + `"}`
+	}
+
+	want := serve(router, http.MethodPost, "/login", login("nobody@example.com", "correct-password"))
+	if want.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown email: status = %d, body = %s", want.Code, want.Body)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{"wrong password", "alice@example.com", "wrong-password"},
+		{"locked account", "bob@example.com", "correct-password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPost, "/login", login(tt.email, tt.password))
+			if w.Code != want.Code || w.Body.String() != want.Body.String() {
+				t.Errorf("response = %d %s, want %d %s", w.Code, w.Body, want.Code, want.Body)
+			}
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != "" {
+				t.Errorf("Retry-After = %q reveals a lockout", retryAfter)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	authService := auth.NewAuthService("secret")
+	authService.SetLockoutOptions(auth.LockoutOptions{ClientMaxAttempts: 1, ClientWindow: 90 * time.Second})
+
+	router := gin.New()
+	router.POST("/login", NewAuthHandler(authService).Login)
+
+	wrong := `{"email":"nobody@example.com","password":"wrong-Passw0rd"}`
+	if w := serve(router, http.MethodPost, "/login", wrong); w.Code != http.StatusUnauthorized {
+		t.Fatalf("first failure: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w := serve(router, http.MethodPost, "/login", wrong)
+	var body docs.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusTooManyRequests || body.Code != "TOO_MANY_ATTEMPTS" || w.Header().Get("Retry-After") != "90" {
+		t.Errorf("throttled: status = %d, Retry-After = %q, body = %s", w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"go-crud/models"
+	"go-crud/utils"
+	"go-crud/validation"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// categorySearchFields are the columns matched by the q search parameter
+var categorySearchFields = []string{"name", "slug"}
+
+// categoryIncludes are the relations a category may embed with ?include=
+var categoryIncludes = utils.Includes{
+	"posts": "Posts",
+}
+
+// ListCategories lists categories with pagination, filtering and search
+func ListCategories(c *gin.Context) {
+	var categories []models.Category
+	respondPaginated(c, db.Model(&models.Category{}), categorySearchFields, categoryIncludes, &categories)
+}
+
+// CreateCategory creates a new category
+func CreateCategory(c *gin.Context) {
+	var req validation.CategoryCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateCategoryCreate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	slug, err := uniqueSlug(&models.Category{}, req.Slug, req.Name, 0)
+	if err != nil {
+		respondSlugError(c, err)
+		return
+	}
+
+	category := models.Category{
+		Name: req.Name,
+		Slug: slug,
+	}
+
+	if err := db.Create(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// GetCategory retrieves a category by ID
+func GetCategory(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	query, fieldset, ok := applyFieldset(c, db.Model(&models.Category{}), categoryIncludes)
+	if !ok {
+		return
+	}
+
+	var category models.Category
+	if err := query.First(&category, id).Error; err != nil {
+		respondCategoryLookupError(c, err)
+		return
+	}
+
+	respondFieldset(c, http.StatusOK, fieldset, category)
+}
+
+// UpdateCategory updates a category
+func UpdateCategory(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var category models.Category
+	if err := db.First(&category, id).Error; err != nil {
+		respondCategoryLookupError(c, err)
+		return
+	}
+
+	var req validation.CategoryUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateCategoryUpdate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Slug != nil {
+		slug, err := uniqueSlug(&models.Category{}, *req.Slug, "", category.ID)
+		if err != nil {
+			respondSlugError(c, err)
+			return
+		}
+		updates["slug"] = slug
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&category).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.First(&category, category.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory deletes a category
+func DeleteCategory(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var category models.Category
+	if err := db.First(&category, id).Error; err != nil {
+		respondCategoryLookupError(c, err)
+		return
+	}
+
+	// Posts require a category, so refuse to orphan them
+	var postCount int64
+	if err := db.Model(&models.Post{}).Where("category_id = ?", category.ID).Count(&postCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if postCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category still has posts"})
+		return
+	}
+
+	if err := db.Delete(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// ListCategoryPosts lists the posts in a category
+func ListCategoryPosts(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var category models.Category
+	if err := db.First(&category, id).Error; err != nil {
+		respondCategoryLookupError(c, err)
+		return
+	}
+
+	var posts []models.Post
+	respondPaginated(c, db.Model(&models.Post{}).Where("category_id = ?", category.ID), postSearchFields, postIncludes, &posts)
+}
+
+func respondCategoryLookupError(c *gin.Context, err error) {
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/policy"
+	"go-crud/utils"
+	"go-crud/validation"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// commentSearchFields are the columns matched by the q search parameter
+var commentSearchFields = []string{"content"}
+
+// commentIncludes are the relations a comment may embed with ?include=
+var commentIncludes = utils.Includes{
+	"user": "User",
+	"post": "Post",
+}
+
+// ListComments lists comments with pagination, filtering and search
+func ListComments(c *gin.Context) {
+	var comments []models.Comment
+	respondPaginated(c, db.Model(&models.Comment{}), commentSearchFields, commentIncludes, &comments)
+}
+
+// ListPostComments lists the comments of a post
+func ListPostComments(c *gin.Context) {
+	postID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, postID).Error; err != nil {
+		respondPostLookupError(c, err)
+		return
+	}
+
+	var comments []models.Comment
+	respondPaginated(c, db.Model(&models.Comment{}).Where("post_id = ?", post.ID), commentSearchFields, commentIncludes, &comments)
+}
+
+// CreateComment creates a new comment
+func CreateComment(c *gin.Context) {
+	var req validation.CommentCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	createComment(c, &req)
+}
+
+// CreatePostComment creates a new comment on the post in the path
+func CreatePostComment(c *gin.Context) {
+	postID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req validation.CommentCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.PostID = postID
+
+	createComment(c, &req)
+}
+
+func createComment(c *gin.Context, req *validation.CommentCreateRequest) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if errs := validation.ValidateCommentCreate(req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, req.PostID).Error; err != nil {
+		respondPostLookupError(c, err)
+		return
+	}
+
+	comment := models.Comment{
+		Content: req.Content,
+		UserID:  userID,
+		PostID:  post.ID,
+	}
+
+	if err := db.Create(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// GetComment retrieves a comment by ID
+func GetComment(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	query, fieldset, ok := applyFieldset(c, db.Model(&models.Comment{}), commentIncludes)
+	if !ok {
+		return
+	}
+
+	var comment models.Comment
+	if err := query.First(&comment, id).Error; err != nil {
+		respondCommentLookupError(c, err)
+		return
+	}
+
+	respondFieldset(c, http.StatusOK, fieldset, comment)
+}
+
+// UpdateComment updates a comment
+func UpdateComment(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var comment models.Comment
+	if err := db.First(&comment, id).Error; err != nil {
+		respondCommentLookupError(c, err)
+		return
+	}
+
+	var req validation.CommentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateCommentUpdate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if req.Content != nil {
+		if err := db.Model(&comment).Update("content", *req.Content).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.First(&comment, comment.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment deletes a comment
+func DeleteComment(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var comment models.Comment
+	if err := db.First(&comment, id).Error; err != nil {
+		respondCommentLookupError(c, err)
+		return
+	}
+
+	if err := db.Delete(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// CommentOwner resolves the author of the comment addressed by the :id path parameter
+func CommentOwner(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, middleware.ErrInvalidResourceID
+	}
+
+	var comment models.Comment
+	if err := db.Select("id", "user_id").First(&comment, id).Error; err != nil {
+		return 0, err
+	}
+	return comment.UserID, nil
+}
+
+func respondCommentLookupError(c *gin.Context, err error) {
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// CommentResource loads the comment addressed by the :id path parameter for
+// policy checks, with its post_id as attribute
+func CommentResource(c *gin.Context) (*policy.Resource, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return nil, middleware.ErrInvalidResourceID
+	}
+
+	var comment models.Comment
+	if err := db.Select("id", "user_id", "post_id", "created_at").First(&comment, id).Error; err != nil {
+		return nil, err
+	}
+	return &policy.Resource{
+		Type:       "comment",
+		ID:         comment.ID,
+		OwnerID:    comment.UserID,
+		CreatedAt:  comment.CreatedAt,
+		Attributes: map[string]interface{}{"post_id": comment.PostID},
+	}, nil
+}
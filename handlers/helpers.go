@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/utils"
+	"go-crud/validation"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errSlugTaken = errors.New("slug is already in use")
+
+// parseIDParam reads a numeric path parameter and writes a 400 response if it is invalid
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s", name)})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondValidationErrors writes field-level validation errors
+func respondValidationErrors(c *gin.Context, errs []validation.ValidationError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":  "Validation failed",
+		"code":   "VALIDATION_ERROR",
+		"errors": errs,
+	})
+}
+
+// respondSlugError maps errors from uniqueSlug to a response
+func respondSlugError(c *gin.Context, err error) {
+	if errors.Is(err, errSlugTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// uniqueSlug derives a slug from source (or uses requested as is) and appends
+// a numeric suffix until no other row of model uses it
+func uniqueSlug(model interface{}, requested, source string, excludeID uint) (string, error) {
+	base := requested
+	if base == "" {
+		base = utils.Slugify(source)
+	}
+	if base == "" {
+		base = "item"
+	}
+
+	slug := base
+	for i := 2; ; i++ {
+		var count int64
+		query := db.Model(model).Unscoped().Where("slug = ?", slug)
+		if excludeID != 0 {
+			query = query.Where("id <> ?", excludeID)
+		}
+		if err := query.Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return slug, nil
+		}
+		if requested != "" {
+			return "", errSlugTaken
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// respondPaginated applies the q search, filter[field][op], sort/order and
+// page/per_page query parameters to query, loads the page into dest and
+// writes it in the paginated response envelope. Requests carrying cursor or
+// limit use keyset pagination instead. ?fields= and ?include= are honoured
+// for the relations in includes.
+func respondPaginated(c *gin.Context, query *gorm.DB, searchFields []string, includes utils.Includes, dest interface{}) {
+	query = utils.ApplySearch(query, c.Query("q"), searchFields)
+
+	query, fieldset, ok := applyFieldset(c, query, includes)
+	if !ok {
+		return
+	}
+
+	if utils.IsCursorRequest(c) {
+		pagination, err := utils.CursorPaginateQuery(query, c, dest)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+
+		data, err := fieldset.Project(dest)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, utils.CreateCursorPaginatedResponse(data, pagination))
+		return
+	}
+
+	paged, pagination, err := utils.PaginateQuery(query, c)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	if err := paged.Find(dest).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := fieldset.Project(dest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.CreatePaginatedResponse(data, pagination))
+}
+
+// applyFieldset applies ?fields= and ?include= to query and writes a 400
+// response if they reference unknown fields or relations
+func applyFieldset(c *gin.Context, query *gorm.DB, includes utils.Includes) (*gorm.DB, *utils.Fieldset, bool) {
+	query, fieldset, err := utils.ApplyFieldset(query, c, includes)
+	if err != nil {
+		respondQueryError(c, err)
+		return nil, nil, false
+	}
+	return query, fieldset, true
+}
+
+// respondFieldset writes data trimmed to the requested sparse fieldset
+func respondFieldset(c *gin.Context, status int, fieldset *utils.Fieldset, data interface{}) {
+	projected, err := fieldset.Project(data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, projected)
+}
+
+// respondQueryError maps errors from the utils query helpers to a response:
+// unknown fields and malformed parameters are client errors
+func respondQueryError(c *gin.Context, err error) {
+	var fieldErr *utils.FieldError
+	if errors.As(err, &fieldErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          fieldErr.Error(),
+			"code":           "INVALID_FIELD",
+			"allowed_fields": fieldErr.Allowed,
+		})
+		return
+	}
+
+	var parseErr *utils.ParseError
+	if errors.As(err, &parseErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    parseErr.Error(),
+			"code":     "INVALID_FILTER",
+			"position": parseErr.Pos,
+		})
+		return
+	}
+
+	var queryErr *utils.QueryError
+	if errors.As(err, &queryErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": queryErr.Error(), "code": "INVALID_QUERY"})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/policy"
+	"go-crud/utils"
+	"go-crud/validation"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// postSearchFields are the columns matched by the q search parameter
+var postSearchFields = []string{"title", "excerpt"}
+
+// postIncludes are the relations a post may embed with ?include=
+var postIncludes = utils.Includes{
+	"user":          "User",
+	"category":      "Category",
+	"tags":          "Tags",
+	"comments":      "Comments",
+	"comments.user": "Comments.User",
+}
+
+// ListPosts lists posts with pagination, filtering and search
+func ListPosts(c *gin.Context) {
+	var posts []models.Post
+	respondPaginated(c, db.Model(&models.Post{}), postSearchFields, postIncludes, &posts)
+}
+
+// CreatePost creates a new post owned by the authenticated user
+func CreatePost(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var req validation.PostCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := validation.ValidatePostCreate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if ok := requireCategory(c, req.CategoryID); !ok {
+		return
+	}
+
+	slug, err := uniqueSlug(&models.Post{}, req.Slug, req.Title, 0)
+	if err != nil {
+		respondSlugError(c, err)
+		return
+	}
+
+	post := models.Post{
+		Title:      req.Title,
+		Slug:       slug,
+		Content:    req.Content,
+		Excerpt:    req.Excerpt,
+		Status:     req.Status,
+		UserID:     userID,
+		CategoryID: req.CategoryID,
+	}
+	if post.Status == "" {
+		post.Status = "draft"
+	}
+
+	if err := db.Create(&post).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, post)
+}
+
+// GetPost retrieves a post by ID
+func GetPost(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	query, fieldset, ok := applyFieldset(c, db.Model(&models.Post{}), postIncludes)
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if err := query.First(&post, id).Error; err != nil {
+		respondPostLookupError(c, err)
+		return
+	}
+
+	respondFieldset(c, http.StatusOK, fieldset, post)
+}
+
+// UpdatePost updates a post
+func UpdatePost(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, id).Error; err != nil {
+		respondPostLookupError(c, err)
+		return
+	}
+
+	var req validation.PostUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := validation.ValidatePostUpdate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.Slug != nil {
+		slug, err := uniqueSlug(&models.Post{}, *req.Slug, "", post.ID)
+		if err != nil {
+			respondSlugError(c, err)
+			return
+		}
+		updates["slug"] = slug
+	}
+	if req.Content != nil {
+		updates["content"] = *req.Content
+	}
+	if req.Excerpt != nil {
+		updates["excerpt"] = *req.Excerpt
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+	if req.CategoryID != nil {
+		if ok := requireCategory(c, *req.CategoryID); !ok {
+			return
+		}
+		// Category editors may only move posts into categories they edit
+		if *req.CategoryID != post.CategoryID && !middleware.AuthorizeChange(c, "update", map[string]interface{}{"category_id": *req.CategoryID}) {
+			return
+		}
+		updates["category_id"] = *req.CategoryID
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&post).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.First(&post, post.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// DeletePost deletes a post
+func DeletePost(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, id).Error; err != nil {
+		respondPostLookupError(c, err)
+		return
+	}
+
+	if err := db.Delete(&post).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
+}
+
+// ListPostTags lists the tags attached to a post
+func ListPostTags(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, id).Error; err != nil {
+		respondPostLookupError(c, err)
+		return
+	}
+
+	tagIDs := db.Model(&models.PostTag{}).Select("tag_id").Where("post_id = ?", post.ID)
+
+	var tags []models.Tag
+	respondPaginated(c, db.Model(&models.Tag{}).Where("id IN (?)", tagIDs), tagSearchFields, tagIncludes, &tags)
+}
+
+// AddPostTags attaches existing tags to a post
+func AddPostTags(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, id).Error; err != nil {
+		respondPostLookupError(c, err)
+		return
+	}
+
+	var req validation.PostTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := validation.ValidatePostTags(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	var tags []models.Tag
+	if err := db.Where("id IN ?", req.TagIDs).Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(tags) != len(uniqueIDs(req.TagIDs)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "One or more tags not found"})
+		return
+	}
+
+	if err := db.Model(&post).Association("Tags").Append(&tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Model(&post).Association("Tags").Find(&post.Tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": post.Tags})
+}
+
+// RemovePostTag detaches a tag from a post
+func RemovePostTag(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	tagID, ok := parseIDParam(c, "tag_id")
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, id).Error; err != nil {
+		respondPostLookupError(c, err)
+		return
+	}
+
+	if err := db.Model(&post).Association("Tags").Delete(&models.Tag{ID: tagID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag removed from post successfully"})
+}
+
+// PostOwner resolves the author of the post addressed by the :id path parameter
+func PostOwner(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, middleware.ErrInvalidResourceID
+	}
+
+	var post models.Post
+	if err := db.Select("id", "user_id").First(&post, id).Error; err != nil {
+		return 0, err
+	}
+	return post.UserID, nil
+}
+
+func respondPostLookupError(c *gin.Context, err error) {
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// requireCategory checks that a category exists, writing a 422 response otherwise
+func requireCategory(c *gin.Context, categoryID uint) bool {
+	var count int64
+	if err := db.Model(&models.Category{}).Where("id = ?", categoryID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if count == 0 {
+		respondValidationErrors(c, []validation.ValidationError{
+			{Field: "category_id", Message: "Category does not exist", Code: "NOT_FOUND"},
+		})
+		return false
+	}
+	return true
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// PostResource loads the post addressed by the :id path parameter for
+// policy checks, with its category_id and status as attributes
+func PostResource(c *gin.Context) (*policy.Resource, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return nil, middleware.ErrInvalidResourceID
+	}
+
+	var post models.Post
+	if err := db.Select("id", "user_id", "category_id", "status", "created_at").First(&post, id).Error; err != nil {
+		return nil, err
+	}
+	return &policy.Resource{
+		Type:      "post",
+		ID:        post.ID,
+		OwnerID:   post.UserID,
+		CreatedAt: post.CreatedAt,
+		Attributes: map[string]interface{}{
+			"category_id": post.CategoryID,
+			"status":      post.Status,
+		},
+	}, nil
+}
@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"go-crud/auth"
+	"go-crud/config"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/policy"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB points the handlers at a fresh in-memory database
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	testDB, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.AutoMigrate(testDB); err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB, _ := testDB.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db = testDB
+	config.DB = testDB
+}
+
+// serve sends a JSON request with the given header name/value pairs to
+// router and returns the recorded response
+func serve(router http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostCRUD(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	author := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	category := models.Category{Name: "News", Slug: "news"}
+	tag := models.Tag{Name: "Go", Slug: "go"}
+	for _, record := range []interface{}{&author, &category, &tag} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", author.ID) })
+	router.GET("/posts/:id", GetPost)
+	router.POST("/posts", CreatePost)
+	router.PUT("/posts/:id", UpdatePost)
+	router.DELETE("/posts/:id", DeletePost)
+	router.POST("/posts/:id/tags", AddPostTags)
+	router.DELETE("/posts/:id/tags/:tag_id", RemovePostTag)
+
+	create := func(title string) models.Post {
+		t.Helper()
+		body := fmt.Sprintf(`{"title":%q,"content":"text","category_id":%d}`, title, category.ID)
+		w := serve(router, http.MethodPost, "/posts", body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create: status = %d, body = %s", w.Code, w.Body)
+		}
+		var post models.Post
+		if err := json.Unmarshal(w.Body.Bytes(), &post); err != nil {
+			t.Fatal(err)
+		}
+		if post.UserID != author.ID {
+			t.Fatalf("post owned by user %d, want the authenticated user %d", post.UserID, author.ID)
+		}
+		return post
+	}
+
+	first := create("Hello, World!")
+	second := create("Hello World")
+	if first.Slug != "hello-world" || second.Slug != "hello-world-2" {
+		t.Errorf("slugs = %q, %q, want hello-world, hello-world-2", first.Slug, second.Slug)
+	}
+	if first.Status != "draft" {
+		t.Errorf("status = %q, want draft", first.Status)
+	}
+
+	if w := serve(router, http.MethodPost, "/posts", `{"title":"Orphan","content":"text","category_id":999}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown category: status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if w := serve(router, http.MethodPut, fmt.Sprintf("/posts/%d", second.ID), `{"slug":"hello-world"}`); w.Code != http.StatusConflict {
+		t.Errorf("taken slug: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	w := serve(router, http.MethodPut, fmt.Sprintf("/posts/%d", first.ID), `{"status":"published"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: status = %d, body = %s", w.Code, w.Body)
+	}
+	var updated models.Post
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status != "published" || updated.Title != first.Title || updated.Content != first.Content {
+		t.Errorf("partial update changed other fields: %+v", updated)
+	}
+
+	tagsPath := fmt.Sprintf("/posts/%d/tags", first.ID)
+	if w := serve(router, http.MethodPost, tagsPath, fmt.Sprintf(`{"tag_ids":[%d,%d]}`, tag.ID, tag.ID)); w.Code != http.StatusOK {
+		t.Errorf("add tags: status = %d, body = %s", w.Code, w.Body)
+	}
+	if w := serve(router, http.MethodPost, tagsPath, `{"tag_ids":[999]}`); w.Code != http.StatusNotFound {
+		t.Errorf("add unknown tag: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serve(router, http.MethodDelete, fmt.Sprintf("%s/%d", tagsPath, tag.ID), ""); w.Code != http.StatusOK {
+		t.Errorf("remove tag: status = %d, body = %s", w.Code, w.Body)
+	}
+	if count := db.Model(&first).Association("Tags").Count(); count != 0 {
+		t.Errorf("post has %d tags after removal, want 0", count)
+	}
+
+	path := fmt.Sprintf("/posts/%d", first.ID)
+	if w := serve(router, http.MethodDelete, path, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete: status = %d, body = %s", w.Code, w.Body)
+	}
+	if w := serve(router, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serve(router, http.MethodGet, "/posts/abc", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestListPosts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	author := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	category := models.Category{Name: "News", Slug: "news"}
+	for _, record := range []interface{}{&author, &category} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, title := range []string{"Go generics", "Rust traits", "Go modules", "SQL joins", "Go testing"} {
+		status := "draft"
+		if i%2 == 0 {
+			status = "published"
+		}
+		post := models.Post{Title: title, Slug: fmt.Sprintf("post-%d", i), Content: "text", Status: status, UserID: author.ID, CategoryID: category.ID}
+		if err := db.Create(&post).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := gin.New()
+	router.GET("/posts", ListPosts)
+
+	type page struct {
+		Data []struct {
+			Title  string `json:"title"`
+			Status string `json:"status"`
+		} `json:"data"`
+		Pagination struct {
+			Page       int   `json:"page"`
+			Total      int64 `json:"total"`
+			TotalPages int   `json:"total_pages"`
+			HasNext    bool  `json:"has_next"`
+			HasPrev    bool  `json:"has_prev"`
+		} `json:"pagination"`
+	}
+	list := func(query string) page {
+		t.Helper()
+		w := serve(router, http.MethodGet, "/posts?"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", query, w.Code, w.Body)
+		}
+		var p page
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	titles := func(p page) string {
+		var titles []string
+		for _, post := range p.Data {
+			titles = append(titles, post.Title)
+		}
+		return strings.Join(titles, ", ")
+	}
+
+	p := list("page=2&per_page=2")
+	if got := titles(p); got != "Go modules, SQL joins" {
+		t.Errorf("page 2 = %s", got)
+	}
+	if p.Pagination.Page != 2 || p.Pagination.Total != 5 || p.Pagination.TotalPages != 3 || !p.Pagination.HasNext || !p.Pagination.HasPrev {
+		t.Errorf("pagination = %+v", p.Pagination)
+	}
+
+	if got := titles(list("q=go&sort=title&order=desc")); got != "Go testing, Go modules, Go generics" {
+		t.Errorf("search = %s", got)
+	}
+	p = list("filter[status][eq]=published")
+	if got := titles(p); got != "Go generics, Go modules, Go testing" || p.Pagination.Total != 3 {
+		t.Errorf("filter = %s (total %d)", got, p.Pagination.Total)
+	}
+}
+
+func TestPostFieldsetsAndIncludes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	author := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	category := models.Category{Name: "News", Slug: "news"}
+	for _, record := range []interface{}{&author, &category} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	post := models.Post{Title: "Hello", Slug: "hello", Content: "text", UserID: author.ID, CategoryID: category.ID}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	comment := models.Comment{Content: "first", UserID: author.ID, PostID: post.ID}
+	if err := db.Create(&comment).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/posts", ListPosts)
+	router.GET("/posts/:id", GetPost)
+
+	// keys returns the sorted keys of a JSON object
+	keys := func(object map[string]json.RawMessage) string {
+		var names []string
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct {
+		query string
+		keys  string // of the post object
+	}{
+		{"fields=title", "id,title"},
+		{"fields=title,slug&include=user", "id,slug,title,user"},
+		{"fields=title&include=category,comments.user", "category,comments,id,title"},
+		{"include=user", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var object map[string]json.RawMessage
+			w := serve(router, http.MethodGet, fmt.Sprintf("/posts/%d?%s", post.ID, tt.query), "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &object); err != nil {
+				t.Fatal(err)
+			}
+			if tt.keys != "" && keys(object) != tt.keys {
+				t.Errorf("keys = %s, want %s", keys(object), tt.keys)
+			}
+			if strings.Contains(tt.query, "user") && !strings.Contains(w.Body.String(), `"username":"alice"`) {
+				t.Errorf("author not included: %s", w.Body)
+			}
+
+			// The list endpoint projects every item the same way
+			var list struct {
+				Data []map[string]json.RawMessage `json:"data"`
+			}
+			w = serve(router, http.MethodGet, "/posts?"+tt.query, "")
+			if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Data) != 1 {
+				t.Fatalf("list: status = %d, body = %s", w.Code, w.Body)
+			}
+			if keys(list.Data[0]) != keys(object) {
+				t.Errorf("list keys = %s, want %s", keys(list.Data[0]), keys(object))
+			}
+		})
+	}
+
+	for _, query := range []string{"fields=password", "fields=nope", "include=secrets", "include=comments.user.profile"} {
+		t.Run(query, func(t *testing.T) {
+			for _, path := range []string{fmt.Sprintf("/posts/%d?%s", post.ID, query), "/posts?" + query} {
+				if w := serve(router, http.MethodGet, path, ""); w.Code != http.StatusBadRequest {
+					t.Errorf("%s: status = %d, want %d", path, w.Code, http.StatusBadRequest)
+				}
+			}
+		})
+	}
+}
+
+func TestIncludedAuthorsArePublic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	author := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true, EmailVerified: true}
+	category := models.Category{Name: "News", Slug: "news"}
+	if err := db.Create(&author).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	post := models.Post{Title: "Hello", Slug: "hello", Content: "text", UserID: author.ID, CategoryID: category.ID}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	comment := models.Comment{Content: "first", UserID: author.ID, PostID: post.ID}
+	if err := db.Create(&comment).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/posts", ListPosts)
+	router.GET("/posts/:id", GetPost)
+	router.GET("/comments", ListComments)
+	router.GET("/comments/:id", GetComment)
+
+	tests := []string{
+		"/posts?include=user",
+		"/posts?include=comments.user",
+		fmt.Sprintf("/posts/%d?include=user,comments.user", post.ID),
+		"/comments?include=user",
+		fmt.Sprintf("/comments/%d?include=user", comment.ID),
+		fmt.Sprintf("/comments/%d?include=user&fields=content", comment.ID),
+	}
+
+	for _, path := range tests {
+		t.Run(path, func(t *testing.T) {
+			w := serve(router, http.MethodGet, path, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, `"username":"alice"`) {
+				t.Errorf("author not included: %s", body)
+			}
+			for _, field := range []string{"email", "is_active", "email_verified", "locked_until", "failed_login_attempts"} {
+				if strings.Contains(body, `"`+field+`"`) {
+					t.Errorf("response exposes %s: %s", field, body)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdatePostCategoryChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	rbac := auth.NewRBACService(db)
+	if err := rbac.InitializeDefaultRoles(); err != nil {
+		t.Fatal(err)
+	}
+	engine := policy.NewEngine(db, rbac)
+	if err := engine.AddRules(policy.DefaultRules()...); err != nil {
+		t.Fatal(err)
+	}
+
+	author := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	editor := models.User{Username: "bob", Email: "bob@example.com", Password: "x", IsActive: true}
+	news := models.Category{Name: "News", Slug: "news"}
+	sports := models.Category{Name: "Sports", Slug: "sports"}
+	for _, record := range []interface{}{&author, &editor, &news, &sports} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	post := models.Post{Title: "Hello", Slug: "hello", Content: "text", UserID: author.ID, CategoryID: news.ID}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Grant(context.Background(), editor.ID, "editor", "category", news.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.PUT("/posts/:id", func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-User-ID"), &userID)
+		c.Set("user_id", userID)
+	}, middleware.Authorize(engine, "update", PostResource), UpdatePost)
+
+	update := func(userID uint, body string) int {
+		return serve(router, http.MethodPut, fmt.Sprintf("/posts/%d", post.ID), body, "X-User-ID", fmt.Sprint(userID)).Code
+	}
+	category := func() uint {
+		var current models.Post
+		if err := db.First(&current, post.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return current.CategoryID
+	}
+
+	steps := []struct {
+		name     string
+		grant    uint // category the editor is granted before the step
+		userID   uint
+		body     string
+		want     int
+		category uint
+	}{
+		{"editor keeps category", 0, editor.ID, fmt.Sprintf(`{"title":"Edited","category_id":%d}`, news.ID), http.StatusOK, news.ID},
+		{"editor moves to category they do not edit", 0, editor.ID, fmt.Sprintf(`{"category_id":%d}`, sports.ID), http.StatusForbidden, news.ID},
+		{"editor moves to category they edit", sports.ID, editor.ID, fmt.Sprintf(`{"category_id":%d}`, sports.ID), http.StatusOK, sports.ID},
+		{"author moves their post", 0, author.ID, fmt.Sprintf(`{"category_id":%d}`, news.ID), http.StatusOK, news.ID},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if step.grant != 0 {
+				if _, err := engine.Grant(context.Background(), editor.ID, "editor", "category", step.grant); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if code := update(step.userID, step.body); code != step.want {
+				t.Errorf("status = %d, want %d", code, step.want)
+			}
+			if got := category(); got != step.category {
+				t.Errorf("category = %d, want %d", got, step.category)
+			}
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"errors"
+	"go-crud/auth"
+	"go-crud/docs"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/policy"
+	"go-crud/validation"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RBACHandler lets administrators manage roles, their permissions, the
+// roles of users and resource ACL entries at runtime
+type RBACHandler struct {
+	rbacService *auth.RBACService
+	policies    *policy.Engine
+}
+
+func NewRBACHandler(rbacService *auth.RBACService, policies *policy.Engine) *RBACHandler {
+	return &RBACHandler{
+		rbacService: rbacService,
+		policies:    policies,
+	}
+}
+
+// ListRoles returns every role with its direct parents and permissions
+func (h *RBACHandler) ListRoles(c *gin.Context) {
+	roles, err := h.rbacService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to list roles", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	response := make([]docs.RoleResponse, len(roles))
+	for i := range roles {
+		if response[i], err = h.roleResponse(&roles[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to list roles", Code: "INTERNAL_ERROR"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// CreateRole adds a custom role, optionally inheriting from existing roles
+// and granted an initial set of permissions
+func (h *RBACHandler) CreateRole(c *gin.Context) {
+	var req validation.RoleCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateRoleCreate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	permissions, ok := parsePermissions(c, "permissions", req.Permissions)
+	if !ok {
+		return
+	}
+
+	parents := make([]auth.Role, len(req.Parents))
+	for i, parent := range req.Parents {
+		parents[i] = auth.Role(parent)
+	}
+
+	role, err := h.rbacService.CreateRole(auth.Role(req.Name), req.Description, parents)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRoleExists):
+			c.JSON(http.StatusConflict, docs.ErrorResponse{Error: "Role already exists", Code: "CONFLICT", Details: req.Name})
+		case errors.Is(err, auth.ErrRoleNotFound):
+			validator := validation.NewValidator()
+			validator.AddError("parents", err.Error(), "ROLE_NOT_FOUND")
+			respondValidationErrors(c, validator.GetErrors())
+		default:
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to create role", Code: "INTERNAL_ERROR"})
+		}
+		return
+	}
+
+	for _, permission := range permissions {
+		if err := h.rbacService.AddPermission(auth.Role(role.Name), permission); err != nil {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to grant permission", Code: "INTERNAL_ERROR"})
+			return
+		}
+	}
+
+	h.logChange(c, "Role created", map[string]interface{}{"role": role.Name})
+	h.respondRole(c, http.StatusCreated, role)
+}
+
+// GetRole returns one role with its direct parents and permissions
+func (h *RBACHandler) GetRole(c *gin.Context) {
+	role, ok := h.lookupRole(c)
+	if !ok {
+		return
+	}
+	h.respondRole(c, http.StatusOK, role)
+}
+
+// DeleteRole removes a custom role and takes it away from every user
+func (h *RBACHandler) DeleteRole(c *gin.Context) {
+	name := c.Param("role")
+	if err := h.rbacService.DeleteRole(auth.Role(name)); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRoleNotFound):
+			c.JSON(http.StatusNotFound, docs.ErrorResponse{Error: "Role not found", Code: "NOT_FOUND"})
+		case errors.Is(err, auth.ErrSystemRole):
+			c.JSON(http.StatusConflict, docs.ErrorResponse{Error: "System roles cannot be deleted", Code: "SYSTEM_ROLE", Details: name})
+		default:
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to delete role", Code: "INTERNAL_ERROR"})
+		}
+		return
+	}
+
+	h.logChange(c, "Role deleted", map[string]interface{}{"role": name})
+	c.JSON(http.StatusOK, docs.SuccessResponse{Message: "Role deleted"})
+}
+
+// GrantPermission grants a permission, possibly a wildcard, to a role
+func (h *RBACHandler) GrantPermission(c *gin.Context) {
+	role, ok := h.lookupRole(c)
+	if !ok {
+		return
+	}
+
+	var req validation.RolePermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	permissions, ok := parsePermissions(c, "permission", []string{req.Permission})
+	if !ok {
+		return
+	}
+
+	if err := h.rbacService.AddPermission(auth.Role(role.Name), permissions[0]); err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to grant permission", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	h.logChange(c, "Permission granted", map[string]interface{}{"role": role.Name, "permission": string(permissions[0])})
+	h.respondRole(c, http.StatusOK, role)
+}
+
+// RevokePermission takes a permission away from a role
+func (h *RBACHandler) RevokePermission(c *gin.Context) {
+	role, ok := h.lookupRole(c)
+	if !ok {
+		return
+	}
+
+	permission := auth.Permission(c.Param("permission"))
+	if err := h.rbacService.RemovePermission(auth.Role(role.Name), permission); err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to revoke permission", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	h.logChange(c, "Permission revoked", map[string]interface{}{"role": role.Name, "permission": string(permission)})
+	h.respondRole(c, http.StatusOK, role)
+}
+
+// AddRoleParent makes a role inherit from another role. Edges that would
+// make a role inherit from itself are refused.
+func (h *RBACHandler) AddRoleParent(c *gin.Context) {
+	role, ok := h.lookupRole(c)
+	if !ok {
+		return
+	}
+
+	var req validation.RoleParentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if _, err := h.rbacService.GetRole(auth.Role(req.Parent)); err != nil {
+		if errors.Is(err, auth.ErrRoleNotFound) {
+			validator := validation.NewValidator()
+			validator.AddError("parent", "Unknown role: "+req.Parent, "ROLE_NOT_FOUND")
+			respondValidationErrors(c, validator.GetErrors())
+			return
+		}
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to look up role", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	if err := h.rbacService.AddRoleParent(auth.Role(role.Name), auth.Role(req.Parent)); err != nil {
+		if errors.Is(err, auth.ErrRoleCycle) {
+			c.JSON(http.StatusConflict, docs.ErrorResponse{Error: "Role inheritance would create a cycle", Code: "ROLE_CYCLE", Details: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to add parent role", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	h.logChange(c, "Parent role added", map[string]interface{}{"role": role.Name, "parent": req.Parent})
+	h.respondRole(c, http.StatusOK, role)
+}
+
+// RemoveRoleParent stops a role from inheriting from another role
+func (h *RBACHandler) RemoveRoleParent(c *gin.Context) {
+	role, ok := h.lookupRole(c)
+	if !ok {
+		return
+	}
+
+	parent := c.Param("parent")
+	if err := h.rbacService.RemoveRoleParent(auth.Role(role.Name), auth.Role(parent)); err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to remove parent role", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	h.logChange(c, "Parent role removed", map[string]interface{}{"role": role.Name, "parent": parent})
+	h.respondRole(c, http.StatusOK, role)
+}
+
+// GetUserRoles returns the roles assigned to a user and those in effect
+func (h *RBACHandler) GetUserRoles(c *gin.Context) {
+	userID, ok := h.lookupUser(c)
+	if !ok {
+		return
+	}
+	h.respondUserRoles(c, userID)
+}
+
+// AssignUserRole gives a role of the catalogue to a user. Access tokens
+// carry roles, so the change reaches the user's tokens when they refresh.
+func (h *RBACHandler) AssignUserRole(c *gin.Context) {
+	userID, ok := h.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	var req validation.UserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if _, err := h.rbacService.GetRole(auth.Role(req.Role)); err != nil {
+		if errors.Is(err, auth.ErrRoleNotFound) {
+			validator := validation.NewValidator()
+			validator.AddError("role", "Unknown role: "+req.Role, "ROLE_NOT_FOUND")
+			respondValidationErrors(c, validator.GetErrors())
+			return
+		}
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to look up role", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	if err := h.rbacService.AssignRole(userID, auth.Role(req.Role)); err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to assign role", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	h.logChange(c, "Role assigned", map[string]interface{}{"target_user_id": userID, "role": req.Role})
+	h.respondUserRoles(c, userID)
+}
+
+// RemoveUserRole takes a role away from a user. Administrators cannot drop
+// their own admin role, so the API is never left without one by accident.
+func (h *RBACHandler) RemoveUserRole(c *gin.Context) {
+	userID, ok := h.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	role := c.Param("role")
+	if requesterID, _ := currentUserID(c); requesterID == userID && role == string(auth.Admin) {
+		c.JSON(http.StatusConflict, docs.ErrorResponse{Error: "You cannot remove your own admin role", Code: "CONFLICT"})
+		return
+	}
+
+	if err := h.rbacService.RemoveRole(userID, auth.Role(role)); err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to remove role", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	h.logChange(c, "Role removed", map[string]interface{}{"target_user_id": userID, "role": role})
+	h.respondUserRoles(c, userID)
+}
+
+// GetUserPermissions returns the effective permissions of a user, inherited
+// and wildcard permissions included
+func (h *RBACHandler) GetUserPermissions(c *gin.Context) {
+	userID, ok := h.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	roles, err := h.rbacService.GetUserRoles(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to resolve permissions", Code: "INTERNAL_ERROR"})
+		return
+	}
+	permissions, err := h.rbacService.GetUserPermissions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to resolve permissions", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.UserPermissionsResponse{
+		UserID:      userID,
+		Roles:       nonNil(roles),
+		Permissions: nonNil(permissions),
+	})
+}
+
+// ListACL returns the ACL entries of a resource type, or of one resource
+// with ?resource_id=
+func (h *RBACHandler) ListACL(c *gin.Context) {
+	resourceType := c.Query("resource_type")
+	if resourceType == "" {
+		validator := validation.NewValidator()
+		validator.AddError("resource_type", "resource_type is required", "REQUIRED")
+		respondValidationErrors(c, validator.GetErrors())
+		return
+	}
+
+	var resourceID uint64
+	if raw := c.Query("resource_id"); raw != "" {
+		var err error
+		if resourceID, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid resource_id", Code: "BAD_REQUEST"})
+			return
+		}
+	}
+
+	entries, err := h.policies.ListGrants(c.Request.Context(), resourceType, uint(resourceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to list ACL entries", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	response := make([]docs.ACLEntryResponse, len(entries))
+	for i := range entries {
+		response[i] = toACLEntryResponse(&entries[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// GrantACL gives a user a relation, such as editor, to one resource.
+// Policies decide what the relation allows.
+func (h *RBACHandler) GrantACL(c *gin.Context) {
+	var req validation.ACLGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid request", Code: "BAD_REQUEST", Details: err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateACLGrant(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	var user models.User
+	if err := db.Select("id").First(&user, req.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			validator := validation.NewValidator()
+			validator.AddError("user_id", "User not found", "USER_NOT_FOUND")
+			respondValidationErrors(c, validator.GetErrors())
+		} else {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to look up user", Code: "INTERNAL_ERROR"})
+		}
+		return
+	}
+
+	entry, err := h.policies.Grant(c.Request.Context(), req.UserID, req.Relation, req.ResourceType, req.ResourceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to grant access", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	h.logChange(c, "ACL entry granted", map[string]interface{}{
+		"target_user_id": req.UserID,
+		"resource_type":  req.ResourceType,
+		"resource_id":    req.ResourceID,
+		"relation":       req.Relation,
+	})
+	c.JSON(http.StatusCreated, toACLEntryResponse(entry))
+}
+
+// RevokeACL deletes an ACL entry
+func (h *RBACHandler) RevokeACL(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.policies.Revoke(c.Request.Context(), id); err != nil {
+		if errors.Is(err, policy.ErrACLEntryNotFound) {
+			c.JSON(http.StatusNotFound, docs.ErrorResponse{Error: "ACL entry not found", Code: "NOT_FOUND"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to revoke access", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	h.logChange(c, "ACL entry revoked", map[string]interface{}{"acl_entry_id": id})
+	c.JSON(http.StatusOK, docs.SuccessResponse{Message: "Access revoked"})
+}
+
+func (h *RBACHandler) lookupRole(c *gin.Context) (*models.Role, bool) {
+	role, err := h.rbacService.GetRole(auth.Role(c.Param("role")))
+	if err != nil {
+		if errors.Is(err, auth.ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, docs.ErrorResponse{Error: "Role not found", Code: "NOT_FOUND"})
+		} else {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to look up role", Code: "INTERNAL_ERROR"})
+		}
+		return nil, false
+	}
+	return role, true
+}
+
+func (h *RBACHandler) lookupUser(c *gin.Context) (uint, bool) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return 0, false
+	}
+
+	var user models.User
+	if err := db.Select("id").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, docs.ErrorResponse{Error: "User not found", Code: "NOT_FOUND"})
+		} else {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to look up user", Code: "INTERNAL_ERROR"})
+		}
+		return 0, false
+	}
+	return user.ID, true
+}
+
+func (h *RBACHandler) respondRole(c *gin.Context, status int, role *models.Role) {
+	response, err := h.roleResponse(role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to load role", Code: "INTERNAL_ERROR"})
+		return
+	}
+	c.JSON(status, response)
+}
+
+func (h *RBACHandler) roleResponse(role *models.Role) (docs.RoleResponse, error) {
+	parents, err := h.rbacService.GetRoleParents(auth.Role(role.Name))
+	if err != nil {
+		return docs.RoleResponse{}, err
+	}
+	permissions, err := h.rbacService.GetRolePermissions(auth.Role(role.Name))
+	if err != nil {
+		return docs.RoleResponse{}, err
+	}
+
+	return docs.RoleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		System:      role.System,
+		Parents:     nonNil(parents),
+		Permissions: nonNil(permissions),
+		CreatedAt:   role.CreatedAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (h *RBACHandler) respondUserRoles(c *gin.Context, userID uint) {
+	assigned, err := h.rbacService.GetAssignedRoles(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to load roles", Code: "INTERNAL_ERROR"})
+		return
+	}
+	effective, err := h.rbacService.GetUserRoles(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to load roles", Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, docs.UserRolesResponse{
+		UserID:         userID,
+		Roles:          nonNil(assigned),
+		EffectiveRoles: nonNil(effective),
+	})
+}
+
+// logChange records who changed access control, for auditing
+func (h *RBACHandler) logChange(c *gin.Context, message string, fields map[string]interface{}) {
+	adminID, _ := currentUserID(c)
+	logging.GetLogger().WithUserID(adminID).Info(message, fields)
+}
+
+// parsePermissions parses permission names, answering 422 for unknown ones
+func parsePermissions(c *gin.Context, field string, names []string) ([]auth.Permission, bool) {
+	validator := validation.NewValidator()
+	permissions := make([]auth.Permission, 0, len(names))
+	for _, name := range names {
+		permission, err := auth.ParsePermission(name)
+		if err != nil {
+			validator.AddError(field, err.Error(), "INVALID_PERMISSION")
+			continue
+		}
+		permissions = append(permissions, permission)
+	}
+	if validator.HasErrors() {
+		respondValidationErrors(c, validator.GetErrors())
+		return nil, false
+	}
+	return permissions, true
+}
+
+// nonNil makes empty lists render as [] rather than null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func toACLEntryResponse(entry *models.ACLEntry) docs.ACLEntryResponse {
+	return docs.ACLEntryResponse{
+		ID:           entry.ID,
+		UserID:       entry.UserID,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		Relation:     entry.Relation,
+		CreatedAt:    entry.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"go-crud/auth"
+	"go-crud/docs"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRBACTest returns the admin API behind RequireRole, an admin and a
+// member with the user role. The X-User-ID header stands in for
+// AuthMiddleware.
+func newRBACTest(t *testing.T) (http.Handler, *auth.RBACService, []string, []string) {
+	t.Helper()
+	setupTestDB(t)
+
+	rbacService := auth.NewRBACService(db)
+	if err := rbacService.InitializeDefaultRoles(); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := models.User{Username: "admin", Email: "admin@example.com", Password: "x", IsActive: true}
+	member := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	for _, user := range []*models.User{&admin, &member} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rbacService.AssignRole(admin.ID, auth.Admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbacService.AssignRole(member.ID, auth.User); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewRBACHandler(rbacService, policy.NewEngine(db, rbacService))
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		var userID uint
+		if _, err := fmt.Sscan(c.GetHeader("X-User-ID"), &userID); err == nil {
+			c.Set("user_id", userID)
+		}
+	})
+	adminAPI := router.Group("/admin", middleware.RequireRole(rbacService, auth.Admin))
+	adminAPI.GET("/roles", handler.ListRoles)
+	adminAPI.POST("/roles", handler.CreateRole)
+	adminAPI.DELETE("/roles/:role", handler.DeleteRole)
+	adminAPI.POST("/roles/:role/permissions", handler.GrantPermission)
+	adminAPI.DELETE("/roles/:role/permissions/:permission", handler.RevokePermission)
+	adminAPI.POST("/roles/:role/parents", handler.AddRoleParent)
+	adminAPI.DELETE("/roles/:role/parents/:parent", handler.RemoveRoleParent)
+	adminAPI.POST("/users/:id/roles", handler.AssignUserRole)
+	adminAPI.DELETE("/users/:id/roles/:role", handler.RemoveUserRole)
+	adminAPI.GET("/users/:id/permissions", handler.GetUserPermissions)
+
+	return router, rbacService,
+		[]string{"X-User-ID", fmt.Sprint(admin.ID)},
+		[]string{"X-User-ID", fmt.Sprint(member.ID)}
+}
+
+func TestAdminAPIRefusesNonAdmins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, _, _, asMember := newRBACTest(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/admin/roles", ""},
+		{http.MethodPost, "/admin/roles", `{"name":"moderator"}`},
+		{http.MethodPost, "/admin/roles/user/permissions", `{"permission":"*:*"}`},
+		{http.MethodPost, "/admin/users/2/roles", `{"role":"admin"}`},
+	}
+
+	for _, tt := range tests {
+		w := serve(router, tt.method, tt.path, tt.body, asMember...)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, http.StatusForbidden)
+		}
+		if w := serve(router, tt.method, tt.path, tt.body); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s anonymous: status = %d, want %d", tt.method, tt.path, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	var count int64
+	db.Model(&models.Role{}).Where("name = ?", "moderator").Count(&count)
+	if count != 0 {
+		t.Error("role created by a non-admin")
+	}
+}
+
+func TestAdminAPIRefusesInheritanceCycles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, rbacService, asAdmin, _ := newRBACTest(t)
+
+	if w := serve(router, http.MethodPost, "/admin/roles", `{"name":"moderator","parents":["user"]}`, asAdmin...); w.Code != http.StatusCreated {
+		t.Fatalf("create role: status = %d, body = %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		role   string
+		parent string
+	}{
+		{"itself", "moderator", "moderator"},
+		{"a role inheriting from it", "user", "moderator"},
+		{"through several roles", "guest", "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPost, "/admin/roles/"+tt.role+"/parents", `{"parent":"`+tt.parent+`"}`, asAdmin...)
+			var body docs.ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != http.StatusConflict || body.Code != "ROLE_CYCLE" {
+				t.Errorf("status = %d, body = %s, want %d ROLE_CYCLE", w.Code, w.Body, http.StatusConflict)
+			}
+			if parents, _ := rbacService.GetRoleParents(auth.Role(tt.role)); slices.Contains(parents, tt.parent) {
+				t.Errorf("%s inherits from %s after the refusal", tt.role, tt.parent)
+			}
+		})
+	}
+
+	if w := serve(router, http.MethodPost, "/admin/roles/moderator/parents", `{"parent":"nobody"}`, asAdmin...); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown parent: status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	w := serve(router, http.MethodPost, "/admin/roles/moderator/parents", `{"parent":"guest"}`, asAdmin...)
+	var role docs.RoleResponse
+	json.Unmarshal(w.Body.Bytes(), &role)
+	if w.Code != http.StatusOK || !slices.Equal(role.Parents, []string{"guest", "user"}) {
+		t.Errorf("add parent: status = %d, body = %s", w.Code, w.Body)
+	}
+}
+
+func TestAdminAPIChangesApplyImmediately(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, rbacService, asAdmin, asMember := newRBACTest(t)
+	member := asMember[1]
+
+	var memberID uint
+	fmt.Sscan(member, &memberID)
+	hasReadUser := func() bool {
+		t.Helper()
+		allowed, err := rbacService.HasPermission(memberID, auth.ReadUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed
+	}
+
+	// Warm the permission cache before every change
+	if hasReadUser() {
+		t.Fatal("member can read users before any change")
+	}
+	if w := serve(router, http.MethodPost, "/admin/roles/user/permissions", `{"permission":"read:user"}`, asAdmin...); w.Code != http.StatusOK {
+		t.Fatalf("grant: status = %d, body = %s", w.Code, w.Body)
+	}
+	if !hasReadUser() {
+		t.Error("granted permission not in effect")
+	}
+
+	if w := serve(router, http.MethodDelete, "/admin/roles/user/permissions/read:user", "", asAdmin...); w.Code != http.StatusOK {
+		t.Fatalf("revoke: status = %d, body = %s", w.Code, w.Body)
+	}
+	if hasReadUser() {
+		t.Error("revoked permission still in effect")
+	}
+
+	if w := serve(router, http.MethodPost, "/admin/roles", `{"name":"auditor","permissions":["read:*"]}`, asAdmin...); w.Code != http.StatusCreated {
+		t.Fatalf("create role: status = %d, body = %s", w.Code, w.Body)
+	}
+	if w := serve(router, http.MethodPost, "/admin/users/"+member+"/roles", `{"role":"auditor"}`, asAdmin...); w.Code != http.StatusOK {
+		t.Fatalf("assign: status = %d, body = %s", w.Code, w.Body)
+	}
+	if !hasReadUser() {
+		t.Error("permission of an assigned role not in effect")
+	}
+
+	w := serve(router, http.MethodGet, "/admin/users/"+member+"/permissions", "", asAdmin...)
+	var permissions docs.UserPermissionsResponse
+	json.Unmarshal(w.Body.Bytes(), &permissions)
+	if !slices.Contains(permissions.Roles, "guest") || !slices.Contains(permissions.Permissions, "read:*") {
+		t.Errorf("effective permissions = %s", w.Body)
+	}
+
+	if w := serve(router, http.MethodDelete, "/admin/roles/auditor", "", asAdmin...); w.Code != http.StatusOK {
+		t.Fatalf("delete role: status = %d, body = %s", w.Code, w.Body)
+	}
+	if hasReadUser() {
+		t.Error("permission of a deleted role still in effect")
+	}
+
+	if w := serve(router, http.MethodDelete, "/admin/roles/user", "", asAdmin...); w.Code != http.StatusConflict {
+		t.Errorf("delete system role: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := serve(router, http.MethodDelete, "/admin/users/"+asAdmin[1]+"/roles/admin", "", asAdmin...); w.Code != http.StatusConflict {
+		t.Errorf("remove own admin role: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"go-crud/models"
+	"go-crud/utils"
+	"go-crud/validation"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tagSearchFields are the columns matched by the q search parameter
+var tagSearchFields = []string{"name", "slug"}
+
+// tagIncludes are the relations a tag may embed with ?include=
+var tagIncludes = utils.Includes{
+	"posts": "Posts",
+}
+
+// ListTags lists tags with pagination, filtering and search
+func ListTags(c *gin.Context) {
+	var tags []models.Tag
+	respondPaginated(c, db.Model(&models.Tag{}), tagSearchFields, tagIncludes, &tags)
+}
+
+// CreateTag creates a new tag
+func CreateTag(c *gin.Context) {
+	var req validation.TagCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateTagCreate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	slug, err := uniqueSlug(&models.Tag{}, req.Slug, req.Name, 0)
+	if err != nil {
+		respondSlugError(c, err)
+		return
+	}
+
+	tag := models.Tag{
+		Name: req.Name,
+		Slug: slug,
+	}
+
+	if err := db.Create(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// GetTag retrieves a tag by ID
+func GetTag(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	query, fieldset, ok := applyFieldset(c, db.Model(&models.Tag{}), tagIncludes)
+	if !ok {
+		return
+	}
+
+	var tag models.Tag
+	if err := query.First(&tag, id).Error; err != nil {
+		respondTagLookupError(c, err)
+		return
+	}
+
+	respondFieldset(c, http.StatusOK, fieldset, tag)
+}
+
+// UpdateTag updates a tag
+func UpdateTag(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var tag models.Tag
+	if err := db.First(&tag, id).Error; err != nil {
+		respondTagLookupError(c, err)
+		return
+	}
+
+	var req validation.TagUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := validation.ValidateTagUpdate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Slug != nil {
+		slug, err := uniqueSlug(&models.Tag{}, *req.Slug, "", tag.ID)
+		if err != nil {
+			respondSlugError(c, err)
+			return
+		}
+		updates["slug"] = slug
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&tag).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.First(&tag, tag.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag deletes a tag and detaches it from all posts
+func DeleteTag(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var tag models.Tag
+	if err := db.First(&tag, id).Error; err != nil {
+		respondTagLookupError(c, err)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.PostTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+// ListTagPosts lists the posts carrying a tag
+func ListTagPosts(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var tag models.Tag
+	if err := db.First(&tag, id).Error; err != nil {
+		respondTagLookupError(c, err)
+		return
+	}
+
+	postIDs := db.Model(&models.PostTag{}).Select("post_id").Where("tag_id = ?", tag.ID)
+
+	var posts []models.Post
+	respondPaginated(c, db.Model(&models.Post{}).Where("id IN (?)", postIDs), postSearchFields, postIncludes, &posts)
+}
+
+func respondTagLookupError(c *gin.Context, err error) {
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -1,91 +1,314 @@
 package handlers
 
 import (
+	"errors"
+	"go-crud/auth"
+	"go-crud/logging"
 	"go-crud/models"
+	"go-crud/utils"
+	"go-crud/validation"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// UserHandler serves the user resource
+type UserHandler struct {
+	authService *auth.AuthService
+	rbacService *auth.RBACService
+}
+
+func NewUserHandler(authService *auth.AuthService, rbacService *auth.RBACService) *UserHandler {
+	return &UserHandler{
+		authService: authService,
+		rbacService: rbacService,
+	}
+}
+
+// userSearchFields are the columns matched by the q search parameter
+var userSearchFields = []string{"username", "email", "first_name", "last_name"}
+
+// userIncludes are the relations a user may embed with ?include=
+var userIncludes = utils.Includes{
+	"profile": "Profile",
+}
+
+// ListUsers lists users with pagination, filtering and search
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	var users []models.User
+	respondPaginated(c, db.Model(&models.User{}), userSearchFields, userIncludes, &users)
+}
+
 // CreateUser creates a new user
-func CreateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req validation.UserCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	
-	if err := db.Create(&user).Error; err != nil {
+
+	if errs := validation.ValidateUserCreate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if ok := requireUniqueUser(c, 0, &req.Username, &req.Email); !ok {
+		return
+	}
+
+	hashedPassword, err := h.authService.HashPassword(req.Password)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	
+
+	user := models.User{
+		Username:  req.Username,
+		Email:     req.Email,
+		Password:  hashedPassword,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		IsActive:  true,
+	}
+
+	// Like registered accounts, the user starts with the default role
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserRole{UserID: user.ID, Role: string(auth.DefaultRole)}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusCreated, user)
 }
 
 // GetUser retrieves a user by ID
-func GetUser(c *gin.Context) {
+func (h *UserHandler) GetUser(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	query, fieldset, ok := applyFieldset(c, db.Model(&models.User{}), userIncludes)
+	if !ok {
+		return
+	}
+
 	var user models.User
-	id := c.Param("id")
-	
-	if err := db.Preload("Profile").First(&user, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := query.First(&user, id).Error; err != nil {
+		respondUserLookupError(c, err)
 		return
 	}
-	
-	c.JSON(http.StatusOK, user)
+
+	respondFieldset(c, http.StatusOK, fieldset, user)
 }
 
-// UpdateUser updates a user
-func UpdateUser(c *gin.Context) {
+// UpdateUser applies a partial update to a user. Only the fields present in
+// the request body are changed; is_active may only be changed by admins.
+// Users changing their own email or password must confirm the change with
+// current_password, so a stolen access token cannot take over the account.
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
 	var user models.User
-	id := c.Param("id")
-	
 	if err := db.First(&user, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUserLookupError(c, err)
 		return
 	}
-	
-	if err := c.ShouldBindJSON(&user); err != nil {
+
+	var req validation.UserUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	
-	if err := db.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+
+	if errs := validation.ValidateUserUpdate(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
 		return
 	}
-	
+
+	requesterID, _ := currentUserID(c)
+	if req.IsActive != nil {
+		if err := h.rbacService.RequireRole(requesterID, auth.Admin); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can change is_active", "code": "FORBIDDEN"})
+			return
+		}
+	}
+
+	emailChanged := req.Email != nil && *req.Email != user.Email
+	if requesterID == user.ID && (emailChanged || req.Password != nil) {
+		if req.CurrentPassword == nil || *req.CurrentPassword == "" {
+			respondValidationErrors(c, []validation.ValidationError{{Field: "current_password", Message: "This field is required", Code: "REQUIRED"}})
+			return
+		}
+		if err := h.authService.CheckPassword(user.Password, *req.CurrentPassword); err != nil {
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect", "code": "INVALID_CREDENTIALS"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if ok := requireUniqueUser(c, user.ID, req.Username, req.Email); !ok {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Username != nil {
+		updates["username"] = *req.Username
+	}
+	if req.Email != nil {
+		updates["email"] = *req.Email
+	}
+	if emailChanged {
+		// The new address has to be verified again
+		updates["email_verified"] = false
+		updates["email_verified_at"] = nil
+	}
+	if req.FirstName != nil {
+		updates["first_name"] = *req.FirstName
+	}
+	if req.LastName != nil {
+		updates["last_name"] = *req.LastName
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if req.Password != nil {
+		hashedPassword, err := h.authService.HashPassword(*req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		updates["password"] = hashedPassword
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.First(&user, user.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Outstanding tokens must not outlive a password change or deactivation
+	if req.Password != nil || (req.IsActive != nil && !*req.IsActive) {
+		if err := h.authService.RevokeUserTokens(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if emailChanged {
+		if err := h.authService.SendEmailVerification(&user); err != nil {
+			logging.GetLogger().WithUserID(user.ID).Error("Failed to send verification email", map[string]interface{}{"error": err.Error()})
+		}
+	}
+
 	c.JSON(http.StatusOK, user)
 }
 
 // DeleteUser deletes a user
-func DeleteUser(c *gin.Context) {
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
 	var user models.User
-	id := c.Param("id")
-	
 	if err := db.First(&user, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUserLookupError(c, err)
 		return
 	}
-	
+
 	if err := db.Delete(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	
+
+	if err := h.authService.RevokeUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// UnlockUser lifts the login lockout of a user
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.authService.UnlockAccount(id, clientInfo(c)); err != nil {
+		if errors.Is(err, auth.ErrAccountNotLocked) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is not locked"})
+			return
+		}
+		respondUserLookupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
+
+func respondUserLookupError(c *gin.Context, err error) {
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// requireUniqueUser reports username/email clashes with other users as validation errors
+func requireUniqueUser(c *gin.Context, excludeID uint, username, email *string) bool {
+	validator := validation.NewValidator()
+
+	checks := []struct {
+		field  string
+		column string
+		value  *string
+	}{
+		{"username", "username", username},
+		{"email", "email", email},
+	}
+
+	for _, check := range checks {
+		if check.value == nil {
+			continue
+		}
+
+		var count int64
+		query := db.Model(&models.User{}).Unscoped().Where(check.column+" = ?", *check.value)
+		if excludeID != 0 {
+			query = query.Where("id <> ?", excludeID)
+		}
+		if err := query.Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if count > 0 {
+			validator.AddError(check.field, "This value is already taken", "ALREADY_EXISTS")
+		}
+	}
+
+	if validator.HasErrors() {
+		respondValidationErrors(c, validator.GetErrors())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go-crud/auth"
+	"go-crud/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	authService := auth.NewAuthService("secret")
+	rbacService := auth.NewRBACService(db)
+	handler := NewUserHandler(authService, rbacService)
+
+	hashed, err := authService.HashPassword("0ld-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := models.User{Username: "alice", Email: "alice@example.com", Password: hashed, FirstName: "Alice", IsActive: true}
+	bob := models.User{Username: "bob", Email: "bob@example.com", Password: "x", IsActive: true}
+	admin := models.User{Username: "admin", Email: "admin@example.com", Password: "x", IsActive: true}
+	for _, user := range []*models.User{&alice, &bob, &admin} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rbacService.AssignRole(admin.ID, auth.Admin); err != nil {
+		t.Fatal(err)
+	}
+
+	// The X-User-ID header stands in for AuthMiddleware
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-User-ID"), &userID)
+		c.Set("user_id", userID)
+	})
+	router.PUT("/users/:id", handler.UpdateUser)
+
+	update := func(requester uint, body string) (int, models.User) {
+		t.Helper()
+		w := serve(router, http.MethodPut, fmt.Sprintf("/users/%d", alice.ID), body, "X-User-ID", fmt.Sprint(requester))
+		var user models.User
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, user
+	}
+
+	code, user := update(alice.ID, `{"last_name":"Smith"}`)
+	if code != http.StatusOK {
+		t.Fatalf("partial update: status = %d", code)
+	}
+	if user.LastName != "Smith" || user.FirstName != "Alice" || user.Email != alice.Email || !user.IsActive {
+		t.Errorf("partial update changed other fields: %+v", user)
+	}
+
+	if code, _ := update(alice.ID, `{"username":"bob"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("taken username: status = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	if code, _ := update(alice.ID, `{"email":"not-an-email"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid email: status = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	if code, _ := update(alice.ID, `{"is_active":false}`); code != http.StatusForbidden {
+		t.Errorf("is_active by owner: status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code, user := update(admin.ID, `{"is_active":false}`); code != http.StatusOK || user.IsActive {
+		t.Errorf("is_active by admin: status = %d, is_active = %v", code, user.IsActive)
+	}
+
+	// Owners confirm email and password changes with their current password
+	if code, _ := update(alice.ID, `{"email":"alice@example.org"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("email without current password: status = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	if code, _ := update(alice.ID, `{"password":"N3w-password"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("password without current password: status = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	if code, _ := update(alice.ID, `{"password":"N3w-password","current_password":"wr0ng-password"}`); code != http.StatusForbidden {
+		t.Errorf("password with a wrong current password: status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code, _ := update(alice.ID, `{"email":"alice@example.com"}`); code != http.StatusOK {
+		t.Errorf("unchanged email: status = %d, want %d", code, http.StatusOK)
+	}
+	if code, _ := update(alice.ID, `{"password":"N3w-password","current_password":"0ld-password"}`); code != http.StatusOK {
+		t.Fatalf("password: status = %d", code)
+	}
+	var stored models.User
+	if err := db.First(&stored, alice.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := authService.CheckPassword(stored.Password, "N3w-password"); err != nil {
+		t.Errorf("password not stored as a hash of the new password: %v", err)
+	}
+
+	if code, user := update(admin.ID, `{"email":"alice@example.org"}`); code != http.StatusOK || user.Email != "alice@example.org" {
+		t.Errorf("email by admin: status = %d, email = %s", code, user.Email)
+	}
+}
+
+func TestCreateUserAssignsDefaultRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	rbacService := auth.NewRBACService(db)
+	router := gin.New()
+	router.POST("/users", NewUserHandler(auth.NewAuthService("secret"), rbacService).CreateUser)
+
+	w := serve(router, http.MethodPost, "/users", registerAlice)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	var user models.User
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := rbacService.HasRole(user.ID, auth.DefaultRole); err != nil || !ok {
+		t.Errorf("created user has the default role: %v, %v", ok, err)
+	}
+}
+
+func TestListUsersRejectsUnknownFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t)
+
+	router := gin.New()
+	router.GET("/users", NewUserHandler(auth.NewAuthService("secret"), auth.NewRBACService(db)).ListUsers)
+
+	for _, query := range []string{"sort=password", "filter[password][eq]=x", "filter[password][like]=%24", "sort=nope", "filter[nope][eq]=x"} {
+		t.Run(query, func(t *testing.T) {
+			w := serve(router, http.MethodGet, "/users?"+query, "")
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+
+			var body struct {
+				Code          string   `json:"code"`
+				AllowedFields []string `json:"allowed_fields"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != "INVALID_FIELD" || len(body.AllowedFields) == 0 {
+				t.Errorf("body = %s", w.Body)
+			}
+			for _, field := range body.AllowedFields {
+				if field == "password" {
+					t.Errorf("allowed_fields = %v, includes password", body.AllowedFields)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"go-crud/config"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+	SentAt  time.Time
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// New returns the mailer selected by cfg.Driver: "smtp", "file" or "memory"
+func New(cfg *config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From), nil
+	case "file":
+		return NewFileMailer(cfg.OutboxDir, cfg.From)
+	case "memory":
+		return NewMemoryMailer(cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver: %s", cfg.Driver)
+	}
+}
+
+// Bytes renders msg as an RFC 5322 message
+func (msg *Message) Bytes() []byte {
+	var buf bytes.Buffer
+
+	sentAt := msg.SentAt
+	if sentAt.IsZero() {
+		sentAt = time.Now()
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", sentAt.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return buf.Bytes()
+}
+
+// validate fills in the sender and rejects messages that cannot be sent
+func (msg *Message) validate(from string) error {
+	if msg.From == "" {
+		msg.From = from
+	}
+	if msg.From == "" {
+		return fmt.Errorf("mail sender is not configured")
+	}
+	if len(msg.To) == 0 {
+		return fmt.Errorf("mail has no recipients")
+	}
+	for _, header := range append([]string{msg.From, msg.Subject}, msg.To...) {
+		if strings.ContainsAny(header, "\r\n") {
+			return fmt.Errorf("invalid mail header %q", header)
+		}
+	}
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now()
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-crud/config"
+)
+
+func TestMessageBytes(t *testing.T) {
+	m := NewMemoryMailer("noreply@example.com")
+	if err := m.Send(&Message{To: []string{"alice@example.com", "bob@example.com"}, Subject: "Grüße", Body: "line 1\nline 2\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := m.Last("BOB@example.com")
+	if !ok {
+		t.Fatal("no message for bob")
+	}
+	raw := string(msg.Bytes())
+	for _, want := range []string{
+		"From: noreply@example.com\r\n",
+		"To: alice@example.com, bob@example.com\r\n",
+		"Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("message does not contain %q:\n%s", want, raw)
+		}
+	}
+}
+
+func TestSendRejectsInvalidMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		msg  Message
+	}{
+		{"no sender", "", Message{To: []string{"alice@example.com"}}},
+		{"no recipients", "noreply@example.com", Message{}},
+		{"header injection in subject", "noreply@example.com", Message{To: []string{"alice@example.com"}, Subject: "Hi\r\nBcc: eve@example.com"}},
+		{"header injection in recipient", "noreply@example.com", Message{To: []string{"alice@example.com\nBcc: eve@example.com"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryMailer(tt.from)
+			if err := m.Send(&tt.msg); err == nil {
+				t.Error("message was sent")
+			}
+			if len(m.Messages()) != 0 {
+				t.Error("rejected message was kept")
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	m, err := New(&config.MailConfig{Driver: "file", OutboxDir: dir, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Send(&Message{To: []string{"alice@example.com"}, Subject: "Hello", Body: "Hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("outbox has %v (%v), want 2 messages", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Subject: Hello\r\n") {
+		t.Errorf("message file:\n%s", data)
+	}
+}
+
+func TestNewRejectsUnknownDriver(t *testing.T) {
+	if _, err := New(&config.MailConfig{Driver: "carrier-pigeon"}); err == nil {
+		t.Error("unknown driver accepted")
+	}
+}
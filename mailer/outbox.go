@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// MemoryMailer keeps sent messages in memory instead of delivering them. It
+// is meant for tests and local development.
+type MemoryMailer struct {
+	mu       sync.RWMutex
+	from     string
+	messages []Message
+}
+
+func NewMemoryMailer(from string) *MemoryMailer {
+	return &MemoryMailer{from: from}
+}
+
+func (m *MemoryMailer) Send(msg *Message) error {
+	if err := msg.validate(m.from); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages returns every message sent so far, oldest first
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	messages := make([]Message, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
+
+// Last returns the most recent message sent to address
+func (m *MemoryMailer) Last(address string) (Message, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		for _, to := range m.messages[i].To {
+			if strings.EqualFold(to, address) {
+				return m.messages[i], true
+			}
+		}
+	}
+	return Message{}, false
+}
+
+// Reset discards all sent messages
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
+
+// FileMailer writes every message as an .eml file into an outbox directory
+type FileMailer struct {
+	mu   sync.Mutex
+	dir  string
+	from string
+	seq  int
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail outbox: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(msg *Message) error {
+	if err := msg.validate(m.from); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq++
+	name := fmt.Sprintf("%s-%04d.eml", msg.SentAt.UTC().Format("20060102T150405.000000000"), m.seq)
+	if err := os.WriteFile(filepath.Join(m.dir, name), msg.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTPMailer delivers messages through an SMTP server. Authentication is
+// only attempted when a username is set; net/smtp upgrades to STARTTLS
+// when the server offers it.
+type SMTPMailer struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		host: host,
+		from: from,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(msg *Message) error {
+	if err := msg.validate(m.from); err != nil {
+		return err
+	}
+
+	sender, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	recipients := make([]string, 0, len(msg.To))
+	for _, to := range msg.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid recipient address: %w", err)
+		}
+		recipients = append(recipients, address.Address)
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, sender.Address, recipients, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
@@ -5,6 +5,10 @@ import (
 	"baton-om-data-apiservice/internal/sysenv"
 	"baton-om-data-apiservice/utils/router"
 	"fmt"
+	"go-crud/auth"
+	"go-crud/config"
+	"go-crud/mailer"
+	"go-crud/models"
 	"log"
 	"os"
 	"os/signal"
@@ -54,8 +58,51 @@ func main() {
 		}
 	}
 
+	// 데이터스토어 API 의 인증 및 권한 확인에 사용할 서비스를 초기화합니다.
+	if config.DB, err = config.ConnectDatabase(config.LoadDatabaseConfig()); err != nil {
+		panic(fmt.Sprintf("%s: 인증 DB 연결 실패: %s", fnc, err.Error()))
+	}
+	if err = models.AutoMigrate(config.DB); err != nil {
+		panic(fmt.Sprintf("%s: 인증 DB 마이그레이션 실패: %s", fnc, err.Error()))
+	}
+	authService, err := auth.NewAuthServiceFromConfig(config.LoadJWTConfig())
+	if err != nil {
+		panic(fmt.Sprintf("%s: 인증 설정 실패: %s", fnc, err.Error()))
+	}
+	// 비밀번호 해시 알고리즘 설정
+	passwords, err := auth.NewPasswordsFromConfig(config.LoadPasswordConfig())
+	if err != nil {
+		panic(fmt.Sprintf("%s: 비밀번호 해시 설정 실패: %s", fnc, err.Error()))
+	}
+	authService.SetPasswords(passwords)
+	// 로그인 실패 잠금(brute-force 방지) 설정
+	authService.SetLockoutOptions(auth.LockoutOptionsFromConfig(config.LoadLockoutConfig()))
+	// 비밀번호 재설정 및 이메일 인증 메일 발송 설정
+	mailConfig := config.LoadMailConfig()
+	mail, err := mailer.New(mailConfig)
+	if err != nil {
+		panic(fmt.Sprintf("%s: 메일 설정 실패: %s", fnc, err.Error()))
+	}
+	if mailConfig.Driver != "smtp" {
+		log.Printf("%s: 경고: MAIL_DRIVER=%s, 계정 메일이 발송되지 않습니다 (SMTP 설정 필요)", fnc, mailConfig.Driver)
+	}
+	authService.SetMailer(mail, auth.AccountOptionsFromConfig(mailConfig))
+	// 외부 OIDC 로그인 설정 (OIDC_ISSUER, OIDC_CLIENT_ID 가 설정된 경우에만 사용)
+	if oidcConfig := config.LoadOIDCConfig(); oidcConfig.Enabled() {
+		authService.SetOIDCProvider(auth.NewOIDCProvider(auth.OIDCOptionsFromConfig(oidcConfig)))
+	}
+	// 폐기된 토큰은 DB 에 저장해 재시작 후에도, 여러 인스턴스 사이에서도 유지합니다.
+	authService.SetRevocationStore(auth.NewDBRevocationStore(config.DB))
+	rbacService := auth.NewRBACService(config.DB)
+	if err = rbacService.InitializeDefaultRoles(); err != nil {
+		panic(fmt.Sprintf("%s: 기본 역할 초기화 실패: %s", fnc, err.Error()))
+	}
+	// 역할을 access token 에 포함하고, 역할이 바뀐 사용자의 토큰은 폐기합니다.
+	authService.SetRoleProvider(rbacService)
+	rbacService.OnRolesChanged(authService.RevokeAccessTokens)
+
 	// Gin 서버를 시작합니다.
-	router.StartGinServer()
+	router.StartGinServer(authService, rbacService)
 
 	// 무한 루프
 	c := make(chan os.Signal, 1)
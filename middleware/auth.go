@@ -1,19 +1,41 @@
 package middleware
 
 import (
+	"errors"
 	"go-crud/auth"
+	"go-crud/docs"
+	"go-crud/models"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// AuthMiddleware accepts an access token ("Authorization: Bearer ...") or a
+// personal API key ("Authorization: ApiKey ..." or "X-API-Key: ...")
 func AuthMiddleware(authService *auth.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if rawKey, ok := apiKeyFromRequest(c); ok {
+			key, err := authService.AuthenticateAPIKey(rawKey, auth.ClientInfo{UserAgent: c.Request.UserAgent(), IPAddress: c.ClientIP()})
+			if err != nil {
+				if errors.Is(err, auth.ErrInvalidAPIKey) {
+					c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Invalid API key", Code: "INVALID_API_KEY"})
+				} else {
+					c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Unable to verify API key", Code: "INTERNAL_ERROR"})
+				}
+				c.Abort()
+				return
+			}
+			
+			setAPIKeyContext(c, key)
+			c.Next()
+			return
+		}
+		
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Authorization header required", Code: "UNAUTHORIZED"})
 			c.Abort()
 			return
 		}
@@ -21,7 +43,7 @@ func AuthMiddleware(authService *auth.AuthService) gin.HandlerFunc {
 		// Check if token starts with "Bearer "
 		tokenParts := strings.Split(authHeader, " ")
 		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+			c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Invalid authorization header format", Code: "UNAUTHORIZED"})
 			c.Abort()
 			return
 		}
@@ -31,7 +53,20 @@ func AuthMiddleware(authService *auth.AuthService) gin.HandlerFunc {
 		// Validate token
 		claims, err := authService.ValidateToken(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Invalid token", Code: "INVALID_TOKEN"})
+			c.Abort()
+			return
+		}
+		
+		// Check the revocation store
+		revoked, err := authService.IsRevoked(claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Unable to verify token", Code: "INTERNAL_ERROR"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, docs.ErrorResponse{Error: "Token has been revoked", Code: "TOKEN_REVOKED"})
 			c.Abort()
 			return
 		}
@@ -40,6 +75,8 @@ func AuthMiddleware(authService *auth.AuthService) gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
+		c.Set("session_id", claims.SessionID)
+		c.Set("claims", claims)
 		
 		c.Next()
 	}
@@ -47,6 +84,15 @@ func AuthMiddleware(authService *auth.AuthService) gin.HandlerFunc {
 
 func OptionalAuthMiddleware(authService *auth.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Invalid API keys are treated as anonymous
+		if rawKey, ok := apiKeyFromRequest(c); ok {
+			if key, err := authService.AuthenticateAPIKey(rawKey, auth.ClientInfo{UserAgent: c.Request.UserAgent(), IPAddress: c.ClientIP()}); err == nil {
+				setAPIKeyContext(c, key)
+			}
+			c.Next()
+			return
+		}
+		
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -70,11 +116,65 @@ func OptionalAuthMiddleware(authService *auth.AuthService) gin.HandlerFunc {
 			return
 		}
 		
+		// Revoked tokens are treated as anonymous
+		if revoked, err := authService.IsRevoked(claims); err != nil || revoked {
+			c.Next()
+			return
+		}
+		
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
+		c.Set("session_id", claims.SessionID)
+		c.Set("claims", claims)
+		
+		c.Next()
+	}
+}
+
+// RequireSession refuses requests authenticated with an API key. It guards
+// account management, so a leaked key cannot create keys or change the
+// password.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := requestAPIKey(c); ok {
+			c.JSON(http.StatusForbidden, docs.ErrorResponse{Error: "API keys cannot be used for this endpoint", Code: "SESSION_REQUIRED"})
+			c.Abort()
+			return
+		}
 		
 		c.Next()
 	}
 }
+
+// apiKeyFromRequest returns the key sent as "Authorization: ApiKey <key>" or
+// in the X-API-Key header
+func apiKeyFromRequest(c *gin.Context) (string, bool) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key, true
+	}
+	
+	tokenParts := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(tokenParts) == 2 && tokenParts[0] == "ApiKey" {
+		return tokenParts[1], true
+	}
+	return "", false
+}
+
+func setAPIKeyContext(c *gin.Context, key *models.APIKey) {
+	c.Set("user_id", key.UserID)
+	c.Set("username", key.User.Username)
+	c.Set("email", key.User.Email)
+	c.Set("api_key", key)
+}
+
+// requestAPIKey returns the API key the request was authenticated with
+func requestAPIKey(c *gin.Context) (*models.APIKey, bool) {
+	value, exists := c.Get("api_key")
+	if !exists {
+		return nil, false
+	}
+	key, ok := value.(*models.APIKey)
+	return key, ok
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-crud/auth"
+	"go-crud/config"
+	"go-crud/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, db := newTestRBAC(t)
+	config.DB = db
+	authService := auth.NewAuthService("secret")
+
+	users := []models.User{
+		{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true},
+		{Username: "guest", Email: "guest@example.com", Password: "x", IsActive: true},
+		{Username: "admin", Email: "admin@example.com", Password: "x", IsActive: true},
+	}
+	for i, role := range []auth.Role{auth.User, auth.Guest, auth.Admin} {
+		if err := db.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := rbac.AssignRole(users[i].ID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice, guest, admin := users[0].ID, users[1].ID, users[2].ID
+
+	newKey := func(userID uint, scopes ...auth.Permission) string {
+		_, rawKey, err := authService.CreateAPIKey(userID, "test", scopes, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rawKey
+	}
+	writer := newKey(alice, auth.CreatePost)
+	reader := newKey(alice, auth.ReadPost)
+	overscoped := newKey(guest, auth.CreatePost)
+	adminKey := newKey(admin, auth.ManageSystem, auth.CreatePost)
+	adminReader := newKey(admin, auth.ReadUser)
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router := gin.New()
+	api := router.Group("", AuthMiddleware(authService))
+	api.POST("/posts", RequirePermission(rbac, auth.CreatePost), ok)
+	api.DELETE("/users", RequireRole(rbac, auth.Admin), ok)
+	api.POST("/api-keys", RequireSession(), ok)
+	api.GET("/users/:id", RequireOwnershipOrRole(rbac, UserIDParam("id"), auth.Admin, auth.ReadUser), ok)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		key    string
+		want   int
+	}{
+		{"scope granted", http.MethodPost, "/posts", "X-API-Key", writer, http.StatusOK},
+		{"Authorization header", http.MethodPost, "/posts", "Authorization", "ApiKey " + writer, http.StatusOK},
+		{"scope missing", http.MethodPost, "/posts", "X-API-Key", reader, http.StatusForbidden},
+		{"scope the owner does not hold", http.MethodPost, "/posts", "X-API-Key", overscoped, http.StatusForbidden},
+		{"role of the owner", http.MethodDelete, "/users", "X-API-Key", adminKey, http.StatusForbidden},
+		{"session required", http.MethodPost, "/api-keys", "X-API-Key", writer, http.StatusForbidden},
+		{"own record without scope", http.MethodGet, fmt.Sprintf("/users/%d", alice), "X-API-Key", writer, http.StatusForbidden},
+		{"own record with scope", http.MethodGet, fmt.Sprintf("/users/%d", admin), "X-API-Key", adminReader, http.StatusOK},
+		{"other record with scope, role of the owner", http.MethodGet, fmt.Sprintf("/users/%d", alice), "X-API-Key", adminReader, http.StatusForbidden},
+		{"invalid key", http.MethodPost, "/posts", "X-API-Key", "gck_0000000000000000.wrong", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(tt.header, tt.key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthorizeChangeFailsClosedWithoutAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	changed := false
+	router := gin.New()
+	router.Use(asUser)
+	router.PUT("/posts/:id", func(c *gin.Context) {
+		if !AuthorizeChange(c, "update", map[string]interface{}{"category_id": uint(2)}) {
+			return
+		}
+		changed = true
+		c.Status(http.StatusOK)
+	})
+
+	if got := request(router, http.MethodPut, "/posts/1", 1); got != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", got, http.StatusInternalServerError)
+	}
+	if changed {
+		t.Error("change applied without a policy decision")
+	}
+}
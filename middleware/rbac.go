@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/auth"
+	"go-crud/docs"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidResourceID is returned by an OwnerResolver when the request does not address a valid resource
+var ErrInvalidResourceID = errors.New("invalid resource id")
+
+// OwnerResolver returns the ID of the user owning the resource addressed by the request
+type OwnerResolver func(c *gin.Context) (uint, error)
+
+// UserIDParam resolves the owner as the user ID found in the given path parameter
+func UserIDParam(name string) OwnerResolver {
+	return func(c *gin.Context) (uint, error) {
+		id, err := strconv.ParseUint(c.Param(name), 10, 64)
+		if err != nil || id == 0 {
+			return 0, ErrInvalidResourceID
+		}
+		return uint(id), nil
+	}
+}
+
+// RequirePermission allows the request only if the authenticated user holds the permission
+func RequirePermission(rbacService *auth.RBACService, permission auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := authenticatedUserID(c)
+		if !ok {
+			abortUnauthorized(c)
+			return
+		}
+
+		if err := requirePermission(c, rbacService, userID, permission); err != nil {
+			abortForbidden(c, err)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRole allows the request only if the authenticated user holds the role
+func RequireRole(rbacService *auth.RBACService, role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := authenticatedUserID(c)
+		if !ok {
+			abortUnauthorized(c)
+			return
+		}
+
+		if err := requireRole(c, rbacService, userID, role); err != nil {
+			abortForbidden(c, err)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireOwnershipOrRole allows the request if the authenticated user owns the
+// resource resolved by owner, or holds the given role. An API key only grants
+// its scopes, so a key needs the scope permission even for its owner's
+// resources.
+func RequireOwnershipOrRole(rbacService *auth.RBACService, owner OwnerResolver, role auth.Role, scope auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := authenticatedUserID(c)
+		if !ok {
+			abortUnauthorized(c)
+			return
+		}
+
+		resourceUserID, err := owner(c)
+		if err != nil {
+			abortResourceError(c, err)
+			return
+		}
+
+		if userID != resourceUserID {
+			if err := requireRole(c, rbacService, userID, role); err != nil {
+				abortForbidden(c, err)
+				return
+			}
+		} else if _, ok := requestAPIKey(c); ok {
+			if err := requirePermission(c, rbacService, userID, scope); err != nil {
+				abortForbidden(c, err)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func authenticatedUserID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	userID, ok := value.(uint)
+	return userID, ok
+}
+
+// tokenRoles returns the roles embedded in the access token, if any. Tokens
+// without roles fall back to looking the roles up in the database.
+func tokenRoles(c *gin.Context) ([]string, bool) {
+	value, exists := c.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*auth.Claims)
+	if !ok || len(claims.Roles) == 0 {
+		return nil, false
+	}
+	return claims.Roles, true
+}
+
+func requireRole(c *gin.Context, rbacService *auth.RBACService, userID uint, role auth.Role) error {
+	// API keys carry permissions, never the roles of their owner
+	if _, ok := requestAPIKey(c); ok {
+		return fmt.Errorf("insufficient role: %s required, API keys only grant their scopes", role)
+	}
+
+	roles, ok := tokenRoles(c)
+	if !ok {
+		return rbacService.RequireRole(userID, role)
+	}
+
+	for _, r := range roles {
+		if r == string(role) {
+			return nil
+		}
+	}
+	return fmt.Errorf("insufficient role: %s required", role)
+}
+
+func requirePermission(c *gin.Context, rbacService *auth.RBACService, userID uint, permission auth.Permission) error {
+	// API keys are limited to their scopes, and to what their owner still holds
+	if key, ok := requestAPIKey(c); ok {
+		granted := slices.ContainsFunc(auth.APIKeyScopes(key), func(scope auth.Permission) bool {
+			return scope.Matches(permission)
+		})
+		if !granted {
+			return fmt.Errorf("insufficient permissions: API key lacks scope %s", permission)
+		}
+	}
+
+	roles, ok := tokenRoles(c)
+	if !ok {
+		return rbacService.RequirePermission(userID, permission)
+	}
+
+	allowed, err := rbacService.RolesHavePermission(roles, permission)
+	if err != nil {
+		return fmt.Errorf("failed to check permission: %w", err)
+	}
+	if !allowed {
+		return fmt.Errorf("insufficient permissions: %s required", permission)
+	}
+	return nil
+}
+
+// abortResourceError answers a failed OwnerResolver or ResourceLoader
+func abortResourceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidResourceID):
+		c.JSON(http.StatusBadRequest, docs.ErrorResponse{Error: "Invalid resource ID", Code: "BAD_REQUEST"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, docs.ErrorResponse{Error: "Resource not found", Code: "NOT_FOUND"})
+	default:
+		c.JSON(http.StatusInternalServerError, docs.ErrorResponse{Error: "Failed to load resource", Code: "INTERNAL_ERROR"})
+	}
+	c.Abort()
+}
+
+func abortUnauthorized(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, docs.ErrorResponse{
+		Error: "Authentication required",
+		Code:  "UNAUTHORIZED",
+	})
+	c.Abort()
+}
+
+func abortForbidden(c *gin.Context, err error) {
+	c.JSON(http.StatusForbidden, docs.ErrorResponse{
+		Error:   "Forbidden",
+		Code:    "FORBIDDEN",
+		Details: err.Error(),
+	})
+	c.Abort()
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-crud/auth"
+	"go-crud/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestRBAC returns an RBAC service with the default roles on a migrated
+// in-memory database
+func newTestRBAC(t *testing.T) (*auth.RBACService, *gorm.DB) {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	rbac := auth.NewRBACService(db)
+	if err := rbac.InitializeDefaultRoles(); err != nil {
+		t.Fatal(err)
+	}
+	return rbac, db
+}
+
+// asUser stands in for AuthMiddleware, authenticating the request as the user
+// in the X-User-ID header
+func asUser(c *gin.Context) {
+	var userID uint
+	if _, err := fmt.Sscan(c.GetHeader("X-User-ID"), &userID); err == nil {
+		c.Set("user_id", userID)
+	}
+	c.Next()
+}
+
+// request sends a request to router as userID (0 for anonymous) and returns the status
+func request(router http.Handler, method, path string, userID uint) int {
+	req := httptest.NewRequest(method, path, nil)
+	if userID != 0 {
+		req.Header.Set("X-User-ID", fmt.Sprint(userID))
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, _ := newTestRBAC(t)
+
+	const member, guest, nobody uint = 1, 2, 3
+	if err := rbac.AssignRole(member, auth.User); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.AssignRole(guest, auth.Guest); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(asUser)
+	router.POST("/posts", RequirePermission(rbac, auth.CreatePost), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	router.DELETE("/users", RequireRole(rbac, auth.Admin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		userID uint
+		want   int
+	}{
+		{"anonymous", http.MethodPost, "/posts", 0, http.StatusUnauthorized},
+		{"permission granted", http.MethodPost, "/posts", member, http.StatusCreated},
+		{"permission not granted", http.MethodPost, "/posts", guest, http.StatusForbidden},
+		{"no roles", http.MethodPost, "/posts", nobody, http.StatusForbidden},
+		{"role not held", http.MethodDelete, "/users", member, http.StatusForbidden},
+		{"role, anonymous", http.MethodDelete, "/users", 0, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := request(router, tt.method, tt.path, tt.userID); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireOwnershipOrRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, _ := newTestRBAC(t)
+
+	const owner, other, admin uint = 1, 2, 3
+	if err := rbac.AssignRole(admin, auth.Admin); err != nil {
+		t.Fatal(err)
+	}
+
+	errLookup := errors.New("lookup failed")
+	owners := map[string]error{"missing": gorm.ErrRecordNotFound, "broken": errLookup}
+	resolver := func(c *gin.Context) (uint, error) {
+		if err, ok := owners[c.Param("id")]; ok {
+			return 0, err
+		}
+		return UserIDParam("id")(c)
+	}
+
+	router := gin.New()
+	router.Use(asUser)
+	router.GET("/users/:id", RequireOwnershipOrRole(rbac, resolver, auth.Admin, auth.ReadUser), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		path   string
+		userID uint
+		want   int
+	}{
+		{"owner", "/users/1", owner, http.StatusOK},
+		{"other user", "/users/1", other, http.StatusForbidden},
+		{"role", "/users/1", admin, http.StatusOK},
+		{"anonymous", "/users/1", 0, http.StatusUnauthorized},
+		{"invalid id", "/users/abc", owner, http.StatusBadRequest},
+		{"missing resource", "/users/missing", owner, http.StatusNotFound},
+		{"lookup error", "/users/broken", owner, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := request(router, http.MethodGet, tt.path, tt.userID); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenRolesAreTrusted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, _ := newTestRBAC(t)
+
+	// The database says user 1 is an admin; tokens decide while they carry roles
+	const userID uint = 1
+	if err := rbac.AssignRole(userID, auth.Admin); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		if roles := c.GetHeader("X-Roles"); roles != "" {
+			c.Set("claims", &auth.Claims{UserID: userID, Roles: strings.Split(roles, ",")})
+		}
+	})
+	router.DELETE("/users", RequireRole(rbac, auth.Admin), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/posts", RequirePermission(rbac, auth.CreatePost), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	router.GET("/users/:id", RequireOwnershipOrRole(rbac, UserIDParam("id"), auth.Admin, auth.ReadUser), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		roles  string
+		want   int
+	}{
+		{"role in token", http.MethodDelete, "/users", "admin", http.StatusOK},
+		{"role missing from token", http.MethodDelete, "/users", "user", http.StatusForbidden},
+		{"no roles in token, database", http.MethodDelete, "/users", "", http.StatusOK},
+		{"permission of a token role", http.MethodPost, "/posts", "user", http.StatusCreated},
+		{"permission of no token role", http.MethodPost, "/posts", "guest", http.StatusForbidden},
+		{"other user's record, token role", http.MethodGet, "/users/2", "admin", http.StatusOK},
+		{"other user's record, no token role", http.MethodGet, "/users/2", "user", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.roles != "" {
+				req.Header.Set("X-Roles", tt.roles)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
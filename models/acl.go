@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// ACLEntry grants a user a relation, such as "editor", to one resource.
+// Policies decide what each relation allows.
+type ACLEntry struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"uniqueIndex:idx_acl_entry;not null" json:"user_id"`
+	ResourceType string    `gorm:"uniqueIndex:idx_acl_entry;index:idx_acl_resource;size:50;not null" json:"resource_type"`
+	ResourceID   uint      `gorm:"uniqueIndex:idx_acl_entry;index:idx_acl_resource;not null" json:"resource_id"`
+	Relation     string    `gorm:"uniqueIndex:idx_acl_entry;size:50;not null" json:"relation"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TableName specifies the table name for ACLEntry
+func (ACLEntry) TableName() string {
+	return "acl_entries"
+}
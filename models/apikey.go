@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKey is a personal key a user creates for scripts and other machine
+// clients. The key reads "<Prefix>.<secret>": Prefix is stored in clear to
+// find and identify the key, only the SHA-256 of the secret is stored.
+// Scopes is the comma-separated list of permissions the key may use.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"uniqueIndex;size:32;not null" json:"prefix"`
+	SecretHash string     `gorm:"size:64;not null" json:"-"`
+	Scopes     string     `gorm:"size:1000;not null" json:"-"`
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"size:45" json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TableName specifies the table name for APIKey
+func (APIKey) TableName() string {
+	return "api_keys"
+}
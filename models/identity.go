@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's issuer and subject
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Issuer    string    `gorm:"uniqueIndex:idx_identity_subject;size:255;not null" json:"issuer"`
+	Subject   string    `gorm:"uniqueIndex:idx_identity_subject;size:255;not null" json:"subject"`
+	Email     string    `gorm:"size:100" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TableName specifies the table name for UserIdentity
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// OIDCLoginState remembers a login started at an OpenID Connect provider
+// until the provider redirects back. Only the SHA-256 of the state is
+// stored; the PKCE verifier and nonce are needed in clear to finish.
+type OIDCLoginState struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	StateHash    string    `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	CodeVerifier string    `gorm:"size:128;not null" json:"-"`
+	Nonce        string    `gorm:"size:64;not null" json:"-"`
+	ExpiresAt    time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for OIDCLoginState
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// UserMFA holds the TOTP authenticator of a user. It is created unconfirmed
+// on enrollment and enabled once the user proves the authenticator works.
+// LastCounter is the time step of the last accepted code, so a code cannot
+// be used twice.
+type UserMFA struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"uniqueIndex;not null" json:"user_id"`
+	Secret      string     `gorm:"size:64;not null" json:"-"`
+	Enabled     bool       `gorm:"default:false" json:"enabled"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	LastCounter int64      `gorm:"default:0" json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Wrong codes entered to manage two-factor authentication, and the
+	// lockout they caused
+	FailedAttempts int        `gorm:"default:0" json:"-"`
+	LockedUntil    *time.Time `json:"-"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TableName specifies the table name for UserMFA
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only the SHA-256 of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TableName specifies the table name for RecoveryCode
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"log"
 
 	"gorm.io/gorm"
@@ -10,6 +11,10 @@ import (
 func AutoMigrate(db *gorm.DB) error {
 	log.Println("Starting database migration...")
 	
+	if err := removeDuplicateRoleRows(db); err != nil {
+		return err
+	}
+	
 	// Migrate all models
 	if err := db.AutoMigrate(
 		&User{},
@@ -19,6 +24,19 @@ func AutoMigrate(db *gorm.DB) error {
 		&Comment{},
 		&Tag{},
 		&PostTag{},
+		&Role{},
+		&UserRole{},
+		&RolePermission{},
+		&RoleParent{},
+		&Session{},
+		&RevokedToken{},
+		&UserToken{},
+		&UserMFA{},
+		&RecoveryCode{},
+		&APIKey{},
+		&UserIdentity{},
+		&OIDCLoginState{},
+		&ACLEntry{},
 	); err != nil {
 		return err
 	}
@@ -27,6 +45,44 @@ func AutoMigrate(db *gorm.DB) error {
 	return nil
 }
 
+// removeDuplicateRoleRows keeps the oldest of duplicate role assignments
+// and grants, which earlier versions allowed, so their unique indexes can
+// be created
+func removeDuplicateRoleRows(db *gorm.DB) error {
+	tables := []struct {
+		model   interface{}
+		index   string
+		columns string
+	}{
+		{&UserRole{}, "idx_user_role", "user_id, role"},
+		{&RolePermission{}, "idx_role_permission", "role, permission"},
+	}
+	
+	for _, t := range tables {
+		migrator := db.Migrator()
+		if !migrator.HasTable(t.model) || migrator.HasIndex(t.model, t.index) {
+			continue
+		}
+		
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(t.model); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+		
+		// The derived table lets MySQL delete from the table it selects from
+		query := fmt.Sprintf("DELETE FROM %s WHERE id NOT IN (SELECT id FROM (SELECT MIN(id) AS id FROM %s GROUP BY %s) AS keep)", table, table, t.columns)
+		result := db.Exec(query)
+		if result.Error != nil {
+			return fmt.Errorf("failed to remove duplicate rows from %s: %w", table, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Removed %d duplicate rows from %s", result.RowsAffected, table)
+		}
+	}
+	return nil
+}
+
 // TestRelationships tests all model relationships
 func TestRelationships(db *gorm.DB) error {
 	log.Println("Testing model relationships...")
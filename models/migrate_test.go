@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestAutoMigrateRemovesDuplicateRoleRows(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// The tables as earlier versions created them, without unique indexes
+	for _, stmt := range []string{
+		"CREATE TABLE user_roles (id integer PRIMARY KEY AUTOINCREMENT, user_id integer NOT NULL, role varchar(50) NOT NULL)",
+		"CREATE TABLE role_permissions (id integer PRIMARY KEY AUTOINCREMENT, role varchar(50) NOT NULL, permission varchar(100) NOT NULL)",
+		"INSERT INTO user_roles (user_id, role) VALUES (1, 'admin'), (1, 'admin'), (1, 'user'), (2, 'admin')",
+		"INSERT INTO role_permissions (role, permission) VALUES ('user', 'read:post'), ('user', 'read:post'), ('guest', 'read:post')",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var userRoles []UserRole
+	db.Order("id").Find(&userRoles)
+	if len(userRoles) != 3 || userRoles[0].ID != 1 {
+		t.Errorf("user roles = %+v, want the first of each duplicate kept", userRoles)
+	}
+	var count int64
+	db.Model(&RolePermission{}).Count(&count)
+	if count != 2 {
+		t.Errorf("%d role permissions, want 2", count)
+	}
+
+	if err := db.Create(&UserRole{UserID: 1, Role: "user"}).Error; err == nil {
+		t.Error("duplicate user role stored after the migration")
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+)
+
+// Role is an entry of the role catalogue. System roles are created by the
+// API itself and cannot be deleted.
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;size:50;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	System      bool      `gorm:"default:false" json:"system"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for Role
+func (Role) TableName() string {
+	return "roles"
+}
+
+// UserRole assigns a role to a user
+type UserRole struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"uniqueIndex:idx_user_role;not null" json:"user_id"`
+	Role   string `gorm:"uniqueIndex:idx_user_role;size:50;not null" json:"role"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user,omitempty"`
+}
+
+// TableName specifies the table name for UserRole
+func (UserRole) TableName() string {
+	return "user_roles"
+}
+
+// RolePermission grants a permission, possibly a wildcard, to a role
+type RolePermission struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	Role       string `gorm:"uniqueIndex:idx_role_permission;size:50;not null" json:"role"`
+	Permission string `gorm:"uniqueIndex:idx_role_permission;size:100;not null" json:"permission"`
+}
+
+// TableName specifies the table name for RolePermission
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+// RoleParent makes Role inherit every permission of Parent. A user holding
+// Role also holds Parent, and whatever Parent inherits in turn.
+type RoleParent struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	Role   string `gorm:"uniqueIndex:idx_role_parent;size:50;not null" json:"role"`
+	Parent string `gorm:"uniqueIndex:idx_role_parent;size:50;not null" json:"parent"`
+}
+
+// TableName specifies the table name for RoleParent
+func (RoleParent) TableName() string {
+	return "role_parents"
+}
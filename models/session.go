@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents one refresh token. Every refresh rotates the token into
+// a new session row; all rows descending from the same login share FamilyID,
+// which is also the sid claim of the access tokens issued for them.
+type Session struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	FamilyID  string     `gorm:"index;size:64;not null" json:"family_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	UserAgent string     `gorm:"size:255" json:"user_agent"`
+	IPAddress string     `gorm:"size:45" json:"ip_address"`
+	ExpiresAt time.Time  `gorm:"index;not null" json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TableName specifies the table name for Session
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// RevokedToken is an entry of the access token denylist. It either revokes a
+// single token (TokenID, the jti claim) or every token of UserID issued at or
+// before IssuedBefore. Entries are useless once ExpiresAt has passed.
+type RevokedToken struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	TokenID      *string    `gorm:"uniqueIndex;size:64" json:"token_id,omitempty"`
+	UserID       *uint      `gorm:"index" json:"user_id,omitempty"`
+	IssuedBefore *time.Time `json:"issued_before,omitempty"`
+	ExpiresAt    time.Time  `gorm:"index;not null" json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for RevokedToken
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
+
+// UserToken is a single-use token handed to a user, e.g. by email to reset
+// the password or verify the email address, or as the MFA challenge of a
+// login. Only the SHA-256 of the token is stored; UsedAt is set when it is
+// consumed. Attempts counts failed uses of tokens that allow retries.
+type UserToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	Purpose   string     `gorm:"index;size:32;not null" json:"purpose"`
+	TokenHash string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"index;not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	Attempts  int        `gorm:"default:0" json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TableName specifies the table name for UserToken
+func (UserToken) TableName() string {
+	return "user_tokens"
+}
@@ -19,6 +19,14 @@ type User struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 	
+	// Set once the user proves ownership of Email; cleared when it changes
+	EmailVerified   bool       `gorm:"default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	
+	// Brute-force protection: consecutive failed logins and temporary lockout
+	FailedLoginAttempts int        `gorm:"default:0" json:"-"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+	
 	// One-to-One relationship
 	Profile UserProfile `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"profile,omitempty"`
 }
@@ -28,6 +36,19 @@ func (User) TableName() string {
 	return "users"
 }
 
+// Author is the public view of a User, embedded in posts and comments. It
+// leaves out the email address and account state, which only the user and
+// admins may see.
+type Author struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// TableName specifies the table name for Author
+func (Author) TableName() string {
+	return "users"
+}
+
 // UserProfile represents user profile information
 type UserProfile struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"go-crud/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrACLEntryNotFound is returned when revoking an entry that does not exist
+var ErrACLEntryNotFound = errors.New("acl entry not found")
+
+// Grant gives userID the relation to a resource; granting twice is a no-op
+func (e *Engine) Grant(ctx context.Context, userID uint, relation, resourceType string, resourceID uint) (*models.ACLEntry, error) {
+	entry := &models.ACLEntry{
+		UserID:       userID,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Relation:     relation,
+	}
+
+	db := e.db.WithContext(ctx)
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(entry).Error; err != nil {
+		return nil, err
+	}
+	if entry.ID == 0 {
+		// Already granted: return the stored entry
+		err := db.Where("user_id = ? AND relation = ? AND resource_type = ? AND resource_id = ?", userID, relation, resourceType, resourceID).
+			First(entry).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// Revoke deletes an ACL entry
+func (e *Engine) Revoke(ctx context.Context, id uint) error {
+	result := e.db.WithContext(ctx).Delete(&models.ACLEntry{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrACLEntryNotFound
+	}
+	return nil
+}
+
+// ListGrants returns the ACL entries of a resource type, optionally limited
+// to one resource (resourceID 0 lists all)
+func (e *Engine) ListGrants(ctx context.Context, resourceType string, resourceID uint) ([]models.ACLEntry, error) {
+	query := e.db.WithContext(ctx).Where("resource_type = ?", resourceType)
+	if resourceID != 0 {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+
+	var entries []models.ACLEntry
+	err := query.Order("resource_id, relation, user_id").Find(&entries).Error
+	return entries, err
+}
+
+// HasRelation reports whether userID was granted relation to a resource
+func (e *Engine) HasRelation(ctx context.Context, userID uint, relation, resourceType string, resourceID uint) (bool, error) {
+	var count int64
+	err := e.db.WithContext(ctx).Model(&models.ACLEntry{}).
+		Where("user_id = ? AND relation = ? AND resource_type = ? AND resource_id = ?", userID, relation, resourceType, resourceID).
+		Count(&count).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	return count > 0, nil
+}
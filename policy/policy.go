@@ -0,0 +1,239 @@
+// Package policy decides whether a subject may perform an action on a
+// resource. Policies are registered per resource type, either as Go
+// functions or as declarative rules, and see the subject, the action, the
+// attributes of the resource and the request context.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-crud/auth"
+	"slices"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Effect is the outcome of one policy
+type Effect int
+
+const (
+	// Abstain means the policy does not apply to the request
+	Abstain Effect = iota
+	Allow
+	Deny
+)
+
+func (e Effect) String() string {
+	switch e {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	default:
+		return "abstain"
+	}
+}
+
+// UnmarshalText reads "allow" or "deny"
+func (e *Effect) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "allow":
+		*e = Allow
+	case "deny":
+		*e = Deny
+	default:
+		return fmt.Errorf("unknown effect: %s", text)
+	}
+	return nil
+}
+
+// ErrNoResource is returned when a request names no resource
+var ErrNoResource = errors.New("policy request without resource")
+
+// Subject is the caller asking for access
+type Subject struct {
+	UserID uint
+	Roles  []string          // including inherited roles; empty for API keys
+	Scopes []auth.Permission // the scopes of the API key used, if any
+	APIKey bool
+}
+
+// Resource is the object acted on. Attributes carry whatever the policies
+// of its type need, e.g. "category_id" for posts.
+type Resource struct {
+	Type       string
+	ID         uint
+	OwnerID    uint
+	CreatedAt  time.Time
+	Attributes map[string]interface{}
+}
+
+// Request is one authorization question. Time defaults to now and Context
+// holds request data such as the client IP.
+type Request struct {
+	Subject  Subject
+	Action   string
+	Resource *Resource
+	Context  map[string]interface{}
+	Time     time.Time
+
+	engine    *Engine
+	relations map[relationKey]bool
+}
+
+type relationKey struct {
+	relation     string
+	resourceType string
+	resourceID   uint
+}
+
+// HasRole reports whether the subject holds role, directly or inherited
+func (r *Request) HasRole(role auth.Role) bool {
+	return slices.Contains(r.Subject.Roles, string(role))
+}
+
+// IsOwner reports whether the subject owns the resource
+func (r *Request) IsOwner() bool {
+	return r.Subject.UserID != 0 && r.Subject.UserID == r.Resource.OwnerID
+}
+
+// HasPermission reports whether the subject holds permission. API keys
+// also need a matching scope.
+func (r *Request) HasPermission(permission auth.Permission) (bool, error) {
+	if r.Subject.APIKey {
+		granted := slices.ContainsFunc(r.Subject.Scopes, func(scope auth.Permission) bool {
+			return scope.Matches(permission)
+		})
+		if !granted {
+			return false, nil
+		}
+	}
+	if len(r.Subject.Roles) > 0 {
+		return r.engine.rbac.RolesHavePermission(r.Subject.Roles, permission)
+	}
+	return r.engine.rbac.HasPermission(r.Subject.UserID, permission)
+}
+
+// HasRelation reports whether the subject was granted relation on the given
+// resource through the ACL. Answers are remembered for the request.
+func (r *Request) HasRelation(ctx context.Context, relation, resourceType string, resourceID uint) (bool, error) {
+	if r.Subject.UserID == 0 || resourceID == 0 {
+		return false, nil
+	}
+
+	key := relationKey{relation, resourceType, resourceID}
+	if ok, cached := r.relations[key]; cached {
+		return ok, nil
+	}
+
+	ok, err := r.engine.HasRelation(ctx, r.Subject.UserID, relation, resourceType, resourceID)
+	if err != nil {
+		return false, err
+	}
+	if r.relations == nil {
+		r.relations = make(map[relationKey]bool)
+	}
+	r.relations[key] = ok
+	return ok, nil
+}
+
+// Policy decides on requests for one resource type
+type Policy interface {
+	Evaluate(ctx context.Context, req *Request) (Effect, error)
+}
+
+// PolicyFunc adapts a function to Policy
+type PolicyFunc func(ctx context.Context, req *Request) (Effect, error)
+
+func (f PolicyFunc) Evaluate(ctx context.Context, req *Request) (Effect, error) {
+	return f(ctx, req)
+}
+
+// Decision is the combined outcome of the policies of a resource type
+type Decision struct {
+	Allowed bool
+	Policy  string // the policy that decided, empty when none applied
+	Reason  string
+}
+
+type namedPolicy struct {
+	name   string
+	policy Policy
+}
+
+// Engine holds the policies and the ACL. A request is allowed when at least
+// one policy allows it and none denies it; without an applicable policy it
+// is denied.
+type Engine struct {
+	db   *gorm.DB
+	rbac *auth.RBACService
+
+	mu       sync.RWMutex
+	policies map[string][]namedPolicy
+}
+
+func NewEngine(db *gorm.DB, rbac *auth.RBACService) *Engine {
+	return &Engine{
+		db:       db,
+		rbac:     rbac,
+		policies: make(map[string][]namedPolicy),
+	}
+}
+
+// Register adds a policy for resourceType; "*" applies to every type
+func (e *Engine) Register(resourceType, name string, policy Policy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.policies[resourceType] = append(e.policies[resourceType], namedPolicy{name: name, policy: policy})
+}
+
+// Authorize evaluates every policy for the resource type of req. An error
+// from a policy fails the request rather than skipping the policy.
+func (e *Engine) Authorize(ctx context.Context, req *Request) (Decision, error) {
+	if req.Resource == nil {
+		return Decision{}, ErrNoResource
+	}
+	req.engine = e
+	if req.Time.IsZero() {
+		req.Time = time.Now()
+	}
+
+	e.mu.RLock()
+	policies := append(append([]namedPolicy(nil), e.policies[req.Resource.Type]...), e.policies["*"]...)
+	e.mu.RUnlock()
+
+	var allowedBy string
+	for _, p := range policies {
+		effect, err := p.policy.Evaluate(ctx, req)
+		if err != nil {
+			return Decision{}, fmt.Errorf("policy %s: %w", p.name, err)
+		}
+		switch effect {
+		case Deny:
+			return Decision{Policy: p.name, Reason: fmt.Sprintf("%s on %s denied by %s", req.Action, req.Resource.Type, p.name)}, nil
+		case Allow:
+			if allowedBy == "" {
+				allowedBy = p.name
+			}
+		}
+	}
+
+	if allowedBy == "" {
+		return Decision{Reason: fmt.Sprintf("no policy allows %s on %s", req.Action, req.Resource.Type)}, nil
+	}
+	return Decision{Allowed: true, Policy: allowedBy, Reason: fmt.Sprintf("%s on %s allowed by %s", req.Action, req.Resource.Type, allowedBy)}, nil
+}
+
+// UserSubject returns the subject of a logged-in user, with roles resolved
+// through RBAC
+func (e *Engine) UserSubject(userID uint) (Subject, error) {
+	roles, err := e.rbac.GetUserRoles(userID)
+	if err != nil {
+		return Subject{}, err
+	}
+	return Subject{UserID: userID, Roles: roles}, nil
+}
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go-crud/auth"
+	"go-crud/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestEngine returns an engine without policies on a migrated in-memory
+// database with the default roles
+func newTestEngine(t *testing.T) (*Engine, *gorm.DB) {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	rbac := auth.NewRBACService(db)
+	if err := rbac.InitializeDefaultRoles(); err != nil {
+		t.Fatal(err)
+	}
+	return NewEngine(db, rbac), db
+}
+
+// fixed is a policy with a constant effect
+func fixed(effect Effect) Policy {
+	return PolicyFunc(func(context.Context, *Request) (Effect, error) {
+		return effect, nil
+	})
+}
+
+func TestEngineAuthorize(t *testing.T) {
+	errPolicy := errors.New("policy failed")
+	failing := PolicyFunc(func(context.Context, *Request) (Effect, error) {
+		return Abstain, errPolicy
+	})
+
+	type registration struct {
+		resourceType, name string
+		policy             Policy
+	}
+	tests := []struct {
+		name     string
+		policies []registration
+		allowed  bool
+		decider  string
+		err      error
+	}{
+		{"no policies", nil, false, "", nil},
+		{"only abstaining", []registration{{"post", "a", fixed(Abstain)}}, false, "", nil},
+		{"allow", []registration{{"post", "a", fixed(Abstain)}, {"post", "b", fixed(Allow)}}, true, "b", nil},
+		{"first allow decides", []registration{{"post", "a", fixed(Allow)}, {"post", "b", fixed(Allow)}}, true, "a", nil},
+		{"deny after allow", []registration{{"post", "a", fixed(Allow)}, {"post", "b", fixed(Deny)}}, false, "b", nil},
+		{"deny before allow", []registration{{"post", "a", fixed(Deny)}, {"post", "b", fixed(Allow)}}, false, "a", nil},
+		{"wildcard deny", []registration{{"post", "a", fixed(Allow)}, {"*", "b", fixed(Deny)}}, false, "b", nil},
+		{"wildcard allow", []registration{{"*", "a", fixed(Allow)}}, true, "a", nil},
+		{"other resource type", []registration{{"comment", "a", fixed(Allow)}}, false, "", nil},
+		{"error", []registration{{"post", "a", fixed(Allow)}, {"post", "b", failing}}, false, "", errPolicy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(nil, nil)
+			for _, r := range tt.policies {
+				engine.Register(r.resourceType, r.name, r.policy)
+			}
+
+			decision, err := engine.Authorize(context.Background(), &Request{
+				Subject:  Subject{UserID: 1},
+				Action:   "update",
+				Resource: &Resource{Type: "post", ID: 1},
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if decision.Allowed != tt.allowed || decision.Policy != tt.decider {
+				t.Errorf("decision = %+v, want allowed %v by %q", decision, tt.allowed, tt.decider)
+			}
+		})
+	}
+}
+
+func TestEngineAuthorizeWithoutResource(t *testing.T) {
+	engine := NewEngine(nil, nil)
+	engine.Register("*", "a", fixed(Allow))
+
+	if _, err := engine.Authorize(context.Background(), &Request{Action: "update"}); !errors.Is(err, ErrNoResource) {
+		t.Errorf("err = %v, want %v", err, ErrNoResource)
+	}
+}
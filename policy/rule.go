@@ -0,0 +1,244 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-crud/auth"
+	"go-crud/config"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Rule is a declarative policy. Every condition that is set has to hold for
+// the rule to apply; then it has Effect, otherwise it abstains.
+type Rule struct {
+	Name     string `json:"name"`
+	Resource string `json:"resource"` // resource type, "*" for all
+	Effect   Effect `json:"effect"`
+
+	Actions    []string          `json:"actions,omitempty"` // empty or "*" for any action
+	Roles      []string          `json:"roles,omitempty"`   // subject holds one of them
+	Permission auth.Permission   `json:"permission,omitempty"`
+	Owner      bool              `json:"owner,omitempty"`    // subject owns the resource
+	Relation   *RelationRule     `json:"relation,omitempty"` // subject has an ACL relation
+	Match      map[string]string `json:"match,omitempty"`    // resource attributes equal these values
+
+	// MaxAge limits the rule to resources created at most this long ago;
+	// written as a duration string such as "15m" in JSON
+	MaxAge time.Duration `json:"-"`
+}
+
+// RelationRule requires an ACL relation of the subject. Without Attribute
+// the relation is on the resource itself; with it, on the resource of type
+// ResourceType whose ID is in that attribute, e.g. the category of a post.
+type RelationRule struct {
+	Relation     string `json:"relation"`
+	ResourceType string `json:"resource_type,omitempty"`
+	Attribute    string `json:"attribute,omitempty"`
+}
+
+// UnmarshalJSON reads max_age as a duration string
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type plain Rule
+	var raw struct {
+		plain
+		MaxAge string `json:"max_age,omitempty"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	*r = Rule(raw.plain)
+	if raw.MaxAge != "" {
+		maxAge, err := time.ParseDuration(raw.MaxAge)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid max_age: %w", r.Name, err)
+		}
+		r.MaxAge = maxAge
+	}
+	return nil
+}
+
+// Validate checks that the rule can be evaluated
+func (r *Rule) Validate() error {
+	switch {
+	case r.Name == "":
+		return errors.New("rule without name")
+	case r.Resource == "":
+		return fmt.Errorf("rule %s: resource is required", r.Name)
+	case r.Effect != Allow && r.Effect != Deny:
+		return fmt.Errorf("rule %s: effect must be allow or deny", r.Name)
+	case r.MaxAge < 0:
+		return fmt.Errorf("rule %s: max_age must not be negative", r.Name)
+	}
+	if r.Permission != "" {
+		if _, err := auth.ParsePermission(string(r.Permission)); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	if r.Relation != nil {
+		if r.Relation.Relation == "" {
+			return fmt.Errorf("rule %s: relation name is required", r.Name)
+		}
+		if r.Relation.Attribute != "" && r.Relation.ResourceType == "" {
+			return fmt.Errorf("rule %s: relation resource_type is required with attribute", r.Name)
+		}
+	}
+	return nil
+}
+
+// Evaluate applies the rule to req
+func (r *Rule) Evaluate(ctx context.Context, req *Request) (Effect, error) {
+	if len(r.Actions) > 0 && !slices.Contains(r.Actions, "*") && !slices.Contains(r.Actions, req.Action) {
+		return Abstain, nil
+	}
+	if len(r.Roles) > 0 && !slices.ContainsFunc(r.Roles, func(role string) bool { return req.HasRole(auth.Role(role)) }) {
+		return Abstain, nil
+	}
+	if r.Owner && !req.IsOwner() {
+		return Abstain, nil
+	}
+	if r.MaxAge > 0 && (req.Resource.CreatedAt.IsZero() || req.Time.Sub(req.Resource.CreatedAt) > r.MaxAge) {
+		return Abstain, nil
+	}
+	for name, want := range r.Match {
+		value, ok := req.Resource.Attributes[name]
+		if !ok || fmt.Sprint(value) != want {
+			return Abstain, nil
+		}
+	}
+
+	if r.Permission != "" {
+		ok, err := req.HasPermission(r.Permission)
+		if err != nil || !ok {
+			return Abstain, err
+		}
+	}
+
+	if r.Relation != nil {
+		resourceType, resourceID := req.Resource.Type, req.Resource.ID
+		if r.Relation.Attribute != "" {
+			resourceType = r.Relation.ResourceType
+			resourceID = attributeID(req.Resource.Attributes[r.Relation.Attribute])
+		}
+		ok, err := req.HasRelation(ctx, r.Relation.Relation, resourceType, resourceID)
+		if err != nil || !ok {
+			return Abstain, err
+		}
+	}
+
+	return r.Effect, nil
+}
+
+// AddRules validates rules and registers each for its resource type
+func (e *Engine) AddRules(rules ...Rule) error {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range rules {
+		rule := rules[i]
+		e.Register(rule.Resource, rule.Name, &rule)
+	}
+	return nil
+}
+
+// LoadRules reads a JSON array of rules
+func LoadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("failed to parse policy rules: %w", err)
+	}
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// LoadRulesFile reads a JSON array of rules from path
+func LoadRulesFile(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadRules(f)
+}
+
+// NewEngineFromConfig returns an engine with the default rules, unless
+// disabled, and the rules of cfg.RulesFile
+func NewEngineFromConfig(db *gorm.DB, rbac *auth.RBACService, cfg *config.PolicyConfig) (*Engine, error) {
+	engine := NewEngine(db, rbac)
+	if cfg.DefaultRules {
+		if err := engine.AddRules(DefaultRules()...); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RulesFile != "" {
+		rules, err := LoadRulesFile(cfg.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := engine.AddRules(rules...); err != nil {
+			return nil, err
+		}
+	}
+	return engine, nil
+}
+
+// DefaultRules keep the ownership checks of posts and comments: admins may
+// do anything, authors may change their own content. Editors of a category
+// may also update the posts in it.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "admins", Resource: "*", Effect: Allow, Roles: []string{string(auth.Admin)}},
+		{Name: "post-authors", Resource: "post", Effect: Allow, Actions: []string{"update", "delete"}, Owner: true},
+		{
+			Name:     "category-editors",
+			Resource: "post",
+			Effect:   Allow,
+			Actions:  []string{"update"},
+			Relation: &RelationRule{Relation: "editor", ResourceType: "category", Attribute: "category_id"},
+		},
+		{Name: "comment-authors", Resource: "comment", Effect: Allow, Actions: []string{"update", "delete"}, Owner: true},
+	}
+}
+
+// attributeID converts a numeric attribute, as set by loaders or decoded
+// from JSON, to an ID; anything else is 0
+func attributeID(value interface{}) uint {
+	switch v := value.(type) {
+	case uint:
+		return v
+	case uint64:
+		return uint(v)
+	case int:
+		if v > 0 {
+			return uint(v)
+		}
+	case int64:
+		if v > 0 {
+			return uint(v)
+		}
+	case float64:
+		if v > 0 {
+			return uint(v)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go-crud/auth"
+	"go-crud/models"
+)
+
+func TestRuleEvaluate(t *testing.T) {
+	engine, db := newTestEngine(t)
+	ctx := context.Background()
+
+	owner := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	editor := models.User{Username: "bob", Email: "bob@example.com", Password: "x", IsActive: true}
+	for _, user := range []*models.User{&owner, &editor} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := engine.rbac.AssignRole(owner.ID, auth.User); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.rbac.AssignRole(editor.ID, auth.Guest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Grant(ctx, editor.ID, "editor", "category", 7); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Grant(ctx, editor.ID, "reviewer", "post", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ownerSubject := Subject{UserID: owner.ID, Roles: []string{string(auth.User), string(auth.Guest)}}
+	editorSubject := Subject{UserID: editor.ID, Roles: []string{string(auth.Guest)}}
+	apiKey := func(userID uint, scopes ...auth.Permission) Subject {
+		return Subject{UserID: userID, Scopes: scopes, APIKey: true}
+	}
+
+	now := time.Now()
+	createdAt := func(age time.Duration) func(*Resource) {
+		return func(r *Resource) {
+			r.CreatedAt = now.Add(-age)
+			if age == 0 {
+				r.CreatedAt = time.Time{}
+			}
+		}
+	}
+	attribute := func(name string, value interface{}) func(*Resource) {
+		return func(r *Resource) {
+			r.Attributes[name] = value
+		}
+	}
+
+	allow := Rule{Name: "test", Resource: "post", Effect: Allow}
+	with := func(change func(*Rule)) Rule {
+		rule := allow
+		change(&rule)
+		return rule
+	}
+	categoryEditors := with(func(r *Rule) {
+		r.Relation = &RelationRule{Relation: "editor", ResourceType: "category", Attribute: "category_id"}
+	})
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		subject  Subject
+		action   string
+		resource func(*Resource)
+		want     Effect
+	}{
+		{"no conditions", allow, editorSubject, "update", nil, Allow},
+		{"action listed", with(func(r *Rule) { r.Actions = []string{"update", "delete"} }), editorSubject, "update", nil, Allow},
+		{"action not listed", with(func(r *Rule) { r.Actions = []string{"delete"} }), editorSubject, "update", nil, Abstain},
+		{"any action", with(func(r *Rule) { r.Actions = []string{"*"} }), editorSubject, "publish", nil, Allow},
+
+		{"role held", with(func(r *Rule) { r.Roles = []string{"admin", "guest"} }), editorSubject, "update", nil, Allow},
+		{"role not held", with(func(r *Rule) { r.Roles = []string{"admin"} }), ownerSubject, "update", nil, Abstain},
+
+		{"owner", with(func(r *Rule) { r.Owner = true }), ownerSubject, "update", nil, Allow},
+		{"not owner", with(func(r *Rule) { r.Owner = true }), editorSubject, "update", nil, Abstain},
+		{"anonymous on unowned resource", with(func(r *Rule) { r.Owner = true }), Subject{}, "update", func(r *Resource) { r.OwnerID = 0 }, Abstain},
+		{"owner, denied", with(func(r *Rule) { r.Owner = true; r.Effect = Deny }), ownerSubject, "update", nil, Deny},
+
+		{"within max age", with(func(r *Rule) { r.MaxAge = 15 * time.Minute }), ownerSubject, "update", createdAt(5 * time.Minute), Allow},
+		{"past max age", with(func(r *Rule) { r.MaxAge = 15 * time.Minute }), ownerSubject, "update", createdAt(20 * time.Minute), Abstain},
+		{"max age without creation time", with(func(r *Rule) { r.MaxAge = 15 * time.Minute }), ownerSubject, "update", createdAt(0), Abstain},
+
+		{"attribute matches", with(func(r *Rule) { r.Match = map[string]string{"status": "published", "category_id": "7"} }), editorSubject, "update", nil, Allow},
+		{"attribute differs", with(func(r *Rule) { r.Match = map[string]string{"status": "draft"} }), editorSubject, "update", nil, Abstain},
+		{"attribute missing", with(func(r *Rule) { r.Match = map[string]string{"featured": "true"} }), editorSubject, "update", nil, Abstain},
+
+		{"permission through roles", with(func(r *Rule) { r.Permission = auth.UpdatePost }), ownerSubject, "update", nil, Allow},
+		{"permission not granted", with(func(r *Rule) { r.Permission = auth.UpdatePost }), editorSubject, "update", nil, Abstain},
+		{"API key scope and owner permission", with(func(r *Rule) { r.Permission = auth.ReadPost }), apiKey(owner.ID, "read:*"), "read", nil, Allow},
+		{"API key without scope", with(func(r *Rule) { r.Permission = auth.UpdatePost }), apiKey(owner.ID, auth.ReadPost), "update", nil, Abstain},
+		{"API key scope the owner lacks", with(func(r *Rule) { r.Permission = auth.UpdatePost }), apiKey(editor.ID, "*:post"), "update", nil, Abstain},
+
+		{"relation on resource", with(func(r *Rule) { r.Relation = &RelationRule{Relation: "reviewer"} }), editorSubject, "update", nil, Allow},
+		{"relation on other resource", with(func(r *Rule) { r.Relation = &RelationRule{Relation: "reviewer"} }), editorSubject, "update", func(r *Resource) { r.ID = 2 }, Abstain},
+		{"relation through attribute", categoryEditors, editorSubject, "update", nil, Allow},
+		{"relation through decoded JSON attribute", categoryEditors, editorSubject, "update", attribute("category_id", float64(7)), Allow},
+		{"relation through other attribute value", categoryEditors, editorSubject, "update", attribute("category_id", uint(8)), Abstain},
+		{"relation without attribute", categoryEditors, editorSubject, "update", func(r *Resource) { delete(r.Attributes, "category_id") }, Abstain},
+		{"relation not granted", categoryEditors, ownerSubject, "update", nil, Abstain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &Resource{
+				Type:       "post",
+				ID:         1,
+				OwnerID:    owner.ID,
+				CreatedAt:  now.Add(-time.Minute),
+				Attributes: map[string]interface{}{"category_id": uint(7), "status": "published"},
+			}
+			if tt.resource != nil {
+				tt.resource(resource)
+			}
+			req := &Request{Subject: tt.subject, Action: tt.action, Resource: resource, Time: now, engine: engine}
+
+			effect, err := tt.rule.Evaluate(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if effect != tt.want {
+				t.Errorf("Evaluate = %v, want %v", effect, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		err   string
+		check func(t *testing.T, rules []Rule)
+	}{
+		{
+			name: "valid",
+			json: `[{"name": "recent-authors", "resource": "post", "effect": "allow", "actions": ["update"], "owner": true, "max_age": "15m"},
+				{"name": "locked", "resource": "post", "effect": "deny", "match": {"status": "archived"}},
+				{"name": "editors", "resource": "post", "effect": "allow", "permission": "update:*",
+				 "relation": {"relation": "editor", "resource_type": "category", "attribute": "category_id"}}]`,
+			check: func(t *testing.T, rules []Rule) {
+				if len(rules) != 3 {
+					t.Fatalf("got %d rules, want 3", len(rules))
+				}
+				if rules[0].MaxAge != 15*time.Minute || !rules[0].Owner || rules[0].Effect != Allow {
+					t.Errorf("rules[0] = %+v", rules[0])
+				}
+				if rules[1].Effect != Deny || rules[1].Match["status"] != "archived" {
+					t.Errorf("rules[1] = %+v", rules[1])
+				}
+				if rules[2].Relation == nil || rules[2].Relation.Attribute != "category_id" || rules[2].Permission != "update:*" {
+					t.Errorf("rules[2] = %+v", rules[2])
+				}
+			},
+		},
+		{name: "empty", json: `[]`, check: func(t *testing.T, rules []Rule) {
+			if len(rules) != 0 {
+				t.Errorf("got %d rules, want none", len(rules))
+			}
+		}},
+		{name: "misspelled field", json: `[{"name": "a", "resource": "post", "effect": "allow", "owners": true}]`, err: "unknown field"},
+		{name: "unknown relation field", json: `[{"name": "a", "resource": "post", "effect": "allow", "relation": {"relation": "editor", "type": "category"}}]`, err: "unknown field"},
+		{name: "not an array", json: `{"name": "a", "resource": "post", "effect": "allow"}`, err: "failed to parse"},
+		{name: "unknown effect", json: `[{"name": "a", "resource": "post", "effect": "maybe"}]`, err: "unknown effect"},
+		{name: "missing effect", json: `[{"name": "a", "resource": "post"}]`, err: "effect must be allow or deny"},
+		{name: "missing name", json: `[{"resource": "post", "effect": "allow"}]`, err: "rule without name"},
+		{name: "missing resource", json: `[{"name": "a", "effect": "allow"}]`, err: "resource is required"},
+		{name: "invalid max age", json: `[{"name": "a", "resource": "post", "effect": "allow", "max_age": "soon"}]`, err: "invalid max_age"},
+		{name: "negative max age", json: `[{"name": "a", "resource": "post", "effect": "allow", "max_age": "-1m"}]`, err: "must not be negative"},
+		{name: "unknown permission", json: `[{"name": "a", "resource": "post", "effect": "allow", "permission": "publish:post"}]`, err: "unknown permission"},
+		{name: "attribute without resource type", json: `[{"name": "a", "resource": "post", "effect": "allow", "relation": {"relation": "editor", "attribute": "category_id"}}]`, err: "resource_type is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := LoadRules(strings.NewReader(tt.json))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, rules)
+		})
+	}
+}
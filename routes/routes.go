@@ -1,21 +1,164 @@
 package routes
 
 import (
+	"fmt"
+	"go-crud/auth"
+	"go-crud/config"
 	"go-crud/handlers"
+	"go-crud/middleware"
+	"go-crud/policy"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine) {
+func SetupRoutes(r *gin.Engine, authService *auth.AuthService, rbacService *auth.RBACService) {
+	// Resource policies decide who may change which post or comment
+	policies, err := policy.NewEngineFromConfig(config.DB, rbacService, config.LoadPolicyConfig())
+	if err != nil {
+		panic(fmt.Sprintf("failed to load resource policies: %s", err.Error()))
+	}
+
+	authHandler := handlers.NewAuthHandler(authService)
+	userHandler := handlers.NewUserHandler(authService, rbacService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(authService, rbacService)
+	rbacHandler := handlers.NewRBACHandler(rbacService, policies)
+	requireAuth := middleware.AuthMiddleware(authService)
+	requireSession := middleware.RequireSession()
+
+	// Public signing keys for token verification by other services
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
+
 	api := r.Group("/api/v1")
 	{
-		// User routes
-		users := api.Group("/users")
+		// Auth routes
+		authRoutes := api.Group("/auth")
+		{
+			limited := authRoutes.Group("", middleware.IPRateLimitMiddleware(middleware.AuthRateLimiter))
+			limited.POST("/register", authHandler.Register)
+			limited.POST("/login", authHandler.Login)
+			limited.POST("/refresh", authHandler.Refresh)
+			limited.POST("/password/forgot", authHandler.ForgotPassword)
+			limited.POST("/password/reset", authHandler.ResetPassword)
+			limited.POST("/verify-email", authHandler.VerifyEmail)
+			limited.POST("/mfa/verify", authHandler.VerifyMFA)
+			limited.GET("/oidc/login", authHandler.OIDCLogin)
+			limited.GET("/oidc/callback", authHandler.OIDCCallback)
+
+			authenticated := authRoutes.Group("", requireAuth, requireSession)
+			authenticated.POST("/logout", authHandler.Logout)
+			authenticated.GET("/me", authHandler.Me)
+			authenticated.POST("/verify-email/resend", authHandler.ResendVerification)
+			authenticated.POST("/mfa/totp/setup", authHandler.SetupTOTP)
+			authenticated.POST("/mfa/totp/confirm", authHandler.ConfirmTOTP)
+			authenticated.POST("/mfa/totp/disable", authHandler.DisableTOTP)
+			authenticated.POST("/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		}
+
+		// User routes: users may only read and edit themselves unless they are admins
+		users := api.Group("/users", requireAuth)
+		{
+			readSelfOrAdmin := middleware.RequireOwnershipOrRole(rbacService, middleware.UserIDParam("id"), auth.Admin, auth.ReadUser)
+			updateSelfOrAdmin := middleware.RequireOwnershipOrRole(rbacService, middleware.UserIDParam("id"), auth.Admin, auth.UpdateUser)
+
+			users.GET("", middleware.RequirePermission(rbacService, auth.ReadUser), userHandler.ListUsers)
+			users.POST("", middleware.RequirePermission(rbacService, auth.CreateUser), userHandler.CreateUser)
+			users.GET("/:id", readSelfOrAdmin, userHandler.GetUser)
+			users.PUT("/:id", requireSession, updateSelfOrAdmin, userHandler.UpdateUser)
+			users.PATCH("/:id", requireSession, updateSelfOrAdmin, userHandler.UpdateUser)
+			users.DELETE("/:id", middleware.RequirePermission(rbacService, auth.DeleteUser), userHandler.DeleteUser)
+			users.POST("/:id/unlock", middleware.RequireRole(rbacService, auth.Admin), userHandler.UnlockUser)
+		}
+
+		// Personal API keys for machine clients; managing them needs a login
+		apiKeys := api.Group("/api-keys", requireAuth, requireSession)
+		{
+			apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+			apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+			apiKeys.GET("/:id", apiKeyHandler.GetAPIKey)
+			apiKeys.PATCH("/:id", apiKeyHandler.UpdateAPIKey)
+			apiKeys.DELETE("/:id", apiKeyHandler.DeleteAPIKey)
+		}
+
+		// Role and permission management for administrators
+		admin := api.Group("/admin", requireAuth, requireSession, middleware.RequireRole(rbacService, auth.Admin))
+		{
+			admin.GET("/roles", rbacHandler.ListRoles)
+			admin.POST("/roles", rbacHandler.CreateRole)
+			admin.GET("/roles/:role", rbacHandler.GetRole)
+			admin.DELETE("/roles/:role", rbacHandler.DeleteRole)
+			admin.POST("/roles/:role/permissions", rbacHandler.GrantPermission)
+			admin.DELETE("/roles/:role/permissions/:permission", rbacHandler.RevokePermission)
+			admin.POST("/roles/:role/parents", rbacHandler.AddRoleParent)
+			admin.DELETE("/roles/:role/parents/:parent", rbacHandler.RemoveRoleParent)
+
+			admin.GET("/users/:id/roles", rbacHandler.GetUserRoles)
+			admin.POST("/users/:id/roles", rbacHandler.AssignUserRole)
+			admin.DELETE("/users/:id/roles/:role", rbacHandler.RemoveUserRole)
+			admin.GET("/users/:id/permissions", rbacHandler.GetUserPermissions)
+
+			admin.GET("/acl", rbacHandler.ListACL)
+			admin.POST("/acl", rbacHandler.GrantACL)
+			admin.DELETE("/acl/:id", rbacHandler.RevokeACL)
+		}
+
+		// Post routes
+		posts := api.Group("/posts")
+		{
+			mayUpdate := middleware.Authorize(policies, "update", handlers.PostResource)
+			mayDelete := middleware.Authorize(policies, "delete", handlers.PostResource)
+
+			posts.GET("", handlers.ListPosts)
+			posts.POST("", requireAuth, middleware.RequirePermission(rbacService, auth.CreatePost), handlers.CreatePost)
+			posts.GET("/:id", handlers.GetPost)
+			posts.PUT("/:id", requireAuth, middleware.RequirePermission(rbacService, auth.UpdatePost), mayUpdate, handlers.UpdatePost)
+			posts.PATCH("/:id", requireAuth, middleware.RequirePermission(rbacService, auth.UpdatePost), mayUpdate, handlers.UpdatePost)
+			posts.DELETE("/:id", requireAuth, middleware.RequirePermission(rbacService, auth.DeletePost), mayDelete, handlers.DeletePost)
+
+			posts.GET("/:id/comments", handlers.ListPostComments)
+			posts.POST("/:id/comments", requireAuth, middleware.RequirePermission(rbacService, auth.CreateComment), handlers.CreatePostComment)
+
+			posts.GET("/:id/tags", handlers.ListPostTags)
+			posts.POST("/:id/tags", requireAuth, middleware.RequirePermission(rbacService, auth.UpdatePost), mayUpdate, handlers.AddPostTags)
+			posts.DELETE("/:id/tags/:tag_id", requireAuth, middleware.RequirePermission(rbacService, auth.UpdatePost), mayUpdate, handlers.RemovePostTag)
+		}
+
+		// Comment routes
+		comments := api.Group("/comments")
+		{
+			mayUpdate := middleware.Authorize(policies, "update", handlers.CommentResource)
+			mayDelete := middleware.Authorize(policies, "delete", handlers.CommentResource)
+
+			comments.GET("", handlers.ListComments)
+			comments.POST("", requireAuth, middleware.RequirePermission(rbacService, auth.CreateComment), handlers.CreateComment)
+			comments.GET("/:id", handlers.GetComment)
+			comments.PUT("/:id", requireAuth, middleware.RequirePermission(rbacService, auth.UpdateComment), mayUpdate, handlers.UpdateComment)
+			comments.PATCH("/:id", requireAuth, middleware.RequirePermission(rbacService, auth.UpdateComment), mayUpdate, handlers.UpdateComment)
+			comments.DELETE("/:id", requireAuth, middleware.RequirePermission(rbacService, auth.DeleteComment), mayDelete, handlers.DeleteComment)
+		}
+
+		// Category and tag routes: taxonomy is managed by administrators
+		manageSystem := middleware.RequirePermission(rbacService, auth.ManageSystem)
+
+		categories := api.Group("/categories")
+		{
+			categories.GET("", handlers.ListCategories)
+			categories.POST("", requireAuth, manageSystem, handlers.CreateCategory)
+			categories.GET("/:id", handlers.GetCategory)
+			categories.PUT("/:id", requireAuth, manageSystem, handlers.UpdateCategory)
+			categories.PATCH("/:id", requireAuth, manageSystem, handlers.UpdateCategory)
+			categories.DELETE("/:id", requireAuth, manageSystem, handlers.DeleteCategory)
+			categories.GET("/:id/posts", handlers.ListCategoryPosts)
+		}
+
+		tags := api.Group("/tags")
 		{
-			users.POST("", handlers.CreateUser)
-			users.GET("/:id", handlers.GetUser)
-			users.PUT("/:id", handlers.UpdateUser)
-			users.DELETE("/:id", handlers.DeleteUser)
+			tags.GET("", handlers.ListTags)
+			tags.POST("", requireAuth, manageSystem, handlers.CreateTag)
+			tags.GET("/:id", handlers.GetTag)
+			tags.PUT("/:id", requireAuth, manageSystem, handlers.UpdateTag)
+			tags.PATCH("/:id", requireAuth, manageSystem, handlers.UpdateTag)
+			tags.DELETE("/:id", requireAuth, manageSystem, handlers.DeleteTag)
+			tags.GET("/:id/posts", handlers.ListTagPosts)
 		}
 	}
 }
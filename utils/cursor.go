@@ -0,0 +1,328 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// CursorPagination describes a page fetched with keyset pagination
+type CursorPagination struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	HasNext    bool   `json:"has_next"`
+	HasPrev    bool   `json:"has_prev"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// SortKey is one column of a multi-column sort
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// cursorToken is the decoded form of the opaque cursor handed to clients.
+// It carries the sort signature it was created for, so a cursor cannot be
+// replayed against a different ordering.
+type cursorToken struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+	Prev   bool              `json:"p,omitempty"`
+}
+
+// IsCursorRequest reports whether the request asks for cursor pagination
+// (?cursor=...&limit=...) instead of page/per_page pagination
+func IsCursorRequest(c *gin.Context) bool {
+	query := c.Request.URL.Query()
+	_, hasCursor := query["cursor"]
+	_, hasLimit := query["limit"]
+	return hasCursor || hasLimit
+}
+
+// ParseSortKeys parses a comma separated sort parameter such as
+// "created_at,-title". A leading "-" sorts that column descending; columns
+// without a prefix use defaultOrder. "id" is appended as a tie-breaker so
+// that every key set is unique.
+func ParseSortKeys(sort, defaultOrder string) []SortKey {
+	var keys []SortKey
+	hasID := false
+
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key := SortKey{Field: part, Desc: defaultOrder == "desc"}
+		if strings.HasPrefix(part, "-") {
+			key = SortKey{Field: part[1:], Desc: true}
+		} else if strings.HasPrefix(part, "+") {
+			key = SortKey{Field: part[1:], Desc: false}
+		}
+
+		if key.Field == "id" {
+			hasID = true
+		}
+		keys = append(keys, key)
+	}
+
+	if !hasID {
+		desc := defaultOrder == "desc"
+		if len(keys) > 0 {
+			desc = keys[len(keys)-1].Desc
+		}
+		keys = append(keys, SortKey{Field: "id", Desc: desc})
+	}
+
+	return keys
+}
+
+func sortSignature(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		if key.Desc {
+			parts[i] = "-" + key.Field
+		} else {
+			parts[i] = key.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// CursorPaginateQuery loads one page of db into dest (a pointer to a slice)
+// using keyset pagination. Rows are located by the sort key values and id of
+// the last row of the previous page rather than by OFFSET, and the total
+// count is only computed when the request sets with_count=true.
+// Nullable columns cannot be sort keys: a NULL never compares equal or
+// greater, so rows holding one would be skipped.
+func CursorPaginateQuery(db *gorm.DB, c *gin.Context, dest interface{}) (CursorPagination, error) {
+	limit := 10
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			return CursorPagination{}, &QueryError{Param: "limit", Message: "must be an integer between 1 and 100"}
+		}
+		limit = parsed
+	}
+
+	order := "asc"
+	if o := c.Query("order"); o == "desc" {
+		order = o
+	}
+	keys := ParseSortKeys(c.DefaultQuery("sort", "id"), order)
+	signature := sortSignature(keys)
+
+	fields, err := FieldsFor(db)
+	if err != nil {
+		return CursorPagination{}, err
+	}
+
+	sortFields := make([]*schema.Field, len(keys))
+	columns := make([]clause.Column, len(keys))
+	for i, key := range keys {
+		if sortFields[i], err = fields.field("sort", key.Field); err != nil {
+			return CursorPagination{}, err
+		}
+		if nullable(sortFields[i]) {
+			return CursorPagination{}, &QueryError{Param: "sort", Message: fmt.Sprintf("%s may be null and cannot be used with cursor pagination", key.Field)}
+		}
+		columns[i] = clause.Column{Table: clause.CurrentTable, Name: sortFields[i].DBName}
+	}
+
+	// A sparse fieldset must still load the sort keys the cursor is built from
+	if len(db.Statement.Selects) > 0 {
+		selects := append([]string(nil), db.Statement.Selects...)
+		for _, field := range sortFields {
+			selects = append(selects, field.DBName)
+		}
+		db = db.Select(uniqueStrings(selects))
+	}
+
+	db, err = ApplyFilters(db, fields, ParseFilters(c))
+	if err != nil {
+		return CursorPagination{}, err
+	}
+	if expr := c.Query("filter"); expr != "" {
+		if db, err = ApplyFilterExpression(db, fields, expr); err != nil {
+			return CursorPagination{}, err
+		}
+	}
+
+	result := CursorPagination{Limit: limit, Sort: signature}
+
+	if c.Query("with_count") == "true" {
+		var total int64
+		if err := db.Model(db.Statement.Model).Count(&total).Error; err != nil {
+			return CursorPagination{}, err
+		}
+		result.Total = &total
+	}
+
+	var token *cursorToken
+	if raw := c.Query("cursor"); raw != "" {
+		if token, err = decodeCursor(raw, signature); err != nil {
+			return CursorPagination{}, err
+		}
+
+		values, err := decodeCursorValues(token, sortFields)
+		if err != nil {
+			return CursorPagination{}, err
+		}
+		db = db.Where(keysetCondition(keys, columns, values, token.Prev))
+	}
+
+	backward := token != nil && token.Prev
+	for i, key := range keys {
+		db = db.Order(clause.OrderByColumn{Column: columns[i], Desc: key.Desc != backward})
+	}
+
+	if err := db.Limit(limit + 1).Find(dest).Error; err != nil {
+		return CursorPagination{}, err
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	hasMore := rows.Len() > limit
+	if hasMore {
+		rows.Set(rows.Slice(0, limit))
+	}
+	if backward {
+		reverseSlice(rows)
+	}
+
+	if backward {
+		result.HasPrev = hasMore
+		result.HasNext = true
+	} else {
+		result.HasNext = hasMore
+		result.HasPrev = token != nil
+	}
+
+	if rows.Len() > 0 {
+		if result.HasNext {
+			if result.NextCursor, err = encodeCursor(signature, sortFields, rows.Index(rows.Len()-1), false); err != nil {
+				return CursorPagination{}, err
+			}
+		}
+		if result.HasPrev {
+			if result.PrevCursor, err = encodeCursor(signature, sortFields, rows.Index(0), true); err != nil {
+				return CursorPagination{}, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// nullable reports whether field can hold NULL: pointers and scanner types
+// such as sql.NullString and gorm.DeletedAt
+func nullable(field *schema.Field) bool {
+	if field.FieldType.Kind() == reflect.Ptr {
+		return true
+	}
+	return reflect.PointerTo(field.FieldType).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem())
+}
+
+// keysetCondition builds (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ... with the
+// comparison flipped for descending keys and for backward paging
+func keysetCondition(keys []SortKey, columns []clause.Column, values []interface{}, backward bool) clause.Expression {
+	var branches []clause.Expression
+
+	for i := range keys {
+		var conditions []clause.Expression
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, clause.Eq{Column: columns[j], Value: values[j]})
+		}
+
+		if keys[i].Desc != backward {
+			conditions = append(conditions, clause.Lt{Column: columns[i], Value: values[i]})
+		} else {
+			conditions = append(conditions, clause.Gt{Column: columns[i], Value: values[i]})
+		}
+
+		branches = append(branches, clause.And(conditions...))
+	}
+
+	return clause.Or(branches...)
+}
+
+func encodeCursor(signature string, sortFields []*schema.Field, row reflect.Value, prev bool) (string, error) {
+	token := cursorToken{Sort: signature, Prev: prev}
+
+	for _, field := range sortFields {
+		value, _ := field.ValueOf(context.Background(), row)
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		token.Values = append(token.Values, raw)
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(raw, signature string) (*cursorToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, &QueryError{Param: "cursor", Message: "malformed cursor"}
+	}
+
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, &QueryError{Param: "cursor", Message: "malformed cursor"}
+	}
+
+	if token.Sort != signature {
+		return nil, &QueryError{Param: "cursor", Message: "cursor was created for a different sort order"}
+	}
+
+	return &token, nil
+}
+
+// decodeCursorValues converts the JSON key values back into the Go types of
+// the sort columns so they bind with the right SQL types
+func decodeCursorValues(token *cursorToken, sortFields []*schema.Field) ([]interface{}, error) {
+	if len(token.Values) != len(sortFields) {
+		return nil, &QueryError{Param: "cursor", Message: "malformed cursor"}
+	}
+
+	values := make([]interface{}, len(sortFields))
+	for i, field := range sortFields {
+		target := reflect.New(field.FieldType)
+		if err := json.Unmarshal(token.Values[i], target.Interface()); err != nil {
+			return nil, &QueryError{Param: "cursor", Message: "malformed cursor"}
+		}
+		values[i] = target.Elem().Interface()
+	}
+
+	return values, nil
+}
+
+func reverseSlice(rows reflect.Value) {
+	swap := reflect.Swapper(rows.Interface())
+	for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
+
+func CreateCursorPaginatedResponse(data interface{}, pagination CursorPagination) map[string]interface{} {
+	return map[string]interface{}{
+		"data":       data,
+		"pagination": pagination,
+	}
+}
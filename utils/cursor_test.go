@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"go-crud/models"
+
+	"gorm.io/gorm"
+)
+
+// cursorUsers creates users whose first names repeat, so sorting by
+// first_name alone does not determine an order
+func cursorUsers(t *testing.T) (*gorm.DB, []models.User) {
+	t.Helper()
+
+	db := openTestDB(t)
+	var users []models.User
+	for i, name := range []string{"b", "a", "c", "a", "b", "a", "c", "b"} {
+		users = append(users, models.User{
+			Username:  fmt.Sprintf("user%d", i),
+			Email:     fmt.Sprintf("user%d@example.com", i),
+			Password:  "x",
+			FirstName: name,
+		})
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, users
+}
+
+// cursorPage fetches one page of users with the given query parameters
+func cursorPage(db *gorm.DB, query url.Values) ([]models.User, CursorPagination, error) {
+	var users []models.User
+	pagination, err := CursorPaginateQuery(db.Model(&models.User{}), testContext(query.Encode()), &users)
+	return users, pagination, err
+}
+
+func userIDs(users []models.User) []uint {
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+func TestCursorPaginationIsStableWithDuplicateValues(t *testing.T) {
+	db, users := cursorUsers(t)
+
+	tests := []struct {
+		sort  string
+		order string
+		want  string // ORDER BY of the expected sequence
+	}{
+		{"first_name", "", "first_name, id"},
+		{"-first_name", "", "first_name DESC, id DESC"},
+		{"first_name,-id", "", "first_name, id DESC"},
+		{"first_name", "desc", "first_name DESC, id DESC"},
+		{"-created_at", "", "created_at DESC, id DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort+" "+tt.order, func(t *testing.T) {
+			var expected []models.User
+			if err := db.Order(tt.want).Find(&expected).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			query := url.Values{"limit": {"3"}, "sort": {tt.sort}}
+			if tt.order != "" {
+				query.Set("order", tt.order)
+			}
+
+			// Walk forward to the end, then back to the start
+			var forward [][]uint
+			var cursors []string
+			for {
+				page, pagination, err := cursorPage(db, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				forward = append(forward, userIDs(page))
+				cursors = append(cursors, pagination.PrevCursor)
+				if !pagination.HasNext {
+					break
+				}
+				if len(forward) > len(users) {
+					t.Fatal("pagination does not terminate")
+				}
+				query.Set("cursor", pagination.NextCursor)
+			}
+
+			var seen []uint
+			for _, ids := range forward {
+				seen = append(seen, ids...)
+			}
+			if want := userIDs(expected); !reflect.DeepEqual(seen, want) {
+				t.Fatalf("forward pages = %v, want %v", forward, want)
+			}
+
+			for i := len(forward) - 1; i > 0; i-- {
+				query.Set("cursor", cursors[i])
+				page, pagination, err := cursorPage(db, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := userIDs(page); !reflect.DeepEqual(got, forward[i-1]) {
+					t.Errorf("page %d backward = %v, forward = %v", i-1, got, forward[i-1])
+				}
+				if pagination.HasPrev != (i > 1) || !pagination.HasNext {
+					t.Errorf("page %d backward: has_prev = %v, has_next = %v", i-1, pagination.HasPrev, pagination.HasNext)
+				}
+			}
+		})
+	}
+}
+
+func TestCursorPaginationRejectsBadCursors(t *testing.T) {
+	db, _ := cursorUsers(t)
+
+	_, first, err := cursorPage(db, url.Values{"limit": {"2"}, "sort": {"first_name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(first.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(token string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(token))
+	}
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		param  string
+	}{
+		{"other sort field", "username", first.NextCursor, "cursor"},
+		{"other sort direction", "-first_name", first.NextCursor, "cursor"},
+		{"other tie-breaker", "first_name,-id", first.NextCursor, "cursor"},
+		{"not base64", "first_name", "%%%", "cursor"},
+		{"not JSON", "first_name", encode("not json"), "cursor"},
+		{"truncated", "first_name", encode(string(decoded[:len(decoded)-3])), "cursor"},
+		{"too few values", "first_name", encode(`{"s":"first_name,id","v":["a"]}`), "cursor"},
+		{"too many values", "first_name", encode(`{"s":"first_name,id","v":["a",1,2]}`), "cursor"},
+		{"value of wrong type", "first_name", encode(`{"s":"first_name,id","v":["a","one"]}`), "cursor"},
+		{"forged sort signature", "first_name", encode(`{"s":"password,id","v":["a",1]}`), "cursor"},
+		{"unknown sort field", "password", "", "sort"},
+		{"nullable sort field", "email_verified_at", "", "sort"},
+		{"soft delete column", "deleted_at", "", "sort"},
+		{"limit too large", "first_name", "", "limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"limit": {"2"}, "sort": {tt.sort}}
+			if tt.cursor != "" {
+				query.Set("cursor", tt.cursor)
+			}
+			if tt.param == "limit" {
+				query.Set("limit", "1000")
+			}
+
+			users, _, err := cursorPage(db, query)
+
+			var fieldErr *FieldError
+			var queryErr *QueryError
+			switch {
+			case errors.As(err, &queryErr):
+				if queryErr.Param != tt.param {
+					t.Errorf("err = %v, want one about %s", err, tt.param)
+				}
+			case errors.As(err, &fieldErr):
+				if fieldErr.Param != tt.param {
+					t.Errorf("err = %v, want one about %s", err, tt.param)
+				}
+			default:
+				t.Errorf("got %d users, err = %v, want a rejected %s", len(users), err, tt.param)
+			}
+		})
+	}
+}
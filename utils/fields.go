@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// FieldError reports a query parameter that references a field the model does not expose
+type FieldError struct {
+	Param   string   `json:"param"`
+	Field   string   `json:"field"`
+	Allowed []string `json:"allowed_fields"`
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: unknown field %q, allowed fields: %s", e.Param, e.Field, strings.Join(e.Allowed, ", "))
+}
+
+// QueryError reports a malformed list query parameter
+type QueryError struct {
+	Param   string `json:"param"`
+	Message string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Param, e.Message)
+}
+
+// FieldRegistry maps the JSON field names of a model to its database columns.
+// Only fields listed here may be used for sorting and filtering.
+type FieldRegistry struct {
+	schema *schema.Schema
+	fields map[string]*schema.Field
+	names  []string
+}
+
+var registries sync.Map // reflect.Type -> *FieldRegistry
+
+// FieldsFor returns the field registry for the model set on db via db.Model.
+// Columns are derived from the gorm schema: every column with a JSON name is
+// included, fields tagged json:"-" (such as passwords) never are.
+func FieldsFor(db *gorm.DB) (*FieldRegistry, error) {
+	model := db.Statement.Model
+	if model == nil {
+		return nil, fmt.Errorf("no model set on query")
+	}
+
+	modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	if cached, ok := registries.Load(modelType); ok {
+		return cached.(*FieldRegistry), nil
+	}
+
+	if err := db.Statement.Parse(model); err != nil {
+		return nil, fmt.Errorf("failed to parse model schema: %w", err)
+	}
+
+	registry := newFieldRegistry(db.Statement.Schema)
+	registries.Store(modelType, registry)
+	return registry, nil
+}
+
+func newFieldRegistry(s *schema.Schema) *FieldRegistry {
+	registry := &FieldRegistry{schema: s, fields: make(map[string]*schema.Field)}
+
+	for _, field := range s.Fields {
+		if field.DBName == "" || !field.Readable {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.DBName
+		}
+
+		registry.fields[name] = field
+		registry.names = append(registry.names, name)
+	}
+
+	sort.Strings(registry.names)
+	return registry
+}
+
+// Column resolves a JSON field name to its database column
+func (r *FieldRegistry) Column(name string) (string, bool) {
+	field, ok := r.fields[name]
+	if !ok {
+		return "", false
+	}
+	return field.DBName, true
+}
+
+// Names returns the allowed JSON field names in sorted order
+func (r *FieldRegistry) Names() []string {
+	return append([]string(nil), r.names...)
+}
+
+// field resolves name to its schema field, returning a FieldError
+// attributed to param when the field is not allowed
+func (r *FieldRegistry) field(param, name string) (*schema.Field, error) {
+	field, ok := r.fields[name]
+	if !ok {
+		return nil, &FieldError{Param: param, Field: name, Allowed: r.Names()}
+	}
+	return field, nil
+}
+
+// column resolves name to a quoted column expression of the current table,
+// returning a FieldError attributed to param when the field is not allowed
+func (r *FieldRegistry) column(param, name string) (clause.Column, error) {
+	dbName, ok := r.Column(name)
+	if !ok {
+		return clause.Column{}, &FieldError{Param: param, Field: name, Allowed: r.Names()}
+	}
+	return clause.Column{Table: clause.CurrentTable, Name: dbName}, nil
+}
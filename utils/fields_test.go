@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"go-crud/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns a migrated in-memory database
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// testContext returns a gin context for a GET request with the given query string
+func testContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/?"+query, nil)
+	return c
+}
+
+func TestFieldsFor(t *testing.T) {
+	db := openTestDB(t)
+
+	fields, err := FieldsFor(db.Model(&models.User{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"id": "id", "username": "username", "first_name": "first_name", "created_at": "created_at"} {
+		if column, ok := fields.Column(name); !ok || column != want {
+			t.Errorf("Column(%q) = %q, %v, want %q", name, column, ok, want)
+		}
+	}
+	for _, name := range []string{"password", "Password", "profile", "nope"} {
+		if column, ok := fields.Column(name); ok {
+			t.Errorf("Column(%q) = %q, want no column", name, column)
+		}
+	}
+	for _, name := range fields.Names() {
+		if name == "password" {
+			t.Errorf("Names() = %v, includes password", fields.Names())
+		}
+	}
+
+	if _, err := FieldsFor(db); err == nil {
+		t.Error("FieldsFor without a model succeeded")
+	}
+}
+
+func TestPaginateQueryFields(t *testing.T) {
+	db := openTestDB(t)
+	users := []models.User{
+		{Username: "carol", Email: "carol@example.com", Password: "c"},
+		{Username: "alice", Email: "alice@example.com", Password: "a"},
+		{Username: "bob", Email: "bob@example.com", Password: "b"},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		param string // of the expected *FieldError or *QueryError
+		field string // of the expected *FieldError
+		want  string // usernames in order
+	}{
+		{query: "sort=username", want: "alice,bob,carol"},
+		{query: "sort=username&order=desc", want: "carol,bob,alice"},
+		{query: "filter[username][ne]=bob&sort=username", want: "alice,carol"},
+		{query: "sort=password", param: "sort", field: "password"},
+		{query: "sort=Password", param: "sort", field: "Password"},
+		{query: "sort=username%3Bdrop%20table%20users", param: "sort", field: "username;drop table users"},
+		{query: "filter[password][eq]=a", param: "filter", field: "password"},
+		{query: "filter[password][like]=a", param: "filter", field: "password"},
+		{query: "filter[nope][eq]=a", param: "filter", field: "nope"},
+		{query: "filter[username][regex]=a", param: "filter[username][regex]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, _, err := PaginateQuery(db.Model(&models.User{}), testContext(tt.query))
+
+			if tt.param != "" {
+				var fieldErr *FieldError
+				var queryErr *QueryError
+				switch {
+				case tt.field != "" && errors.As(err, &fieldErr):
+					if fieldErr.Param != tt.param || fieldErr.Field != tt.field {
+						t.Errorf("err = %+v, want field %q of %s", fieldErr, tt.field, tt.param)
+					}
+				case tt.field == "" && errors.As(err, &queryErr):
+					if queryErr.Param != tt.param {
+						t.Errorf("err = %+v, want one about %s", queryErr, tt.param)
+					}
+				default:
+					t.Errorf("err = %v, want a rejection of %s", err, tt.param)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found []models.User
+			if err := query.Find(&found).Error; err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			for i, user := range found {
+				if i > 0 {
+					got += ","
+				}
+				got += user.Username
+			}
+			if got != tt.want {
+				t.Errorf("users = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
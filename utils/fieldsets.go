@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MaxIncludeDepth limits how deeply relations may be nested in ?include=
+const MaxIncludeDepth = 2
+
+// Includes maps the relation names a resource allows in ?include= (the JSON
+// key of the relation, dotted for nested relations) to their gorm preload path
+type Includes map[string]string
+
+// Names returns the includable relation names in sorted order
+func (i Includes) Names() []string {
+	names := make([]string, 0, len(i))
+	for name := range i {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fieldset is the sparse fieldset requested with ?fields= and ?include=
+type Fieldset struct {
+	Fields   []string
+	Includes []string
+}
+
+// ApplyFieldset selects the columns listed in ?fields=id,title and preloads
+// the relations listed in ?include=user,tags on db. Fields must be registered
+// for the model and relations must be in allowed; primary and foreign keys
+// needed to load the included relations are always selected.
+func ApplyFieldset(db *gorm.DB, c *gin.Context, allowed Includes) (*gorm.DB, *Fieldset, error) {
+	fields, err := FieldsFor(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fieldset := &Fieldset{}
+	relations := map[string]bool{}
+
+	for _, name := range splitList(c.Query("include")) {
+		if depth := strings.Count(name, ".") + 1; depth > MaxIncludeDepth {
+			return nil, nil, &QueryError{
+				Param:   "include",
+				Message: fmt.Sprintf("%q is nested deeper than %d levels", name, MaxIncludeDepth),
+			}
+		}
+
+		path, ok := allowed[name]
+		if !ok {
+			return nil, nil, &FieldError{Param: "include", Field: name, Allowed: allowed.Names()}
+		}
+
+		db = db.Preload(path)
+		fieldset.Includes = append(fieldset.Includes, name)
+		relations[strings.Split(path, ".")[0]] = true
+	}
+
+	requested := splitList(c.Query("fields"))
+	if len(requested) == 0 {
+		return db, fieldset, nil
+	}
+
+	var columns []string
+	for _, field := range fields.schema.PrimaryFields {
+		columns = append(columns, field.DBName)
+	}
+
+	for _, name := range requested {
+		field, err := fields.field("fields", name)
+		if err != nil {
+			return nil, nil, err
+		}
+		columns = append(columns, field.DBName)
+		fieldset.Fields = append(fieldset.Fields, name)
+	}
+
+	// Keys the preloads join on
+	for name := range relations {
+		relation, ok := fields.schema.Relationships.Relations[name]
+		if !ok {
+			continue
+		}
+		for _, ref := range relation.References {
+			if ref.OwnPrimaryKey && ref.PrimaryKey != nil {
+				columns = append(columns, ref.PrimaryKey.DBName)
+			} else if !ref.OwnPrimaryKey && ref.ForeignKey != nil && ref.ForeignKey.Schema == fields.schema {
+				columns = append(columns, ref.ForeignKey.DBName)
+			}
+		}
+	}
+
+	return db.Select(uniqueStrings(columns)), fieldset, nil
+}
+
+// Project trims data (a model or a slice of models) to the requested fields
+// and included relations. Without ?fields= data is returned unchanged.
+func (f *Fieldset) Project(data interface{}) (interface{}, error) {
+	if f == nil || len(f.Fields) == 0 {
+		return data, nil
+	}
+
+	// The id is always returned so clients can address the resource
+	keep := map[string]bool{"id": true}
+	for _, name := range f.Fields {
+		keep[name] = true
+	}
+	for _, name := range f.Includes {
+		keep[strings.Split(name, ".")[0]] = true
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	switch value := decoded.(type) {
+	case map[string]interface{}:
+		projectObject(value, keep)
+	case []interface{}:
+		for _, item := range value {
+			if object, ok := item.(map[string]interface{}); ok {
+				projectObject(object, keep)
+			}
+		}
+	}
+
+	return decoded, nil
+}
+
+func projectObject(object map[string]interface{}, keep map[string]bool) {
+	for key := range object {
+		if !keep[key] {
+			delete(object, key)
+		}
+	}
+}
+
+// splitList splits a comma separated query value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := values[:0]
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
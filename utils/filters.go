@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// listOperators take a comma separated list of values
+var listOperators = map[string]bool{
+	"in":      true,
+	"not_in":  true,
+	"between": true,
+}
+
+// stringOperators only apply to text columns
+var stringOperators = map[string]bool{
+	"like":        true,
+	"starts_with": true,
+	"ends_with":   true,
+}
+
+// timeLayouts are the accepted formats for time filter values
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseFilterValue turns the raw query values of a filter into its Value:
+// a []interface{} for list operators (comma separated, repeated keys are
+// merged) and the first value otherwise
+func parseFilterValue(operator string, values []string) interface{} {
+	if !listOperators[operator] {
+		return values[0]
+	}
+
+	var list []interface{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// filterExpression builds the where clause for a single filter
+func filterExpression(fields *FieldRegistry, filter Filter) (clause.Expression, error) {
+	field, err := fields.field("filter", filter.Field)
+	if err != nil {
+		return nil, err
+	}
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+	if stringOperators[filter.Operator] && field.DataType != schema.String {
+		return nil, filterError(filter, "operator only applies to text fields")
+	}
+
+	switch filter.Operator {
+	case "is_null":
+		isNull := true
+		if raw, ok := filter.Value.(string); ok && raw != "" {
+			if isNull, err = strconv.ParseBool(raw); err != nil {
+				return nil, filterError(filter, "value must be true or false")
+			}
+		}
+		if isNull {
+			return clause.Eq{Column: column, Value: nil}, nil
+		}
+		return clause.Neq{Column: column, Value: nil}, nil
+
+	case "in", "not_in", "between":
+		values, err := coerceFilterList(field, filter)
+		if err != nil {
+			return nil, err
+		}
+		switch filter.Operator {
+		case "in":
+			return clause.IN{Column: column, Values: values}, nil
+		case "not_in":
+			return clause.Not(clause.IN{Column: column, Values: values}), nil
+		default:
+			if len(values) != 2 {
+				return nil, filterError(filter, "between requires exactly two values")
+			}
+			return clause.And(
+				clause.Gte{Column: column, Value: values[0]},
+				clause.Lte{Column: column, Value: values[1]},
+			), nil
+		}
+	}
+
+	value, err := coerceFilterValue(field, filter, filter.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filter.Operator {
+	case "eq":
+		return clause.Eq{Column: column, Value: value}, nil
+	case "ne":
+		return clause.Neq{Column: column, Value: value}, nil
+	case "gt":
+		return clause.Gt{Column: column, Value: value}, nil
+	case "gte":
+		return clause.Gte{Column: column, Value: value}, nil
+	case "lt":
+		return clause.Lt{Column: column, Value: value}, nil
+	case "lte":
+		return clause.Lte{Column: column, Value: value}, nil
+	case "like":
+		return escapedLike{Column: column, Value: "%" + escapeLike(fmt.Sprintf("%v", value)) + "%"}, nil
+	case "starts_with":
+		return escapedLike{Column: column, Value: escapeLike(fmt.Sprintf("%v", value)) + "%"}, nil
+	case "ends_with":
+		return escapedLike{Column: column, Value: "%" + escapeLike(fmt.Sprintf("%v", value))}, nil
+	}
+
+	return nil, filterError(filter, "unsupported operator")
+}
+
+func coerceFilterList(field *schema.Field, filter Filter) ([]interface{}, error) {
+	raw, ok := filter.Value.([]interface{})
+	if !ok {
+		// Value set by a caller other than ParseFilters
+		raw = parseFilterValue(filter.Operator, []string{fmt.Sprintf("%v", filter.Value)}).([]interface{})
+	}
+	if len(raw) == 0 {
+		return nil, filterError(filter, "at least one value is required")
+	}
+
+	values := make([]interface{}, len(raw))
+	for i, item := range raw {
+		value, err := coerceFilterValue(field, filter, item)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// coerceFilterValue converts a string value to the Go type of the column so
+// that comparisons are typed; non-string values are passed through
+func coerceFilterValue(field *schema.Field, filter Filter, value interface{}) (interface{}, error) {
+	raw, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+
+	switch field.DataType {
+	case schema.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, filterError(filter, fmt.Sprintf("%q is not a boolean", raw))
+		}
+		return parsed, nil
+	case schema.Int:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, filterError(filter, fmt.Sprintf("%q is not an integer", raw))
+		}
+		return parsed, nil
+	case schema.Uint:
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, filterError(filter, fmt.Sprintf("%q is not a non-negative integer", raw))
+		}
+		return parsed, nil
+	case schema.Float:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, filterError(filter, fmt.Sprintf("%q is not a number", raw))
+		}
+		return parsed, nil
+	case schema.Time:
+		for _, layout := range timeLayouts {
+			if parsed, err := time.Parse(layout, raw); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, filterError(filter, fmt.Sprintf("%q is not a valid time (use RFC3339 or YYYY-MM-DD)", raw))
+	}
+
+	return raw, nil
+}
+
+func filterError(filter Filter, message string) *QueryError {
+	return &QueryError{
+		Param:   fmt.Sprintf("filter[%s][%s]", filter.Field, filter.Operator),
+		Message: message,
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in a user supplied value. Patterns
+// built with it must be matched with escapedLike.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// escapedLike is clause.Like with an explicit ESCAPE '\', which SQLite and
+// PostgreSQL need to honour the escapes of escapeLike. The escape character
+// is bound as a parameter since MySQL reads a backslash in a string literal
+// as an escape of its own.
+type escapedLike clause.Like
+
+func (like escapedLike) Build(builder clause.Builder) {
+	builder.WriteQuoted(like.Column)
+	builder.WriteString(" LIKE ")
+	builder.AddVar(builder, like.Value)
+	builder.WriteString(" ESCAPE ")
+	builder.AddVar(builder, `\`)
+}
+
+func (like escapedLike) NegationBuild(builder clause.Builder) {
+	builder.WriteQuoted(like.Column)
+	builder.WriteString(" NOT LIKE ")
+	builder.AddVar(builder, like.Value)
+	builder.WriteString(" ESCAPE ")
+	builder.AddVar(builder, `\`)
+}
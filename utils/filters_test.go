@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-crud/models"
+
+	"gorm.io/gorm"
+)
+
+// filterUsers creates alice, bob, carol and the soft-deleted dave (IDs 1-4)
+func filterUsers(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db := openTestDB(t)
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	users := []models.User{
+		{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true, CreatedAt: day(time.January, 10)},
+		{Username: "bob", Email: "bob@example.com", Password: "x", IsActive: true, CreatedAt: day(time.March, 5)},
+		{Username: "carol", Email: "carol@example.com", Password: "x", IsActive: true, CreatedAt: day(time.June, 20)},
+		{Username: "dave", Email: "dave@example.com", Password: "x", IsActive: true, CreatedAt: day(time.September, 1)},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	// IsActive defaults to true, so a false value has to be written explicitly
+	if err := db.Model(&users[1]).Update("is_active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&users[3]).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestApplyFilters(t *testing.T) {
+	db := filterUsers(t)
+
+	tests := []struct {
+		query    string
+		unscoped bool   // include soft-deleted users
+		want     []uint // matching user IDs
+		err      string // Param of the expected *QueryError
+	}{
+		{query: "filter[is_active][eq]=true", want: []uint{1, 3}},
+		{query: "filter[is_active][eq]=false", want: []uint{2}},
+		{query: "filter[is_active][eq]=0", want: []uint{2}},
+		{query: "filter[is_active][eq]=yes", err: "filter[is_active][eq]"},
+		{query: "filter[id][gt]=1", want: []uint{2, 3}},
+		{query: "filter[id][lte]=2", want: []uint{1, 2}},
+		{query: "filter[id][ne]=2", want: []uint{1, 3}},
+		{query: "filter[id][gt]=-1", err: "filter[id][gt]"},
+		{query: "filter[id][eq]=one", err: "filter[id][eq]"},
+		{query: "filter[created_at][gte]=2024-03-05T00:00:00Z", want: []uint{2, 3}},
+		{query: "filter[created_at][lt]=2024-03-05", want: []uint{1}},
+		{query: "filter[created_at][gt]=2024-03-04+12:00:00", want: []uint{2, 3}},
+		{query: "filter[created_at][lt]=March", err: "filter[created_at][lt]"},
+
+		{query: "filter[id][in]=1,3", want: []uint{1, 3}},
+		{query: "filter[id][in]=1&filter[id][in]=3", want: []uint{1, 3}},
+		{query: "filter[id][in]=+1+,,3,", want: []uint{1, 3}},
+		{query: "filter[id][not_in]=1,3", want: []uint{2}},
+		{query: "filter[username][in]=alice,carol", want: []uint{1, 3}},
+		{query: "filter[id][in]=1,x", err: "filter[id][in]"},
+		{query: "filter[id][in]=,", err: "filter[id][in]"},
+		{query: "filter[created_at][between]=2024-02-01,2024-12-31", want: []uint{2, 3}},
+		{query: "filter[id][between]=2,3", want: []uint{2, 3}},
+		{query: "filter[created_at][between]=2024-02-01", err: "filter[created_at][between]"},
+		{query: "filter[id][between]=1,2,3", err: "filter[id][between]"},
+
+		{query: "filter[deleted_at][is_null]=true", unscoped: true, want: []uint{1, 2, 3}},
+		{query: "filter[deleted_at][is_null]", unscoped: true, want: []uint{1, 2, 3}},
+		{query: "filter[deleted_at][is_null]=false", unscoped: true, want: []uint{4}},
+		{query: "filter[deleted_at][is_null]=maybe", unscoped: true, err: "filter[deleted_at][is_null]"},
+
+		{query: "filter[username][like]=ar", want: []uint{3}},
+		{query: "filter[username][starts_with]=b", want: []uint{2}},
+		{query: "filter[username][ends_with]=ce", want: []uint{1}},
+		{query: "filter[id][like]=1", err: "filter[id][like]"},
+		{query: "filter[is_active][starts_with]=t", err: "filter[is_active][starts_with]"},
+
+		{query: "filter[or][a][username][eq]=alice&filter[or][a][username][eq]=bob", want: []uint{1, 2}},
+		{query: "filter[or][a][username][eq]=alice&filter[or][a][is_active][eq]=false", want: []uint{1, 2}},
+		{query: "filter[or][a][username][eq]=alice&filter[or][a][username][eq]=bob&filter[is_active][eq]=true", want: []uint{1}},
+		{query: "filter[or][a][id][eq]=1&filter[or][a][id][eq]=2&filter[or][b][id][eq]=2&filter[or][b][id][eq]=3", want: []uint{2}},
+		{query: "filter[or][a][id][in]=1,2&filter[or][a][username][eq]=carol", want: []uint{1, 2, 3}},
+		{query: "filter[or][a][id][eq]=x", err: "filter[id][eq]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query := db.Model(&models.User{})
+			if tt.unscoped {
+				query = query.Unscoped()
+			}
+			fields, err := FieldsFor(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filtered, err := ApplyFilters(query, fields, ParseFilters(testContext(tt.query)))
+			if tt.err != "" {
+				var queryErr *QueryError
+				if !errors.As(err, &queryErr) || queryErr.Param != tt.err {
+					t.Fatalf("err = %v, want a QueryError for %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []uint
+			if err := filtered.Order("id").Pluck("id", &ids).Error; err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("IDs = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestLikeFiltersMatchWildcardsLiterally(t *testing.T) {
+	db := openTestDB(t)
+	for _, username := range []string{"a_b", "axb", "50%off", "50xoff", `back\slash`} {
+		if err := db.Create(&models.User{Username: username, Email: username + "@example.com", Password: "x"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		expr  string
+		want  []string
+	}{
+		{query: "filter[username][like]=_", want: []string{"a_b"}},
+		{query: "filter[username][like]=%25", want: []string{"50%off"}},
+		{query: "filter[username][starts_with]=a_", want: []string{"a_b"}},
+		{query: "filter[username][ends_with]=%25off", want: []string{"50%off"}},
+		{query: `filter[username][like]=k%5Cs`, want: []string{`back\slash`}},
+		{expr: "username==a_*", want: []string{"a_b"}},
+		{expr: "username==*%*", want: []string{"50%off"}},
+		{expr: "username!=*_*", want: []string{"50%off", "50xoff", "axb", `back\slash`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query+tt.expr, func(t *testing.T) {
+			query := db.Model(&models.User{})
+			fields, err := FieldsFor(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.expr != "" {
+				query, err = ApplyFilterExpression(query, fields, tt.expr)
+			} else {
+				query, err = ApplyFilters(query, fields, ParseFilters(testContext(tt.query)))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var usernames []string
+			if err := query.Order("username").Pluck("username", &usernames).Error; err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(usernames, tt.want) {
+				t.Errorf("usernames = %q, want %q", usernames, tt.want)
+			}
+		})
+	}
+}
@@ -3,11 +3,13 @@ package utils
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Pagination struct {
@@ -23,8 +25,9 @@ type Pagination struct {
 
 type Filter struct {
 	Field    string      `json:"field"`
-	Operator string      `json:"operator"` // eq, ne, gt, gte, lt, lte, like, in, not_in
+	Operator string      `json:"operator"` // eq, ne, gt, gte, lt, lte, like, starts_with, ends_with, in, not_in, between, is_null
 	Value    interface{} `json:"value"`
+	Group    string      `json:"group,omitempty"` // filters in the same group are OR-ed together
 }
 
 func ParsePagination(c *gin.Context) (int, int, string, string) {
@@ -60,25 +63,53 @@ func ParsePagination(c *gin.Context) (int, int, string, string) {
 
 func ParseFilters(c *gin.Context) []Filter {
 	var filters []Filter
+	query := c.Request.URL.Query()
+	
+	// Sort keys so the generated SQL is deterministic
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 	
 	// Parse filter parameters
 	// Format: filter[field][operator]=value
-	for key, values := range c.Request.URL.Query() {
+	// OR-group format: filter[or][group][field][operator]=value
+	for _, key := range keys {
+		values := query[key]
 		if strings.HasPrefix(key, "filter[") && strings.HasSuffix(key, "]") {
 			// Extract field and operator from key like "filter[username][eq]"
 			parts := strings.Split(key[7:len(key)-1], "][")
-			if len(parts) == 2 {
-				field := parts[0]
-				operator := parts[1]
-				
-				if len(values) > 0 {
+			
+			group := ""
+			if len(parts) == 4 && parts[0] == "or" {
+				group = parts[1]
+				parts = parts[2:]
+			}
+			
+			if len(parts) != 2 || len(values) == 0 {
+				continue
+			}
+			
+			// Within an OR-group a repeated key adds one alternative per value
+			if group != "" && !listOperators[parts[1]] {
+				for _, value := range values {
 					filters = append(filters, Filter{
-						Field:    field,
-						Operator: operator,
-						Value:    values[0],
+						Field:    parts[0],
+						Operator: parts[1],
+						Value:    value,
+						Group:    group,
 					})
 				}
+				continue
 			}
+			
+			filters = append(filters, Filter{
+				Field:    parts[0],
+				Operator: parts[1],
+				Value:    parseFilterValue(parts[1], values),
+				Group:    group,
+			})
 		}
 	}
 	
@@ -90,41 +121,48 @@ func ApplyPagination(db *gorm.DB, page, perPage int) *gorm.DB {
 	return db.Offset(offset).Limit(perPage)
 }
 
-func ApplySorting(db *gorm.DB, sort, order string) *gorm.DB {
-	if sort != "" {
-		return db.Order(fmt.Sprintf("%s %s", sort, order))
+func ApplySorting(db *gorm.DB, fields *FieldRegistry, sort, order string) (*gorm.DB, error) {
+	if sort == "" {
+		return db, nil
 	}
-	return db
+	
+	column, err := fields.column("sort", sort)
+	if err != nil {
+		return nil, err
+	}
+	
+	return db.Order(clause.OrderByColumn{Column: column, Desc: order == "desc"}), nil
 }
 
-func ApplyFilters(db *gorm.DB, filters []Filter) *gorm.DB {
+// ApplyFilters adds the filters to db. Plain filters are combined with AND;
+// filters sharing an OR-group are combined with OR and the group is then
+// AND-ed with the rest. String values are coerced to the column's type.
+func ApplyFilters(db *gorm.DB, fields *FieldRegistry, filters []Filter) (*gorm.DB, error) {
+	groups := make(map[string][]clause.Expression)
+	var groupNames []string
+	
 	for _, filter := range filters {
-		switch filter.Operator {
-		case "eq":
-			db = db.Where(fmt.Sprintf("%s = ?", filter.Field), filter.Value)
-		case "ne":
-			db = db.Where(fmt.Sprintf("%s != ?", filter.Field), filter.Value)
-		case "gt":
-			db = db.Where(fmt.Sprintf("%s > ?", filter.Field), filter.Value)
-		case "gte":
-			db = db.Where(fmt.Sprintf("%s >= ?", filter.Field), filter.Value)
-		case "lt":
-			db = db.Where(fmt.Sprintf("%s < ?", filter.Field), filter.Value)
-		case "lte":
-			db = db.Where(fmt.Sprintf("%s <= ?", filter.Field), filter.Value)
-		case "like":
-			db = db.Where(fmt.Sprintf("%s LIKE ?", filter.Field), "%"+fmt.Sprintf("%v", filter.Value)+"%")
-		case "in":
-			if values, ok := filter.Value.([]interface{}); ok {
-				db = db.Where(fmt.Sprintf("%s IN ?", filter.Field), values)
-			}
-		case "not_in":
-			if values, ok := filter.Value.([]interface{}); ok {
-				db = db.Where(fmt.Sprintf("%s NOT IN ?", filter.Field), values)
-			}
+		expr, err := filterExpression(fields, filter)
+		if err != nil {
+			return nil, err
 		}
+		
+		if filter.Group == "" {
+			db = db.Where(expr)
+			continue
+		}
+		
+		if _, exists := groups[filter.Group]; !exists {
+			groupNames = append(groupNames, filter.Group)
+		}
+		groups[filter.Group] = append(groups[filter.Group], expr)
 	}
-	return db
+	
+	for _, name := range groupNames {
+		db = db.Where(clause.Or(groups[name]...))
+	}
+	
+	return db, nil
 }
 
 func CalculatePagination(page, perPage int, total int64) Pagination {
@@ -140,12 +178,31 @@ func CalculatePagination(page, perPage int, total int64) Pagination {
 	}
 }
 
+// PaginateQuery applies the request's filters, sorting and pagination to db.
+// The model must be set with db.Model; only its registered fields may be
+// sorted or filtered on, otherwise a *FieldError is returned.
 func PaginateQuery(db *gorm.DB, c *gin.Context) (*gorm.DB, Pagination, error) {
 	page, perPage, sort, order := ParsePagination(c)
 	filters := ParseFilters(c)
 	
+	fields, err := FieldsFor(db)
+	if err != nil {
+		return nil, Pagination{}, err
+	}
+	
 	// Apply filters
-	db = ApplyFilters(db, filters)
+	db, err = ApplyFilters(db, fields, filters)
+	if err != nil {
+		return nil, Pagination{}, err
+	}
+	
+	// Apply filter expression (?filter=status==published;user_id==3)
+	if expr := c.Query("filter"); expr != "" {
+		db, err = ApplyFilterExpression(db, fields, expr)
+		if err != nil {
+			return nil, Pagination{}, err
+		}
+	}
 	
 	// Count total records
 	var total int64
@@ -154,7 +211,10 @@ func PaginateQuery(db *gorm.DB, c *gin.Context) (*gorm.DB, Pagination, error) {
 	}
 	
 	// Apply sorting
-	db = ApplySorting(db, sort, order)
+	db, err = ApplySorting(db, fields, sort, order)
+	if err != nil {
+		return nil, Pagination{}, err
+	}
 	
 	// Apply pagination
 	db = ApplyPagination(db, page, perPage)
@@ -3,13 +3,18 @@ package router
 import (
 	"baton-om-data-apiservice/internal/dblinker"
 	"baton-om-data-apiservice/internal/sysenv"
+	"go-crud/auth"
+	"go-crud/middleware"
+	"go-crud/routes"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-func StartGinServer() {
+// StartGinServer 는 데이터스토어 API 를 실행합니다. 모든 요청은 access token 또는
+// API 키로 인증되어야 하며, 각 동작에 해당하는 *:data 권한(API 키는 scope)이 필요합니다.
+func StartGinServer(authService *auth.AuthService, rbacService *auth.RBACService) {
 	fnc := "StartGinServer"
 	log.Printf("%s Run", fnc)
 
@@ -23,11 +28,15 @@ func StartGinServer() {
 	// 패닉 및 에러 처리를 위해 리커버리 미들웨어 사용
 	r.Use(gin.Recovery())
 
-	dataApi := r.Group("/api/v1/datastore")
+	// 인증, 사용자, 게시글 등 go-crud API 라우트 등록
+	routes.SetupRoutes(r, authService, rbacService)
+
+	// 인증되지 않은 요청은 401, 권한이 없으면 403
+	dataApi := r.Group("/api/v1/datastore", middleware.AuthMiddleware(authService))
 	{
 		crud := dataApi.Group("data")
 		{
-			crud.POST("/insert", func(c *gin.Context) {
+			crud.POST("/insert", middleware.RequirePermission(rbacService, auth.CreateData), func(c *gin.Context) {
 				var err error
 				var req sysenv.Data
 				if err = c.BindJSON(&req); err != nil {
@@ -42,7 +51,7 @@ func StartGinServer() {
 				}
 				c.JSON(http.StatusOK, gin.H{"message": "Data insert successfully"})
 			})
-			crud.GET("/search", func(c *gin.Context) {
+			crud.GET("/search", middleware.RequirePermission(rbacService, auth.ReadData), func(c *gin.Context) {
 				var err error
 				var req sysenv.DataSearch
 				if err = c.BindJSON(&req); err != nil {
@@ -68,7 +77,7 @@ func StartGinServer() {
 
 				c.JSON(http.StatusOK, res)
 			})
-			crud.DELETE("/delete", func(c *gin.Context) {
+			crud.DELETE("/delete", middleware.RequirePermission(rbacService, auth.DeleteData), func(c *gin.Context) {
 				var err error
 				var req sysenv.DataSearch
 				if err = c.BindJSON(&req); err != nil {
@@ -85,7 +94,7 @@ func StartGinServer() {
 
 				c.JSON(http.StatusOK, gin.H{"message": "Data delete successfully"})
 			})
-			crud.PUT("/update", func(c *gin.Context) {
+			crud.PUT("/update", middleware.RequirePermission(rbacService, auth.UpdateData), func(c *gin.Context) {
 				var err error
 				var req sysenv.Data
 				if err = c.BindJSON(&req); err != nil {
@@ -102,7 +111,7 @@ func StartGinServer() {
 
 				c.JSON(http.StatusOK, gin.H{"message": "Data update successfully"})
 			})
-			crud.GET("/all", func(c *gin.Context) {
+			crud.GET("/all", middleware.RequirePermission(rbacService, auth.ReadData), func(c *gin.Context) {
 
 				if Vmlist, err := dblinker.LoadModule(db); err != nil {
 					log.Printf("%s: dblinker.LoadModule() failed: %s", fnc, err.Error())
@@ -0,0 +1,400 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Limits on filter expressions accepted from clients
+const (
+	maxFilterExpressionLength = 2000
+	maxFilterExpressionDepth  = 16
+)
+
+// ParseError reports a syntax error in a filter expression.
+// Pos is the zero based byte offset of the offending input.
+type ParseError struct {
+	Pos     int    `json:"position"`
+	Message string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("filter: %s at position %d", e.Message, e.Pos)
+}
+
+// FilterNode is a node of a parsed filter expression
+type FilterNode interface {
+	filterNode()
+}
+
+// LogicalNode combines its children with "and" (;) or "or" (,)
+type LogicalNode struct {
+	Op       string
+	Children []FilterNode
+}
+
+// ComparisonNode is a single selector/operator/arguments constraint
+type ComparisonNode struct {
+	Field    string
+	Operator string
+	Args     []string
+	Pos      int
+}
+
+func (*LogicalNode) filterNode()    {}
+func (*ComparisonNode) filterNode() {}
+
+// rsqlOperators maps the RSQL/FIQL comparison operators to Filter operators
+var rsqlOperators = map[string]string{
+	"==":        "eq",
+	"!=":        "ne",
+	"=lt=":      "lt",
+	"<":         "lt",
+	"=le=":      "lte",
+	"<=":        "lte",
+	"=gt=":      "gt",
+	">":         "gt",
+	"=ge=":      "gte",
+	">=":        "gte",
+	"=in=":      "in",
+	"=out=":     "not_in",
+	"=between=": "between",
+	"=isnull=":  "is_null",
+}
+
+// ParseFilterExpression parses an RSQL-like expression such as
+//
+//	status==published;(category_id=in=(1,2),user_id==3)
+//
+// where ";" is AND, "," is OR and parentheses group. Values may be quoted
+// with ' or " and "*" in an == / != value acts as a wildcard.
+func ParseFilterExpression(input string) (FilterNode, error) {
+	if len(input) > maxFilterExpressionLength {
+		return nil, &ParseError{Pos: maxFilterExpressionLength, Message: "expression is too long"}
+	}
+
+	p := &rsqlParser{input: input}
+	node, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return node, nil
+}
+
+// ApplyFilterExpression parses expr and adds it to db as a single where
+// clause; only fields registered for the model may be referenced
+func ApplyFilterExpression(db *gorm.DB, fields *FieldRegistry, expr string) (*gorm.DB, error) {
+	node, err := ParseFilterExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	condition, err := filterNodeExpression(fields, node)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Where(condition), nil
+}
+
+func filterNodeExpression(fields *FieldRegistry, node FilterNode) (clause.Expression, error) {
+	switch n := node.(type) {
+	case *LogicalNode:
+		exprs := make([]clause.Expression, 0, len(n.Children))
+		for _, child := range n.Children {
+			expr, err := filterNodeExpression(fields, child)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, expr)
+		}
+		if n.Op == "or" {
+			return clause.Or(exprs...), nil
+		}
+		return clause.And(exprs...), nil
+
+	case *ComparisonNode:
+		return comparisonExpression(fields, n)
+	}
+
+	return nil, fmt.Errorf("unknown filter node %T", node)
+}
+
+func comparisonExpression(fields *FieldRegistry, n *ComparisonNode) (clause.Expression, error) {
+	operator := rsqlOperators[n.Operator]
+
+	// Wildcards turn equality into LIKE
+	if (operator == "eq" || operator == "ne") && len(n.Args) == 1 && strings.Contains(n.Args[0], "*") {
+		field, err := fields.field("filter", n.Field)
+		if err != nil {
+			return nil, err
+		}
+		if field.DataType != schema.String {
+			return nil, &ParseError{Pos: n.Pos, Message: fmt.Sprintf("wildcards only apply to text fields (%s)", n.Field)}
+		}
+
+		parts := strings.Split(n.Args[0], "*")
+		for i, part := range parts {
+			parts[i] = escapeLike(part)
+		}
+		like := escapedLike{
+			Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+			Value:  strings.Join(parts, "%"),
+		}
+		if operator == "ne" {
+			return clause.Not(like), nil
+		}
+		return like, nil
+	}
+
+	filter := Filter{Field: n.Field, Operator: operator}
+	if listOperators[operator] {
+		values := make([]interface{}, len(n.Args))
+		for i, arg := range n.Args {
+			values[i] = arg
+		}
+		filter.Value = values
+	} else {
+		if len(n.Args) != 1 {
+			return nil, &ParseError{Pos: n.Pos, Message: fmt.Sprintf("operator %s takes a single value", n.Operator)}
+		}
+		filter.Value = n.Args[0]
+	}
+
+	expr, err := filterExpression(fields, filter)
+	if queryErr, ok := err.(*QueryError); ok {
+		return nil, &ParseError{Pos: n.Pos, Message: fmt.Sprintf("%s: %s", n.Field, queryErr.Message)}
+	}
+	return expr, err
+}
+
+type rsqlParser struct {
+	input string
+	pos   int
+}
+
+func (p *rsqlParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *rsqlParser) peek() byte {
+	return p.input[p.pos]
+}
+
+func (p *rsqlParser) skipSpaces() {
+	for !p.eof() && p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+func (p *rsqlParser) errorf(format string, args ...interface{}) *ParseError {
+	return &ParseError{Pos: p.pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// parseOr: and ("," and)*
+func (p *rsqlParser) parseOr(depth int) (FilterNode, error) {
+	return p.parseLogical(depth, ',', "or", p.parseAnd)
+}
+
+// parseAnd: constraint (";" constraint)*
+func (p *rsqlParser) parseAnd(depth int) (FilterNode, error) {
+	return p.parseLogical(depth, ';', "and", p.parseConstraint)
+}
+
+func (p *rsqlParser) parseLogical(depth int, separator byte, op string, operand func(int) (FilterNode, error)) (FilterNode, error) {
+	first, err := operand(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	children := []FilterNode{first}
+	for {
+		p.skipSpaces()
+		if p.eof() || p.peek() != separator {
+			break
+		}
+		p.pos++
+
+		next, err := operand(depth)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &LogicalNode{Op: op, Children: children}, nil
+}
+
+// parseConstraint: "(" or ")" | comparison
+func (p *rsqlParser) parseConstraint(depth int) (FilterNode, error) {
+	p.skipSpaces()
+	if p.eof() {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	if p.peek() != '(' {
+		return p.parseComparison()
+	}
+
+	if depth >= maxFilterExpressionDepth {
+		return nil, p.errorf("expression is nested too deeply")
+	}
+	p.pos++
+
+	node, err := p.parseOr(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.eof() || p.peek() != ')' {
+		return nil, p.errorf("expected ')'")
+	}
+	p.pos++
+	return node, nil
+}
+
+// parseComparison: selector operator arguments
+func (p *rsqlParser) parseComparison() (FilterNode, error) {
+	start := p.pos
+	for !p.eof() && isSelectorChar(p.peek()) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected field name")
+	}
+	field := p.input[start:p.pos]
+
+	opPos := p.pos
+	operator := p.parseOperator()
+	if operator == "" {
+		return nil, &ParseError{Pos: opPos, Message: "expected comparison operator"}
+	}
+
+	args, err := p.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ComparisonNode{Field: field, Operator: operator, Args: args, Pos: start}, nil
+}
+
+func (p *rsqlParser) parseOperator() string {
+	rest := p.input[p.pos:]
+
+	// FIQL style =name=
+	if strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "==") {
+		if end := strings.IndexByte(rest[1:], '='); end >= 0 {
+			operator := rest[:end+2]
+			if _, ok := rsqlOperators[operator]; ok {
+				p.pos += len(operator)
+				return operator
+			}
+		}
+		return ""
+	}
+
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(rest, operator) {
+			p.pos += len(operator)
+			return operator
+		}
+	}
+	return ""
+}
+
+// parseArguments: value | "(" value ("," value)* ")"
+func (p *rsqlParser) parseArguments() ([]string, error) {
+	if p.eof() {
+		return nil, p.errorf("expected value")
+	}
+
+	if p.peek() != '(' {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return []string{value}, nil
+	}
+	p.pos++
+
+	var values []string
+	for {
+		p.skipSpaces()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		p.skipSpaces()
+		if p.eof() {
+			return nil, p.errorf("expected ')'")
+		}
+		if p.peek() == ')' {
+			p.pos++
+			return values, nil
+		}
+		if p.peek() != ',' {
+			return nil, p.errorf("expected ',' or ')'")
+		}
+		p.pos++
+	}
+}
+
+func (p *rsqlParser) parseValue() (string, error) {
+	if p.eof() {
+		return "", p.errorf("expected value")
+	}
+
+	if quote := p.peek(); quote == '\'' || quote == '"' {
+		start := p.pos
+		p.pos++
+
+		var b strings.Builder
+		for !p.eof() {
+			ch := p.peek()
+			p.pos++
+			switch {
+			case ch == '\\' && !p.eof():
+				b.WriteByte(p.peek())
+				p.pos++
+			case ch == quote:
+				return b.String(), nil
+			default:
+				b.WriteByte(ch)
+			}
+		}
+		return "", &ParseError{Pos: start, Message: "unterminated quoted value"}
+	}
+
+	start := p.pos
+	for !p.eof() && !isReservedChar(p.peek()) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected value")
+	}
+	return p.input[start:p.pos], nil
+}
+
+func isSelectorChar(ch byte) bool {
+	return ch == '_' || ch == '.' ||
+		(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+func isReservedChar(ch byte) bool {
+	return strings.IndexByte(`"'();,=!~<> `, ch) >= 0
+}
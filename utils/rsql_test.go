@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-crud/models"
+)
+
+// formatNode renders a parsed filter expression as and(...)/or(...) of
+// field operator [args] comparisons
+func formatNode(node FilterNode) string {
+	switch n := node.(type) {
+	case *LogicalNode:
+		children := make([]string, len(n.Children))
+		for i, child := range n.Children {
+			children[i] = formatNode(child)
+		}
+		return n.Op + "(" + strings.Join(children, ", ") + ")"
+	case *ComparisonNode:
+		return fmt.Sprintf("%s%s%q", n.Field, n.Operator, n.Args)
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+func TestParseFilterExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// ";" binds tighter than ","
+		{`a==1;b==2,c==3`, `or(and(a==["1"], b==["2"]), c==["3"])`},
+		{`a==1,b==2;c==3`, `or(a==["1"], and(b==["2"], c==["3"]))`},
+		{`a==1;b==2;c==3`, `and(a==["1"], b==["2"], c==["3"])`},
+		{`a==1,b==2,c==3`, `or(a==["1"], b==["2"], c==["3"])`},
+
+		// Parentheses
+		{`a==1;(b==2,c==3)`, `and(a==["1"], or(b==["2"], c==["3"]))`},
+		{`(a==1,b==2);c==3`, `and(or(a==["1"], b==["2"]), c==["3"])`},
+		{`((a==1))`, `a==["1"]`},
+		{`(a==1;(b==2,(c==3;d==4)))`, `and(a==["1"], or(b==["2"], and(c==["3"], d==["4"])))`},
+		{` a==1 ; ( b==2 , c==3 ) `, `and(a==["1"], or(b==["2"], c==["3"]))`},
+
+		// Quoting and escapes
+		{`name=='hello world'`, `name==["hello world"]`},
+		{`name=="it's"`, `name==["it's"]`},
+		{`name=='it\'s'`, `name==["it's"]`},
+		{`name=="say \"hi\""`, `name==["say \"hi\""]`},
+		{`name=='back\\slash'`, `name==["back\\slash"]`},
+		{`name=='a;b,(c)=d'`, `name==["a;b,(c)=d"]`},
+		{`name==''`, `name==[""]`},
+		{`name==café`, `name==["café"]`},
+
+		// Every operator
+		{`a==1`, `a==["1"]`},
+		{`a!=1`, `a!=["1"]`},
+		{`a=lt=1`, `a=lt=["1"]`},
+		{`a<1`, `a<["1"]`},
+		{`a=le=1`, `a=le=["1"]`},
+		{`a<=1`, `a<=["1"]`},
+		{`a=gt=1`, `a=gt=["1"]`},
+		{`a>1`, `a>["1"]`},
+		{`a=ge=1`, `a=ge=["1"]`},
+		{`a>=1`, `a>=["1"]`},
+		{`a=in=(1,2)`, `a=in=["1" "2"]`},
+		{`a=out=(1)`, `a=out=["1"]`},
+		{`a=between=(1,5)`, `a=between=["1" "5"]`},
+		{`a=isnull=true`, `a=isnull=["true"]`},
+		{`a=in=( 1 , 'x y' ,"z")`, `a=in=["1" "x y" "z"]`},
+		{`post.user_id==3`, `post.user_id==["3"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseFilterExpression(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatNode(node); got != tt.want {
+				t.Errorf("parsed = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		pos     int
+		message string
+	}{
+		{``, 0, "unexpected end of expression"},
+		{`a==1;`, 5, "unexpected end of expression"},
+		{`a==1,`, 5, "unexpected end of expression"},
+		{`==1`, 0, "expected field name"},
+		{`a==1;;b==2`, 5, "expected field name"},
+		{`a`, 1, "expected comparison operator"},
+		{`a~1`, 1, "expected comparison operator"},
+		{`a=foo=1`, 1, "expected comparison operator"},
+		{`a=1`, 1, "expected comparison operator"},
+		{`a==`, 3, "expected value"},
+		{`a==;b==1`, 3, "expected value"},
+		{`a==1)`, 4, `unexpected ')'`},
+		{`a==1 b==2`, 5, `unexpected 'b'`},
+		{`(a==1`, 5, "expected ')'"},
+		{`(a==1;(b==2)`, 12, "expected ')'"},
+		{`()`, 1, "expected field name"},
+		{`a=in=(1,2`, 9, "expected ')'"},
+		{`a=in=(1;2)`, 7, "expected ',' or ')'"},
+		{`a=in=()`, 6, "expected value"},
+		{`a=in=(1,)`, 8, "expected value"},
+		{`a=='abc`, 3, "unterminated quoted value"},
+		{`a==1;b=="abc\"`, 8, "unterminated quoted value"},
+		{strings.Repeat("(", 16) + "a==1" + strings.Repeat(")", 16) + ";" + strings.Repeat("(", 17) + "a==1", 53, "nested too deeply"},
+		{"a==" + strings.Repeat("x", maxFilterExpressionLength), maxFilterExpressionLength, "too long"},
+	}
+
+	for _, tt := range tests {
+		name := tt.input
+		if len(name) > 40 {
+			name = name[:40] + "..."
+		}
+		t.Run(name, func(t *testing.T) {
+			node, err := ParseFilterExpression(tt.input)
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("parsed = %v, err = %v, want a ParseError", node, err)
+			}
+			if parseErr.Pos != tt.pos || !strings.Contains(parseErr.Message, tt.message) {
+				t.Errorf("err = %v, want %q at position %d", err, tt.message, tt.pos)
+			}
+		})
+	}
+}
+
+func TestApplyFilterExpression(t *testing.T) {
+	db := filterUsers(t)
+
+	tests := []struct {
+		expr     string
+		unscoped bool   // include soft-deleted users
+		want     []uint // matching user IDs
+		pos      int    // of the expected *ParseError, -1 for none
+		field    string // of the expected *FieldError
+	}{
+		{expr: `username==alice,username==bob`, want: []uint{1, 2}, pos: -1},
+		{expr: `is_active==true;(username==alice,username==bob)`, want: []uint{1}, pos: -1},
+		{expr: `is_active==true;username==alice,username==bob`, want: []uint{1, 2}, pos: -1},
+		{expr: `username=="bob"`, want: []uint{2}, pos: -1},
+		{expr: `username==*o*`, want: []uint{2, 3}, pos: -1},
+		{expr: `username!=a*`, want: []uint{2, 3}, pos: -1},
+		{expr: `id=in=(1,3)`, want: []uint{1, 3}, pos: -1},
+		{expr: `id=out=(1,3)`, want: []uint{2}, pos: -1},
+		{expr: `id=between=(2,3)`, want: []uint{2, 3}, pos: -1},
+		{expr: `id=gt=1;id<3`, want: []uint{2}, pos: -1},
+		{expr: `id>=2;id=le=2`, want: []uint{2}, pos: -1},
+		{expr: `created_at=ge=2024-03-05`, want: []uint{2, 3}, pos: -1},
+		{expr: `deleted_at=isnull=false`, unscoped: true, want: []uint{4}, pos: -1},
+
+		{expr: `password==x`, pos: -1, field: "password"},
+		{expr: `username==alice,password==x`, pos: -1, field: "password"},
+		{expr: `id==abc`, pos: 0},
+		{expr: `username==alice;id=lt=(1,2)`, pos: 16},
+		{expr: `username==alice;id==1*`, pos: 16},
+		{expr: `id=between=(1)`, pos: 0},
+		{expr: `is_active==yes`, pos: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			query := db.Model(&models.User{})
+			if tt.unscoped {
+				query = query.Unscoped()
+			}
+			fields, err := FieldsFor(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filtered, err := ApplyFilterExpression(query, fields, tt.expr)
+
+			var parseErr *ParseError
+			var fieldErr *FieldError
+			switch {
+			case tt.pos >= 0:
+				if !errors.As(err, &parseErr) || parseErr.Pos != tt.pos {
+					t.Errorf("err = %v, want a ParseError at position %d", err, tt.pos)
+				}
+				return
+			case tt.field != "":
+				if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field {
+					t.Errorf("err = %v, want a FieldError for %s", err, tt.field)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			var ids []uint
+			if err := filtered.Order("id").Pluck("id", &ids).Error; err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("IDs = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Slugify converts a title or name into a URL friendly slug.
+// Non-ASCII letters are dropped, so callers should fall back to another
+// value when the result is empty.
+func Slugify(value string) string {
+	var b strings.Builder
+	lastHyphen := true
+
+	for _, r := range strings.ToLower(value) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			lastHyphen = false
+		case !lastHyphen:
+			b.WriteByte('-')
+			lastHyphen = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,112 @@
+package validation
+
+import "time"
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type APIKeyCreateRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyUpdateRequest struct {
+	Name   *string  `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func ValidateLogin(req *LoginRequest) []ValidationError {
+	validator := NewValidator()
+
+	// Sanitize inputs
+	req.Email = validator.SanitizeString(req.Email)
+
+	validator.Required("email", req.Email).
+		Required("password", req.Password).
+		Email("email", req.Email)
+
+	return validator.GetErrors()
+}
+
+func ValidateForgotPassword(req *ForgotPasswordRequest) []ValidationError {
+	validator := NewValidator()
+
+	req.Email = validator.SanitizeString(req.Email)
+
+	validator.Required("email", req.Email).
+		Email("email", req.Email)
+
+	return validator.GetErrors()
+}
+
+func ValidateResetPassword(req *ResetPasswordRequest) []ValidationError {
+	validator := NewValidator()
+
+	validator.Required("token", req.Token).
+		Required("password", req.Password).
+		Password("password", req.Password)
+
+	return validator.GetErrors()
+}
+
+func ValidateAPIKeyCreate(req *APIKeyCreateRequest) []ValidationError {
+	validator := NewValidator()
+
+	req.Name = validator.SanitizeString(req.Name)
+
+	validator.Required("name", req.Name).
+		MaxLength("name", req.Name, 100)
+
+	if len(req.Scopes) == 0 {
+		validator.AddError("scopes", "At least one scope is required", "REQUIRED")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		validator.AddError("expires_at", "Expiry must be in the future", "INVALID_EXPIRY")
+	}
+
+	return validator.GetErrors()
+}
+
+func ValidateAPIKeyUpdate(req *APIKeyUpdateRequest) []ValidationError {
+	validator := NewValidator()
+
+	if req.Name != nil {
+		*req.Name = validator.SanitizeString(*req.Name)
+		validator.Required("name", *req.Name).
+			MaxLength("name", *req.Name, 100)
+	}
+	if req.Scopes != nil && len(req.Scopes) == 0 {
+		validator.AddError("scopes", "At least one scope is required", "REQUIRED")
+	}
+
+	return validator.GetErrors()
+}
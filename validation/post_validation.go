@@ -0,0 +1,240 @@
+package validation
+
+import (
+	"regexp"
+)
+
+var slugRegex = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+var postStatuses = map[string]bool{
+	"draft":     true,
+	"published": true,
+	"archived":  true,
+}
+
+type PostCreateRequest struct {
+	Title      string `json:"title" binding:"required"`
+	Slug       string `json:"slug"`
+	Content    string `json:"content" binding:"required"`
+	Excerpt    string `json:"excerpt"`
+	Status     string `json:"status"`
+	CategoryID uint   `json:"category_id" binding:"required"`
+}
+
+type PostUpdateRequest struct {
+	Title      *string `json:"title,omitempty"`
+	Slug       *string `json:"slug,omitempty"`
+	Content    *string `json:"content,omitempty"`
+	Excerpt    *string `json:"excerpt,omitempty"`
+	Status     *string `json:"status,omitempty"`
+	CategoryID *uint   `json:"category_id,omitempty"`
+}
+
+type CommentCreateRequest struct {
+	Content string `json:"content" binding:"required"`
+	PostID  uint   `json:"post_id"`
+}
+
+type CommentUpdateRequest struct {
+	Content *string `json:"content,omitempty"`
+}
+
+type CategoryCreateRequest struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug"`
+}
+
+type CategoryUpdateRequest struct {
+	Name *string `json:"name,omitempty"`
+	Slug *string `json:"slug,omitempty"`
+}
+
+type TagCreateRequest struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug"`
+}
+
+type TagUpdateRequest struct {
+	Name *string `json:"name,omitempty"`
+	Slug *string `json:"slug,omitempty"`
+}
+
+type PostTagsRequest struct {
+	TagIDs []uint `json:"tag_ids" binding:"required"`
+}
+
+func ValidatePostCreate(req *PostCreateRequest) []ValidationError {
+	validator := NewValidator()
+
+	// Sanitize inputs
+	req.Title = validator.SanitizeString(req.Title)
+	req.Slug = validator.SanitizeString(req.Slug)
+	req.Excerpt = validator.SanitizeString(req.Excerpt)
+	req.Status = validator.SanitizeString(req.Status)
+
+	// Validate required fields
+	validator.Required("title", req.Title).
+		Required("content", req.Content)
+
+	// Validate field lengths and formats
+	validator.MaxLength("title", req.Title, 200).
+		MaxLength("slug", req.Slug, 250).
+		MaxLength("excerpt", req.Excerpt, 500)
+
+	if req.Slug != "" {
+		validateSlug(validator, "slug", req.Slug)
+	}
+	if req.Status != "" {
+		validatePostStatus(validator, "status", req.Status)
+	}
+	if req.CategoryID == 0 {
+		validator.AddError("category_id", "This field is required", "REQUIRED")
+	}
+
+	return validator.GetErrors()
+}
+
+func ValidatePostUpdate(req *PostUpdateRequest) []ValidationError {
+	validator := NewValidator()
+
+	// Validate only provided fields
+	if req.Title != nil {
+		*req.Title = validator.SanitizeString(*req.Title)
+		validator.Required("title", *req.Title).
+			MaxLength("title", *req.Title, 200)
+	}
+
+	if req.Slug != nil {
+		*req.Slug = validator.SanitizeString(*req.Slug)
+		validator.MaxLength("slug", *req.Slug, 250)
+		validateSlug(validator, "slug", *req.Slug)
+	}
+
+	if req.Content != nil {
+		validator.Required("content", *req.Content)
+	}
+
+	if req.Excerpt != nil {
+		*req.Excerpt = validator.SanitizeString(*req.Excerpt)
+		validator.MaxLength("excerpt", *req.Excerpt, 500)
+	}
+
+	if req.Status != nil {
+		*req.Status = validator.SanitizeString(*req.Status)
+		validatePostStatus(validator, "status", *req.Status)
+	}
+
+	if req.CategoryID != nil && *req.CategoryID == 0 {
+		validator.AddError("category_id", "This field is required", "REQUIRED")
+	}
+
+	return validator.GetErrors()
+}
+
+func ValidateCommentCreate(req *CommentCreateRequest) []ValidationError {
+	validator := NewValidator()
+
+	// Sanitize inputs
+	req.Content = validator.SanitizeString(req.Content)
+
+	validator.Required("content", req.Content).
+		MaxLength("content", req.Content, 1000)
+
+	if req.PostID == 0 {
+		validator.AddError("post_id", "This field is required", "REQUIRED")
+	}
+
+	return validator.GetErrors()
+}
+
+func ValidateCommentUpdate(req *CommentUpdateRequest) []ValidationError {
+	validator := NewValidator()
+
+	if req.Content != nil {
+		*req.Content = validator.SanitizeString(*req.Content)
+		validator.Required("content", *req.Content).
+			MaxLength("content", *req.Content, 1000)
+	}
+
+	return validator.GetErrors()
+}
+
+func ValidateCategoryCreate(req *CategoryCreateRequest) []ValidationError {
+	return validateNameSlug(&req.Name, &req.Slug, 100)
+}
+
+func ValidateCategoryUpdate(req *CategoryUpdateRequest) []ValidationError {
+	return validateOptionalNameSlug(req.Name, req.Slug, 100)
+}
+
+func ValidateTagCreate(req *TagCreateRequest) []ValidationError {
+	return validateNameSlug(&req.Name, &req.Slug, 50)
+}
+
+func ValidateTagUpdate(req *TagUpdateRequest) []ValidationError {
+	return validateOptionalNameSlug(req.Name, req.Slug, 50)
+}
+
+func ValidatePostTags(req *PostTagsRequest) []ValidationError {
+	validator := NewValidator()
+
+	if len(req.TagIDs) == 0 {
+		validator.AddError("tag_ids", "At least one tag is required", "REQUIRED")
+	}
+	for _, id := range req.TagIDs {
+		if id == 0 {
+			validator.AddError("tag_ids", "Tag IDs must be positive integers", "INVALID_ID")
+			break
+		}
+	}
+
+	return validator.GetErrors()
+}
+
+// validateNameSlug validates the name/slug pair shared by categories and tags
+func validateNameSlug(name, slug *string, max int) []ValidationError {
+	validator := NewValidator()
+
+	*name = validator.SanitizeString(*name)
+	*slug = validator.SanitizeString(*slug)
+
+	validator.Required("name", *name).
+		MaxLength("name", *name, max).
+		MaxLength("slug", *slug, max)
+
+	if *slug != "" {
+		validateSlug(validator, "slug", *slug)
+	}
+
+	return validator.GetErrors()
+}
+
+func validateOptionalNameSlug(name, slug *string, max int) []ValidationError {
+	validator := NewValidator()
+
+	if name != nil {
+		*name = validator.SanitizeString(*name)
+		validator.Required("name", *name).
+			MaxLength("name", *name, max)
+	}
+
+	if slug != nil {
+		*slug = validator.SanitizeString(*slug)
+		validator.MaxLength("slug", *slug, max)
+		validateSlug(validator, "slug", *slug)
+	}
+
+	return validator.GetErrors()
+}
+
+func validateSlug(validator *Validator, field, value string) {
+	if !slugRegex.MatchString(value) {
+		validator.AddError(field, "Slug must contain only lowercase letters, digits and hyphens", "INVALID_SLUG")
+	}
+}
+
+func validatePostStatus(validator *Validator, field, value string) {
+	if !postStatuses[value] {
+		validator.AddError(field, "Status must be one of draft, published, archived", "INVALID_STATUS")
+	}
+}
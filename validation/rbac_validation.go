@@ -0,0 +1,71 @@
+package validation
+
+import (
+	"regexp"
+)
+
+var roleNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// aclNameRegex matches resource types and relations of ACL entries
+var aclNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+type RoleCreateRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Parents     []string `json:"parents"`
+	Permissions []string `json:"permissions"`
+}
+
+type RolePermissionRequest struct {
+	Permission string `json:"permission" binding:"required"`
+}
+
+type RoleParentRequest struct {
+	Parent string `json:"parent" binding:"required"`
+}
+
+type UserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type ACLGrantRequest struct {
+	UserID       uint   `json:"user_id" binding:"required"`
+	ResourceType string `json:"resource_type" binding:"required"`
+	ResourceID   uint   `json:"resource_id" binding:"required"`
+	Relation     string `json:"relation" binding:"required"`
+}
+
+func ValidateRoleCreate(req *RoleCreateRequest) []ValidationError {
+	validator := NewValidator()
+
+	req.Name = validator.SanitizeString(req.Name)
+	req.Description = validator.SanitizeString(req.Description)
+
+	validator.Required("name", req.Name).
+		MaxLength("description", req.Description, 255)
+
+	if req.Name != "" && !roleNameRegex.MatchString(req.Name) {
+		validator.AddError("name", "Role name must be 2-50 lowercase letters, digits, hyphens or underscores, starting with a letter", "INVALID_ROLE_NAME")
+	}
+
+	return validator.GetErrors()
+}
+
+func ValidateACLGrant(req *ACLGrantRequest) []ValidationError {
+	validator := NewValidator()
+
+	req.ResourceType = validator.SanitizeString(req.ResourceType)
+	req.Relation = validator.SanitizeString(req.Relation)
+
+	validator.Required("resource_type", req.ResourceType).
+		Required("relation", req.Relation)
+
+	if req.ResourceType != "" && !aclNameRegex.MatchString(req.ResourceType) {
+		validator.AddError("resource_type", "Resource type must be up to 50 lowercase letters, digits or underscores, starting with a letter", "INVALID_RESOURCE_TYPE")
+	}
+	if req.Relation != "" && !aclNameRegex.MatchString(req.Relation) {
+		validator.AddError("relation", "Relation must be up to 50 lowercase letters, digits or underscores, starting with a letter", "INVALID_RELATION")
+	}
+
+	return validator.GetErrors()
+}
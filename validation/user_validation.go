@@ -17,7 +17,10 @@ type UserUpdateRequest struct {
 	Email     *string `json:"email,omitempty"`
 	FirstName *string `json:"first_name,omitempty"`
 	LastName  *string `json:"last_name,omitempty"`
+	Password  *string `json:"password,omitempty"`
 	IsActive  *bool   `json:"is_active,omitempty"`
+	// CurrentPassword confirms changes of the caller's own email or password
+	CurrentPassword *string `json:"current_password,omitempty"`
 }
 
 type UserProfileCreateRequest struct {
@@ -82,6 +85,11 @@ func ValidateUserUpdate(req *UserUpdateRequest) []ValidationError {
 		validator.MaxLength("last_name", *req.LastName, 50)
 	}
 	
+	if req.Password != nil {
+		validator.Required("password", *req.Password).
+			Password("password", *req.Password)
+	}
+	
 	return validator.GetErrors()
 }
 